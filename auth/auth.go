@@ -58,3 +58,42 @@ func RequireAuth(hand http.HandlerFunc) http.HandlerFunc {
 		hand.ServeHTTP(w, r)
 	})
 }
+
+// RequireAuthQuery is RequireAuth which also takes token from access_token query parameter
+// (EventSource of browsers can't set headers)
+func RequireAuthQuery(hand http.HandlerFunc) http.HandlerFunc {
+	withAuth := RequireAuth(hand)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		withAuth.ServeHTTP(w, r)
+	})
+}
+
+// RequireAuthProtocol is RequireAuth which also takes token from Sec-WebSocket-Protocol header
+// as "access_token, <token>"(only header browsers can set for websocket handshake, unlike url it isn't logged)
+func RequireAuthProtocol(hand http.HandlerFunc) http.HandlerFunc {
+	withAuth := RequireAuth(hand)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+		if len(protocols) == 2 && strings.TrimSpace(protocols[0]) == "access_token" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+strings.TrimSpace(protocols[1]))
+		}
+		withAuth.ServeHTTP(w, r)
+	})
+}
+
+// OptionalAuth is RequireAuth for requests with token, anonymous requests come with zero UserID
+func OptionalAuth(hand http.HandlerFunc) http.HandlerFunc {
+	withAuth := RequireAuth(hand)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			withAuth.ServeHTTP(w, r)
+			return
+		}
+		hand.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserID, uint(0))))
+	})
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/caarlos0/env"
 )
@@ -10,12 +11,46 @@ import (
 type Config struct {
 	TokenPassword string `env:"TOKEN_PASSWORD" envDefault:"only_for_testing"`
 	Host          string `env:"HOST" envDefault:":8000"`
+	PublicURL     string `env:"PUBLIC_URL"` // base of absolute links, feeds and sitemap are disabled if empty
 	DBHost        string `env:"DB_HOST"`
 	DBName        string `env:"DB_NAME"`
 	DBPassword    string `env:"DB_PASSWORD"`
 	PerPage       int    `env:"PER_PAGE" envDefault:"10"`
 	BodyLength    int    `env:"BODY_LENGTH" envDefault:"1024"`
 	TitleLength   int    `env:"TITLE_LENGTH" envDefault:"40"`
+
+	LiveSaveInterval time.Duration `env:"LIVE_SAVE_INTERVAL" envDefault:"5s"`
+
+	WebhookMaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"5"`
+	WebhookBackoff      time.Duration `env:"WEBHOOK_BACKOFF" envDefault:"10s"`
+	WebhookTimeout      time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookAllowPrivate bool          `env:"WEBHOOK_ALLOW_PRIVATE"` // allow delivery to private and loopback addresses
+
+	ReminderLease       time.Duration `env:"REMINDER_LEASE" envDefault:"5m"` // reminder is retried after it if not delivered
+	ReminderMaxAttempts int           `env:"REMINDER_MAX_ATTEMPTS" envDefault:"5"`
+
+	ImportMaxSize     int64 `env:"IMPORT_MAX_SIZE" envDefault:"10485760"`
+	ImportMaxFiles    int   `env:"IMPORT_MAX_FILES" envDefault:"1000"`         // entries in archive, notes in json or enex
+	ImportMaxUnpacked int64 `env:"IMPORT_MAX_UNPACKED" envDefault:"104857600"` // total size of unpacked archive
+
+	SitemapSize int `env:"SITEMAP_SIZE" envDefault:"50000"` // max urls in one sitemap file
+
+	StorageBackend    string        `env:"STORAGE_BACKEND" envDefault:"local"`
+	StoragePath       string        `env:"STORAGE_PATH" envDefault:"attachments"`
+	S3Endpoint        string        `env:"S3_ENDPOINT"`
+	S3Region          string        `env:"S3_REGION" envDefault:"us-east-1"`
+	S3Bucket          string        `env:"S3_BUCKET"`
+	S3AccessKey       string        `env:"S3_ACCESS_KEY"`
+	S3SecretKey       string        `env:"S3_SECRET_KEY"`
+	S3Timeout         time.Duration `env:"S3_TIMEOUT" envDefault:"30s"`
+	AttachmentMaxSize int64         `env:"ATTACHMENT_MAX_SIZE" envDefault:"10485760"`
+	StorageQuota      int64         `env:"STORAGE_QUOTA" envDefault:"104857600"`
+	AttachmentURLTTL  time.Duration `env:"ATTACHMENT_URL_TTL" envDefault:"1h"`
+
+	SMTPAddr     string `env:"SMTP_ADDR"` // host:port, emails are not sent if empty
+	SMTPUser     string `env:"SMTP_USER"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+	MailFrom     string `env:"MAIL_FROM" envDefault:"notes@localhost"`
 }
 
 //Cfg - parsed instance of Config
@@ -25,4 +60,8 @@ func init() {
 	if err := env.Parse(&Cfg); err != nil {
 		log.Fatalf("when parsing env: %v", err)
 	}
+	// sitemap protocol allows at most 50000 urls in file, and size is divisor of ids
+	if Cfg.SitemapSize < 1 || Cfg.SitemapSize > 50000 {
+		log.Fatalf("SITEMAP_SIZE must be in 1..50000, got %d", Cfg.SitemapSize)
+	}
 }
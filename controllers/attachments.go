@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"notes/auth"
+	"notes/imaging"
+	"notes/models"
+	"notes/storage"
+	"notes/thumbnails"
+	"notes/util"
+	"strconv"
+	"strings"
+
+	. "notes/config"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// content types which are safe to show in browser, others are always downloaded
+var inlineContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// multipart overhead allowed above max attachment size
+const multipartOverhead = 1 << 20
+
+func accessibleNote(w http.ResponseWriter, r *http.Request, required models.Permission) (*models.Note, bool) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+
+	err := note.GetAccessible(GetUserID(r), required)
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return nil, false
+	} else if err == models.ErrForbidden {
+		util.RespondWithError(w, 403, "you have no write access to note")
+		return nil, false
+	} else if err != nil {
+		panic(err)
+	}
+	return note, true
+}
+
+//UploadAttachment to note from "file" field of multipart form
+var UploadAttachment = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, Cfg.AttachmentMaxSize+multipartOverhead)
+	defer r.Body.Close()
+
+	note, ok := accessibleNote(w, r, models.PermissionWrite)
+	if !ok {
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			util.RespondWithError(w, 413, fmt.Sprintf("file is too big(max %d bytes)", Cfg.AttachmentMaxSize))
+		} else {
+			util.RespondWithError(w, 400, "file field of multipart form is required")
+		}
+		return
+	}
+	defer file.Close()
+
+	attachment := &models.Attachment{
+		NoteID:   note.ID,
+		UserID:   note.UserID,
+		Filename: header.Filename,
+		Size:     header.Size,
+	}
+	err = attachment.Create(file)
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err == models.ErrQuotaExceeded {
+		util.RespondWithError(w, 413, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	if attachment.ThumbnailStatus == models.ThumbnailsPending {
+		thumbnails.WakeUp()
+	}
+
+	attachment.SignURL(Cfg.AttachmentURLTTL)
+	resp := util.ResponseBaseOK()
+	resp["attachment"] = attachment
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//AttachmentsList of note with signed download urls
+var AttachmentsList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note, ok := accessibleNote(w, r, models.PermissionRead)
+	if !ok {
+		return
+	}
+
+	attachments := []models.Attachment{}
+	if err := models.GetDB().Where("note_id = ?", note.ID).Order("id").Find(&attachments).Error; err != nil {
+		panic(err)
+	}
+	for i := range attachments {
+		attachments[i].SignURL(Cfg.AttachmentURLTTL)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["attachments"] = attachments
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//AttachmentRemove frees storage of note owner
+var AttachmentRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note, ok := accessibleNote(w, r, models.PermissionWrite)
+	if !ok {
+		return
+	}
+
+	attachment := &models.Attachment{NoteID: note.ID}
+	fmt.Sscan(mux.Vars(r)["attachment_id"], &attachment.ID)
+
+	err := attachment.Remove()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such attachment")
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+//PublishedAttachmentsList of published note
+func PublishedAttachmentsList(w http.ResponseWriter, r *http.Request) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+	err := note.GetPublished()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	attachments := []models.Attachment{}
+	if err := models.GetDB().Where("note_id = ?", note.ID).Order("id").Find(&attachments).Error; err != nil {
+		panic(err)
+	}
+	for i := range attachments {
+		attachments[i].URL = attachments[i].DownloadURL()
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["attachments"] = attachments
+	util.RespondWithJSON(w, 200, resp)
+}
+
+// attachmentAllowed by valid signature of url, when note is published or attachment is avatar
+func attachmentAllowed(r *http.Request, a *models.Attachment) bool {
+	q := r.URL.Query()
+	if sig := q.Get("sig"); sig != "" {
+		expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+		return err == nil && a.CheckSignature(expires, sig)
+	}
+	if models.IsAvatar(a.ID) {
+		return true
+	}
+	note := &models.Note{}
+	note.ID = a.NoteID
+	err := note.GetPublished()
+	if err != nil && err != gorm.ErrRecordNotFound {
+		panic(err)
+	}
+	return err == nil
+}
+
+func contentDisposition(kind, filename string) string {
+	if v := mime.FormatMediaType(kind, map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return kind
+}
+
+//DownloadAttachment by signed url(or unsigned for published notes), size parameter gives thumbnail of image
+func DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment := &models.Attachment{}
+	fmt.Sscan(mux.Vars(r)["attachment_id"], &attachment.ID)
+	err := models.GetDB().Take(attachment).Error
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such attachment")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	if !attachmentAllowed(r, attachment) {
+		util.RespondWithError(w, 403, "download link is invalid or expired")
+		return
+	}
+
+	var content io.ReadCloser
+	contentType, length := attachment.ContentType, attachment.Size
+	if size := r.URL.Query().Get("size"); size != "" {
+		if _, ok := models.ThumbnailSizes[size]; !ok {
+			util.RespondWithError(w, 400, "unknown size "+size+", use small or medium")
+			return
+		}
+		if !attachment.Thumbnails.Has(size) {
+			util.RespondWithError(w, 404, "thumbnail is not available")
+			return
+		}
+		content, err = attachment.OpenThumbnail(size)
+		contentType, length = imaging.ThumbnailType(attachment.ContentType), -1
+	} else {
+		content, err = attachment.Open()
+	}
+	if err == storage.ErrNotFound {
+		util.RespondWithError(w, 404, "attachment content is missing")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	defer content.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	disposition := "attachment"
+	if inlineContentTypes[mediaType] {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if length >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, attachment.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(200)
+	io.Copy(w, content)
+}
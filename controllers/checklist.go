@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// withCompletion adds percentage of done checklist items to views of notes, it's null for notes without items
+func withCompletion(views []map[string]interface{}, notes []models.Note) {
+	if len(notes) == 0 {
+		return
+	}
+	completion := models.ChecklistCompletion(noteIDs(notes))
+	for i := range notes {
+		if c, ok := completion[notes[i].ID]; ok {
+			views[i]["completion"] = c
+		} else {
+			views[i]["completion"] = nil
+		}
+	}
+}
+
+//ChecklistItemsList of note in order
+var ChecklistItemsList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note, ok := accessibleNote(w, r, models.PermissionRead)
+	if !ok {
+		return
+	}
+
+	items := []models.ChecklistItem{}
+	if err := models.GetDB().Where("note_id = ?", note.ID).Order("position, id").Find(&items).Error; err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["items"] = items
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//CreateChecklistItem appends item to note(or inserts it at position)
+var CreateChecklistItem = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	req := &struct {
+		Text     string     `json:"text"`
+		Done     bool       `json:"done"`
+		Position *int       `json:"position"`
+		DueDate  *time.Time `json:"due_date"`
+	}{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	note, ok := accessibleNote(w, r, models.PermissionWrite)
+	if !ok {
+		return
+	}
+
+	item := &models.ChecklistItem{NoteID: note.ID, Text: req.Text, Done: req.Done, DueDate: req.DueDate}
+	err := item.Create(req.Position)
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["item"] = item
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//ChecklistItemUpdate changes text, done or due date of item
+var ChecklistItemUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	patch := &models.ChecklistItemPatch{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	note, ok := accessibleNote(w, r, models.PermissionWrite)
+	if !ok {
+		return
+	}
+
+	item := &models.ChecklistItem{NoteID: note.ID}
+	fmt.Sscan(mux.Vars(r)["item_id"], &item.ID)
+
+	err := item.Update(patch)
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such item")
+	} else if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+	} else if err != nil {
+		panic(err)
+	} else {
+		resp := util.ResponseBaseOK()
+		resp["item"] = item
+		util.RespondWithJSON(w, 200, resp)
+	}
+})
+
+//ChecklistItemRemove ...
+var ChecklistItemRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note, ok := accessibleNote(w, r, models.PermissionWrite)
+	if !ok {
+		return
+	}
+
+	item := &models.ChecklistItem{NoteID: note.ID}
+	fmt.Sscan(mux.Vars(r)["item_id"], &item.ID)
+
+	err := item.Remove()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such item")
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+//ChecklistReorder takes ids of all items of note in new order
+var ChecklistReorder = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	req := &struct {
+		IDs []uint `json:"ids"`
+	}{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	note, ok := accessibleNote(w, r, models.PermissionWrite)
+	if !ok {
+		return
+	}
+
+	err := models.ReorderChecklist(note.ID, req.IDs)
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+type todoItem struct {
+	models.ChecklistItem
+	NoteTitle string `json:"note_title"`
+}
+
+// openItems of user's notes(not archived)
+func openItems(req *http.Request) func(db *gorm.DB) *gorm.DB {
+	userID := GetUserID(req)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Joins("JOIN notes ON notes.id = checklist_items.note_id").
+			Where("notes.user_id = ? AND NOT notes.archived AND NOT checklist_items.done", userID)
+	}
+}
+
+//TodoList is open checklist items of all notes, items with nearest due date go first
+var TodoList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	items := []todoItem{}
+	err := models.GetDB().Model(&models.ChecklistItem{}).Scopes(openItems(r), Paginate(r)).
+		Select("checklist_items.*, notes.title AS note_title").
+		Order("checklist_items.due_date IS NULL, checklist_items.due_date, checklist_items.note_id, checklist_items.position").
+		Find(&items).Error
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["items"] = items
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.ChecklistItem{}).Scopes(openItems(r)))
+	util.RespondWithJSON(w, 200, resp)
+})
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/live"
+	"notes/models"
+	"notes/util"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type collaboratorRequest struct {
+	UserID     uint              `json:"user_id"`
+	Username   string            `json:"username"`
+	Permission models.Permission `json:"permission"`
+}
+
+//CollaboratorsList of user's note
+var CollaboratorsList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+	note.UserID = GetUserID(r)
+
+	err := note.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	collaborators := &[]map[string]interface{}{}
+	err = models.GetDB().Model(&models.NoteShare{}).
+		Select("note_shares.user_id, users.username, note_shares.permission, note_shares.created_at").
+		Joins("JOIN users ON users.id = note_shares.user_id").
+		Where("note_shares.note_id = ?", note.ID).Order("note_shares.created_at").
+		Find(collaborators).Error
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["collaborators"] = collaborators
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//InviteCollaborator grants(or changes) access to note by user_id or username
+var InviteCollaborator = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+	note.UserID = GetUserID(r)
+
+	req := &collaboratorRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	err := note.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	if req.UserID == 0 && req.Username != "" {
+		user := &models.User{}
+		err := models.GetDB().Where("username = ?", req.Username).Take(user).Error
+		if err == gorm.ErrRecordNotFound {
+			util.RespondWithError(w, 422, "Validation error. No such user")
+			return
+		} else if err != nil {
+			panic(err)
+		}
+		req.UserID = user.ID
+	}
+
+	share := &models.NoteShare{NoteID: note.ID, UserID: req.UserID, Permission: req.Permission}
+	err = share.Save(note.UserID)
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	live.AccessChanged(note.ID)
+
+	resp := util.ResponseBaseOK()
+	resp["collaborator"] = share
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//RevokeCollaborator removes access(owner can revoke anyone, collaborator can leave)
+var RevokeCollaborator = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r)
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+	share := &models.NoteShare{}
+	fmt.Sscan(mux.Vars(r)["user_id"], &share.UserID)
+
+	err := note.GetAccessible(userID, models.PermissionRead)
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	if note.UserID != userID && share.UserID != userID {
+		util.RespondWithError(w, 403, "only owner can revoke access of others")
+		return
+	}
+
+	share.NoteID = note.ID
+	err = share.Remove()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such collaborator")
+	} else if err != nil {
+		panic(err)
+	} else {
+		live.AccessChanged(note.ID)
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+//SharedWithMeList notes shared with user by others
+var SharedWithMeList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	defaults := []string{"created_at", "updated_at", "title", "user_id", "published", "visibility", "permission", "completion"}
+	q, ok := sparseOrRespond(w, r, sharedListFields, defaults, noteIncludes)
+	if !ok {
+		return
+	}
+	notes := []models.Note{}
+	err := models.GetDB().Model(&models.Note{}).Scopes(SharedWith(r), Paginate(r), NewFirst, q.noteScope(sharedListFields)).
+		Find(&notes).Error
+	if err != nil {
+		panic(err)
+	}
+	views := q.notes(notes, true)
+	if q.has("permission") {
+		withPermissions(views, notes, GetUserID(r))
+	}
+	if q.has("completion") {
+		withCompletion(views, notes)
+	}
+	resp := util.ResponseBaseOK()
+	resp["notes"] = views
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Note{}).Scopes(SharedWith(r)))
+
+	util.RespondWithJSON(w, 200, resp)
+})
+
+// withPermissions adds permission of user to notes shared with them
+func withPermissions(views []map[string]interface{}, notes []models.Note, userID uint) {
+	shares := []models.NoteShare{}
+	if err := models.GetDB().Where("user_id = ? AND note_id IN ?", userID, noteIDs(notes)).Find(&shares).Error; err != nil {
+		panic(err)
+	}
+	permissions := map[uint]models.Permission{}
+	for _, share := range shares {
+		permissions[share.NoteID] = share.Permission
+	}
+	for i := range notes {
+		views[i]["permission"] = permissions[notes[i].ID]
+	}
+}
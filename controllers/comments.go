@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// withCommentCounts adds comments_count to views of notes
+func withCommentCounts(views []map[string]interface{}, notes []models.Note) {
+	if len(notes) == 0 {
+		return
+	}
+	counts := models.CommentCounts(noteIDs(notes))
+	for i := range notes {
+		views[i]["comments_count"] = counts[notes[i].ID]
+	}
+}
+
+// publishedNote from request or responds with 404
+func publishedNote(w http.ResponseWriter, r *http.Request) (*models.Note, bool) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+	err := note.GetPublished()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return nil, false
+	} else if err != nil {
+		panic(err)
+	}
+	return note, true
+}
+
+// noteComments scope selects top level comments of note
+func noteComments(noteID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("note_id = ? AND parent_id IS NULL", noteID)
+	}
+}
+
+//CommentsList of published note, threads are paginated by top level comments(oldest first)
+var CommentsList = auth.OptionalAuth(func(w http.ResponseWriter, r *http.Request) {
+	note, ok := publishedNote(w, r)
+	if !ok {
+		return
+	}
+
+	roots := []models.Comment{}
+	err := models.GetDB().Scopes(noteComments(note.ID), Paginate(r)).Order("id").Find(&roots).Error
+	if err != nil {
+		panic(err)
+	}
+	threads, err := note.CommentThreads(roots, GetUserID(r))
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["comments"] = threads
+	resp["comments_disabled"] = note.CommentsDisabled
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Comment{}).Scopes(noteComments(note.ID)))
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//CreateComment on published note(reply if parent_id is given)
+var CreateComment = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	comment := &models.Comment{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(comment); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	comment = &models.Comment{Body: comment.Body, ParentID: comment.ParentID, UserID: GetUserID(r)}
+	fmt.Sscan(mux.Vars(r)["note_id"], &comment.NoteID)
+	err := comment.Create()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err == models.ErrCommentsDisabled {
+		util.RespondWithError(w, 403, err.Error())
+		return
+	} else if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["comment"] = comment
+	util.RespondWithJSON(w, 200, resp)
+})
+
+// commentOfNote from request, responds with 404 if note isn't published or comment is missing
+func commentOfNote(w http.ResponseWriter, r *http.Request) (*models.Note, *models.Comment, bool) {
+	note, ok := publishedNote(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	comment := &models.Comment{NoteID: note.ID}
+	fmt.Sscan(mux.Vars(r)["comment_id"], &comment.ID)
+	err := comment.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such comment")
+		return nil, nil, false
+	} else if err != nil {
+		panic(err)
+	}
+	return note, comment, true
+}
+
+//CommentUpdate edits body(by author) or hides comment(by owner of note)
+var CommentUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	patch := &struct {
+		Body   *string `json:"body"`
+		Hidden *bool   `json:"hidden"`
+	}{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	note, comment, ok := commentOfNote(w, r)
+	if !ok {
+		return
+	}
+	userID := GetUserID(r)
+	if patch.Body != nil && comment.UserID != userID {
+		util.RespondWithError(w, 403, "only author can edit comment")
+		return
+	}
+	if patch.Hidden != nil && note.UserID != userID {
+		util.RespondWithError(w, 403, "only owner of note can hide comment")
+		return
+	}
+
+	var err error
+	if patch.Body != nil {
+		err = comment.Edit(*patch.Body)
+	}
+	if err == nil && patch.Hidden != nil {
+		err = comment.SetHidden(*patch.Hidden)
+	}
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["comment"] = comment
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//CommentRemove by author or owner of note
+var CommentRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note, comment, ok := commentOfNote(w, r)
+	if !ok {
+		return
+	}
+	userID := GetUserID(r)
+	if comment.UserID != userID && note.UserID != userID {
+		util.RespondWithError(w, 403, "only author or owner of note can remove comment")
+		return
+	}
+
+	if err := comment.Remove(); err != nil {
+		panic(err)
+	}
+	util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+})
@@ -6,7 +6,12 @@ import (
 	"net/http"
 	"notes/auth"
 	"notes/models"
+	"notes/publishing"
+	"notes/render"
 	"notes/util"
+	"time"
+
+	. "notes/config"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -14,14 +19,20 @@ import (
 
 //CreateAccount controller
 func CreateAccount(w http.ResponseWriter, r *http.Request) {
-	a := &models.User{}
+	// only credentials, profile is set by ProfileUpdate
+	req := &struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}{}
 
 	defer r.Body.Close()
-	if err := json.NewDecoder(r.Body).Decode(a); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		util.RespondWithError(w, 400, "invalid request")
 		return
 	}
 
+	a := &models.User{Username: req.Username, Password: req.Password, Email: req.Email}
 	err := a.Create()
 
 	if models.IsErrValidation(err) {
@@ -73,71 +84,132 @@ func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
 	util.RespondWithError(w, 405, r.Method+" not allowed")
 }
 
-//CreateNote for user controller
+//CreateNote for user controller(from template if template_id is given)
 var CreateNote = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
-	note := &models.Note{}
+	// only fields which client may set, ids and counters are never taken from body
+	req := &struct {
+		Title            string            `json:"title"`
+		Body             string            `json:"body"`
+		Published        bool              `json:"published"`
+		Visibility       models.Visibility `json:"visibility"`
+		Tags             []models.Tag      `json:"tags"`
+		PublishAt        *time.Time        `json:"publish_at"`
+		UnpublishAt      *time.Time        `json:"unpublish_at"`
+		CommentsDisabled bool              `json:"comments_disabled"`
+		Variables        map[string]string `json:"variables"`
+		TimeZone         string            `json:"time_zone"`
+	}{}
 
 	defer r.Body.Close()
-	if err := json.NewDecoder(r.Body).Decode(note); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
 		util.RespondWithError(w, 400, "body cannot be used for create")
 		return
 	}
 
+	note := &models.Note{Title: req.Title, Body: req.Body, Published: req.Published, Visibility: req.Visibility,
+		Tags: req.Tags, PublishAt: req.PublishAt, UnpublishAt: req.UnpublishAt, CommentsDisabled: req.CommentsDisabled}
 	note.UserID = GetUserID(r)
-	err := note.Create()
+	var err error
+	if r.URL.Query().Get("template_id") != "" {
+		err = fromTemplate(r, note, req.Variables, req.TimeZone)
+	}
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such template")
+		return
+	}
+	if err == nil {
+		err = note.Create()
+	}
 	if models.IsErrValidation(err) {
 		util.RespondWithError(w, 422, err.Error())
 		return
 	} else if err != nil {
 		panic(err)
 	}
+	if note.PublishAt != nil || note.UnpublishAt != nil {
+		publishing.WakeUp()
+	}
 
 	util.RespondWithJSON(w, 200, util.ResponseBaseOK())
 })
 
 //NotesList for user controller
 var NotesList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
-	notes := &[]map[string]interface{}{}
-	err := models.GetDB().Model(&models.Note{}).Scopes(OwnedBy(r), Paginate(r), NewFirst).
-		Omit("body").Find(notes).Error
+	q, ok := sparseOrRespond(w, r, ownListFields, ownListFields.all("body"), noteIncludes)
+	if !ok {
+		return
+	}
+	notes := []models.Note{}
+	err := models.GetDB().Model(&models.Note{}).Scopes(OwnedBy(r), Archived(r), Starred(r), Paginate(r), PinnedFirst, NewFirst).
+		Scopes(q.noteScope(ownListFields)).Find(&notes).Error
 	if err != nil {
 		panic(err)
 	}
+	views := q.notes(notes, true)
+	if q.has("completion") {
+		withCompletion(views, notes)
+	}
 	resp := util.ResponseBaseOK()
-	resp["notes"] = notes
-	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Note{}).Scopes(OwnedBy(r)))
+	resp["notes"] = views
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Note{}).Scopes(OwnedBy(r), Archived(r), Starred(r)))
 
 	util.RespondWithJSON(w, 200, resp)
 })
 
 //PublishedNotesList ...
 var PublishedNotesList = func(w http.ResponseWriter, r *http.Request) {
-	notes := &[]map[string]interface{}{}
-	err := models.GetDB().Model(&models.Note{}).Scopes(Published, Paginate(r), NewFirst).
-		Omit("body").Find(notes).Error
+	respondWithPublished(w, r, Published)
+}
+
+// respondWithPublished notes selected by filters(sorted by sort parameter)
+func respondWithPublished(w http.ResponseWriter, r *http.Request, filters ...func(db *gorm.DB) *gorm.DB) {
+	order, ok := PublishedOrder(r)
+	if !ok {
+		util.RespondWithError(w, 400, "sort should be new, popular or trending")
+		return
+	}
+	q, ok := sparseOrRespond(w, r, publishedListFields, publishedListFields.all("body"), noteIncludes)
+	if !ok {
+		return
+	}
+	notes := []models.Note{}
+	err := models.GetDB().Model(&models.Note{}).Scopes(filters...).Scopes(Paginate(r), order, q.noteScope(publishedListFields)).
+		Find(&notes).Error
 	if err != nil {
 		panic(err)
 	}
+	views := q.notes(notes, false)
+	if q.has("comments_count") {
+		withCommentCounts(views, notes)
+	}
 	resp := util.ResponseBaseOK()
-	resp["notes"] = notes
-	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Note{}).Scopes(Published))
+	resp["notes"] = views
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Note{}).Scopes(filters...))
 
 	util.RespondWithJSON(w, 200, resp)
 }
 
 // PublishedNoteDetail ...
 func PublishedNoteDetail(w http.ResponseWriter, r *http.Request) {
+	q, ok := sparseOrRespond(w, r, publicNoteFields, publicNoteFields.all(), noteIncludes, "tags")
+	if !ok {
+		return
+	}
 	var noteID uint
 	fmt.Sscan(mux.Vars(r)["note_id"], &noteID)
-	note := &models.Note{Model: models.Model{ID: noteID}, Published: true}
-	err := note.Get()
+	note := &models.Note{Model: models.Model{ID: noteID}}
+	err := note.GetPublished()
+	if err == nil {
+		err = q.loadIncludes(note)
+	}
 	if err == gorm.ErrRecordNotFound {
 		util.RespondWithError(w, 404, "no such note")
+		return
 	} else if err != nil {
 		panic(err)
 	}
 	resp := util.ResponseBaseOK()
-	resp["note"] = notePrework(r, note)
+	resp["note"] = q.note(note, false)
 
 	util.RespondWithJSON(w, 200, resp)
 }
@@ -146,45 +218,75 @@ func PublishedNoteDetail(w http.ResponseWriter, r *http.Request) {
 func AnotherUserDetail(w http.ResponseWriter, r *http.Request) {
 	user := &models.User{}
 	fmt.Sscan(mux.Vars(r)["user_id"], &user.ID)
+	respondWithProfile(w, r, user, user.Get())
+}
+
+// UserByName is AnotherUserDetail by username
+func UserByName(w http.ResponseWriter, r *http.Request) {
+	user := &models.User{}
+	err := models.GetDB().Where("username = ?", mux.Vars(r)["username"]).Take(user).Error
+	respondWithProfile(w, r, user, err)
+}
 
-	err := user.Get()
+// respondWithProfile of user loaded with err
+func respondWithProfile(w http.ResponseWriter, r *http.Request, user *models.User, err error) {
+	q, ok := sparseOrRespond(w, r, publicUserFields, publicUserFields.all(), nil)
+	if !ok {
+		return
+	}
 	if err == gorm.ErrRecordNotFound {
 		util.RespondWithError(w, 404, "no such user")
+		return
 	} else if err != nil {
 		panic(err)
 	}
-	user.Password = ""
 	resp := util.ResponseBaseOK()
-	resp["user"] = user
+	resp["user"] = q.user(user, false)
+	resp["avatar_url"] = user.AvatarURL()
+	resp["followers_count"], resp["following_count"] = models.FollowCounts(user.ID)
 	util.RespondWithJSON(w, 200, resp)
 }
 
-func notePrework(r *http.Request, n *models.Note) *models.Note {
-	if r.URL.Query().Get("no_body") == "true" {
-		n.Body = ""
+// UserNotesList is published notes of user, same as published notes list
+func UserNotesList(w http.ResponseWriter, r *http.Request) {
+	user := &models.User{}
+	fmt.Sscan(mux.Vars(r)["user_id"], &user.ID)
+	if err := user.Get(); err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such user")
+		return
+	} else if err != nil {
+		panic(err)
 	}
-	return n
+	respondWithPublished(w, r, Published, func(db *gorm.DB) *gorm.DB {
+		return db.Where("notes.user_id = ?", user.ID)
+	})
 }
 
 //NoteDetails ....
 var NoteDetails = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept") // format is negotiated, caches must not mix them up
 	userID := GetUserID(r)
-	var noteID uint
-	fmt.Sscan(mux.Vars(r)["note_id"], &noteID)
-
 	note := &models.Note{}
-	note.ID = noteID
-	note.UserID = userID
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
 
-	err := note.Get()
+	err := note.GetAccessible(userID, models.PermissionRead)
+	if err == nil {
+		err = note.LoadTags()
+	}
 
 	if err == gorm.ErrRecordNotFound {
 		util.RespondWithError(w, 404, "no such note")
 	} else if err != nil {
 		panic(err)
-	} else {
+	} else if format := negotiateFormat(r); format != "" {
+		filename := render.Filename(note.Title, fmt.Sprintf("note-%d", note.ID), format)
+		respondWithExport(w, format, note.Title, filename, []render.Doc{exportDoc(note)}, false)
+	} else if q, ok := sparseOrRespond(w, r, ownNoteFields, ownNoteFields.all(), noteIncludes, "tags"); ok {
+		if err := q.loadIncludes(note); err != nil {
+			panic(err)
+		}
 		resp := util.ResponseBaseOK()
-		resp["note"] = notePrework(r, note)
+		resp["note"] = q.note(note, true)
 		util.RespondWithJSON(w, 200, resp)
 	}
 })
@@ -192,14 +294,23 @@ var NoteDetails = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request)
 //NoteRemove ....
 var NoteRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 	userID := GetUserID(r)
-	var noteID uint
-	fmt.Sscan(mux.Vars(r)["note_id"], &noteID)
-
 	note := &models.Note{}
-	note.ID = noteID
-	note.UserID = userID
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
 
-	err := note.Remove()
+	err := note.GetAccessible(userID, models.PermissionRead)
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	if note.UserID != userID {
+		util.RespondWithError(w, 403, "only owner can remove note")
+		return
+	}
+
+	note = &models.Note{Model: models.Model{ID: note.ID}, UserID: note.UserID}
+	err = note.Remove()
 
 	if err == gorm.ErrRecordNotFound {
 		util.RespondWithError(w, 404, "no such note")
@@ -213,12 +324,9 @@ var NoteRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 //NoteUpdate ....
 var NoteUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 	userID := GetUserID(r)
-	var noteID uint
-	fmt.Sscan(mux.Vars(r)["note_id"], &noteID)
-
 	note := &models.Note{}
-	note.ID = noteID
-	note.UserID = userID
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+
 	patch := &models.NotePatch{}
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
@@ -226,7 +334,31 @@ var NoteUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := note.Update(patch)
+	err := note.GetAccessible(userID, models.PermissionWrite)
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err == models.ErrForbidden {
+		util.RespondWithError(w, 403, "you have no write access to this note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	if note.UserID != userID && (patch.Published != nil || patch.Visibility != nil || patch.HasSchedule()) {
+		util.RespondWithError(w, 403, "only owner can change publicity of note")
+		return
+	}
+	if note.UserID != userID && patch.HasStates() {
+		util.RespondWithError(w, 403, "only owner can pin, archive or star note")
+		return
+	}
+	if note.UserID != userID && patch.CommentsDisabled != nil {
+		util.RespondWithError(w, 403, "only owner can disable comments")
+		return
+	}
+
+	note = &models.Note{Model: models.Model{ID: note.ID}, UserID: note.UserID}
+	err = note.Update(patch)
 
 	if err == gorm.ErrRecordNotFound {
 		util.RespondWithError(w, 404, "no such note")
@@ -234,6 +366,30 @@ var NoteUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 		util.RespondWithError(w, 422, err.Error())
 	} else if err != nil {
 		panic(err)
+	} else {
+		if patch.HasSchedule() {
+			publishing.WakeUp()
+		}
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+//ProfileUpdate of current user
+var ProfileUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	patch := &models.ProfilePatch{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	user := &models.User{}
+	user.ID = GetUserID(r)
+	err := user.UpdateProfile(patch)
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+	} else if err != nil {
+		panic(err)
 	} else {
 		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
 	}
@@ -241,14 +397,18 @@ var NoteUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
 
 //UserDetails ....
 var UserDetails = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	q, ok := sparseOrRespond(w, r, ownUserFields, ownUserFields.all(), nil)
+	if !ok {
+		return
+	}
 	userID := GetUserID(r)
 	user := &models.User{}
 	user.ID = userID
 	if err := user.Get(); err != nil {
 		panic("user should always be valid because of authorization")
 	}
-	user.Password = "<hashed>"
 	resp := util.ResponseBaseOK()
-	resp["user"] = user
+	resp["user"] = q.user(user, true)
+	resp["storage"] = map[string]int64{"used": user.StorageUsed, "quota": Cfg.StorageQuota}
 	util.RespondWithJSON(w, 200, resp)
 })
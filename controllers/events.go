@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/events"
+	"notes/util"
+	"strconv"
+	"time"
+)
+
+// keeps connection alive through proxies
+const heartbeatInterval = 15 * time.Second
+
+func writeEvent(w http.ResponseWriter, e events.Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
+
+//EventsStream sends changes of user's notes as server-sent events, resumes from Last-Event-ID
+var EventsStream = auth.RequireAuthQuery(func(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		util.RespondWithError(w, 500, "streaming is not supported")
+		return
+	}
+
+	lastIDStr := r.Header.Get("Last-Event-ID")
+	if lastIDStr == "" {
+		lastIDStr = r.URL.Query().Get("last_event_id")
+	}
+	lastID, _ := strconv.ParseUint(lastIDStr, 10, 64)
+
+	sub, missed, complete := events.SubscribeSince(GetUserID(r), lastID)
+	defer events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+
+	if !complete {
+		// client should refetch everything
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range missed {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				// too slow, client will reconnect with Last-Event-ID
+				return
+			}
+			writeEvent(w, e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+})
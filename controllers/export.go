@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/render"
+	"notes/util"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var exportFormatByType = map[string]string{
+	"text/markdown":    render.FormatMarkdown,
+	"text/x-markdown":  render.FormatMarkdown,
+	"text/plain":       render.FormatText,
+	"text/html":        render.FormatHTML,
+	"application/json": "",
+	"application/*":    "",
+	"*/*":              "",
+}
+
+// negotiateFormat picks export format by Accept header, empty format means json
+func negotiateFormat(r *http.Request) string {
+	type choice struct {
+		format string
+		q      float64
+	}
+	choices := []choice{}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		format, ok := exportFormatByType[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			choices = append(choices, choice{format, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	if len(choices) == 0 {
+		return ""
+	}
+	return choices[0].format
+}
+
+func exportDoc(n *models.Note) render.Doc {
+	return render.Doc{Title: n.Title, Body: n.Body, Tags: tagNamesOf(n), UpdatedAt: n.UpdatedAt}
+}
+
+func tagNamesOf(n *models.Note) []string {
+	names := []string{}
+	for _, t := range n.Tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// respondWithExport writes rendered docs as file, download=false lets browser show it
+func respondWithExport(w http.ResponseWriter, format, title, filename string, docs []render.Doc, download bool) {
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", render.ContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(200)
+	w.Write(render.Export(format, title, docs))
+}
+
+func exportFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = render.FormatMarkdown
+	}
+	if !render.Known(format) {
+		util.RespondWithError(w, 400, "unknown format "+format+", use markdown, text, html or print")
+		return "", false
+	}
+	return format, true
+}
+
+//NoteExport downloads note as markdown, text, html or printable html
+var NoteExport = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+
+	err := note.GetAccessible(GetUserID(r), models.PermissionRead)
+	if err == nil {
+		err = note.LoadTags()
+	}
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	filename := render.Filename(note.Title, fmt.Sprintf("note-%d", note.ID), format)
+	respondWithExport(w, format, note.Title, filename, []render.Doc{exportDoc(note)}, true)
+})
+
+//NotebookExport downloads all notes of user as one file
+var NotebookExport = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	format, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+	user := &models.User{}
+	user.ID = GetUserID(r)
+	if err := models.GetDB().Take(user).Error; err != nil {
+		panic(err)
+	}
+
+	notes := []models.Note{}
+	err := models.GetDB().Scopes(OwnedBy(r)).Preload("Tags").Order("created_at, id").Find(&notes).Error
+	if err != nil {
+		panic(err)
+	}
+	docs := []render.Doc{}
+	for i := range notes {
+		docs = append(docs, exportDoc(&notes[i]))
+	}
+
+	title := "Notes of " + user.Username
+	filename := render.Filename(user.Username+" notes", "notes", format)
+	respondWithExport(w, format, title, filename, docs, true)
+})
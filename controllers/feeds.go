@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"notes/models"
+	"notes/render"
+	"notes/util"
+	"strings"
+	"time"
+
+	. "notes/config"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// feedSize is number of the newest notes in feed
+const feedSize = 20
+
+// publicURL of path on this site, ok is false if PUBLIC_URL isn't configured.
+// Host of request can't be used, it's set by client and cached feeds and sitemaps would link to any site
+func publicURL(path string) (url string, ok bool) {
+	if Cfg.PublicURL == "" {
+		return "", false
+	}
+	return strings.TrimRight(Cfg.PublicURL, "/") + path, true
+}
+
+// respondWithFeed of published notes of user(all users if userID is 0), full=true gives whole notes rendered from markdown.
+// Last-Modified is the latest change of notes including ones which left the feed, so it only moves forward
+// and unchanged feed is answered with 304. ETag is over body, it catches changes within the same second
+func respondWithFeed(w http.ResponseWriter, r *http.Request, title, link string, userID uint) {
+	base, ok := publicURL("")
+	if !ok {
+		util.RespondWithError(w, 404, "feeds are disabled, PUBLIC_URL is not configured")
+		return
+	}
+	format := mux.Vars(r)["format"]
+	notes := []models.Note{}
+	db := models.GetDB().Model(&models.Note{}).Scopes(Published)
+	if userID != 0 {
+		db = db.Where("notes.user_id = ?", userID)
+	}
+	err := db.Scopes(RecentlyPublishedFirst).
+		Preload("Tags").Preload("Author", func(db *gorm.DB) *gorm.DB {
+		return db.Select(publicUserFields.columns(publicUserFields.all()))
+	}).Limit(feedSize).Find(&notes).Error
+	if err != nil {
+		panic(err)
+	}
+
+	feed := &render.Feed{Title: title, Link: base + link, Self: base + r.URL.Path}
+	modified := models.FeedModifiedAt(userID, time.Now())
+	full := r.URL.Query().Get("full") == "true"
+	if full {
+		feed.Self += "?full=true"
+	}
+	for i := range notes {
+		n := &notes[i]
+		entry := render.Entry{
+			Title:     n.Title,
+			Link:      fmt.Sprintf("%s/api/notes/%d", base, n.ID),
+			Published: n.CreatedAt,
+			Updated:   n.LastModified(),
+			Tags:      tagNamesOf(n),
+			Content:   n.Body,
+			Full:      full,
+		}
+		if n.PublishedAt != nil {
+			entry.Published = *n.PublishedAt
+		}
+		if n.Author != nil {
+			entry.Author = n.Author.DisplayName
+			if entry.Author == "" {
+				entry.Author = n.Author.Username
+			}
+		}
+		if entry.Updated.After(feed.Updated) {
+			feed.Updated = entry.Updated
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	var body []byte
+	if format == render.FeedRSS {
+		body = render.RSS(feed)
+	} else {
+		body = render.Atom(feed)
+	}
+	if feed.Updated.After(modified) {
+		modified = feed.Updated
+	}
+	w.Header().Set("Content-Type", render.FeedContentType(format))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256(body)))
+	// ServeContent answers If-None-Match and If-Modified-Since, feed without notes ever has no Last-Modified
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+// NotesFeed is Atom(or RSS) feed of published notes
+func NotesFeed(w http.ResponseWriter, r *http.Request) {
+	respondWithFeed(w, r, "Published notes", "/api/notes", 0)
+}
+
+// UserNotesFeed is Atom(or RSS) feed of published notes of user
+func UserNotesFeed(w http.ResponseWriter, r *http.Request) {
+	user := &models.User{}
+	fmt.Sscan(mux.Vars(r)["user_id"], &user.ID)
+	if err := user.Get(); err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such user")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	name := user.DisplayName
+	if name == "" {
+		name = user.Username
+	}
+	respondWithFeed(w, r, "Notes of "+name, fmt.Sprintf("/api/users/%d/notes", user.ID), user.ID)
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"notes/models"
+	"notes/util"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// fieldSet is whitelist of fields of view: json name to column(computed fields have no column)
+type fieldSet map[string]string
+
+// with other fields, sets aren't changed
+func (s fieldSet) with(other fieldSet) fieldSet {
+	all := fieldSet{}
+	for _, set := range []fieldSet{s, other} {
+		for name, column := range set {
+			all[name] = column
+		}
+	}
+	return all
+}
+
+// all fields except some(sorted)
+func (s fieldSet) all(except ...string) []string {
+	fields := []string{}
+	for name := range s {
+		if !contains(except, name) {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// columns of fields for Select, required columns go first
+func (s fieldSet) columns(fields []string, required ...string) []string {
+	columns := append([]string{}, required...)
+	for _, name := range fields {
+		if column := s[name]; column != "" && !contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+var (
+	publicNoteFields = fieldSet{
+		"id":                "notes.id",
+		"created_at":        "notes.created_at",
+		"updated_at":        "notes.updated_at",
+		"title":             "notes.title",
+		"body":              "notes.body",
+		"user_id":           "notes.user_id",
+		"published":         "notes.published",
+		"published_at":      "notes.published_at",
+		"forked_from":       "notes.forked_from_id",
+		"forks_count":       "notes.forks_count",
+		"comments_disabled": "notes.comments_disabled",
+		"likes_count":       "notes.likes_count",
+	}
+	ownNoteFields = publicNoteFields.with(fieldSet{
+		"visibility":   "notes.visibility",
+		"pinned":       "notes.pinned",
+		"archived":     "notes.archived",
+		"starred":      "notes.starred",
+		"publish_at":   "notes.publish_at",
+		"unpublish_at": "notes.unpublish_at",
+	})
+	publicUserFields = fieldSet{
+		"id":           "users.id",
+		"created_at":   "users.created_at",
+		"username":     "users.username",
+		"display_name": "users.display_name",
+		"bio":          "users.bio",
+		"website":      "users.website",
+		"avatar_id":    "users.avatar_id",
+	}
+	ownUserFields = publicUserFields.with(fieldSet{"updated_at": "users.updated_at", "email": "users.email"})
+
+	// lists have computed fields
+	ownListFields       = ownNoteFields.with(fieldSet{"completion": ""})
+	publishedListFields = publicNoteFields.with(fieldSet{"comments_count": ""})
+	sharedListFields    = ownNoteFields.with(fieldSet{"completion": "", "permission": ""})
+
+	// relations which notes can include
+	noteIncludes = []string{"author", "tags"}
+)
+
+// sparseQuery is fields(and relations to include) requested by fields and include parameters
+type sparseQuery struct {
+	Fields   []string
+	Includes map[string]bool
+}
+
+// parseSparse query, defaults are used without parameters, no_body=true just removes body from them.
+// Fields and includes are checked against whitelists, id is always in response
+func parseSparse(r *http.Request, set fieldSet, defaults []string, allowed []string, defaultIncludes ...string) (*sparseQuery, error) {
+	q := &sparseQuery{Fields: []string{"id"}, Includes: map[string]bool{}}
+	query := r.URL.Query()
+
+	fields := defaults
+	if query.Get("fields") != "" {
+		fields = strings.Split(query.Get("fields"), ",")
+	} else if query.Get("no_body") == "true" {
+		fields = remove(defaults, "body")
+	}
+	for _, name := range fields {
+		name = strings.TrimSpace(name)
+		if _, ok := set[name]; !ok {
+			return nil, models.ErrValidation(fmt.Sprintf("unknown field %q", name))
+		}
+		if !contains(q.Fields, name) {
+			q.Fields = append(q.Fields, name)
+		}
+	}
+
+	includes := defaultIncludes
+	if _, ok := query["include"]; ok {
+		includes = []string{}
+		if query.Get("include") != "" {
+			includes = strings.Split(query.Get("include"), ",")
+		}
+	}
+	for _, name := range includes {
+		name = strings.TrimSpace(name)
+		if !contains(allowed, name) {
+			return nil, models.ErrValidation(fmt.Sprintf("unknown include %q", name))
+		}
+		q.Includes[name] = true
+	}
+	return q, nil
+}
+
+// sparseOrRespond is parseSparse which responds with 400 to invalid query
+func sparseOrRespond(w http.ResponseWriter, r *http.Request, set fieldSet, defaults []string, allowed []string,
+	defaultIncludes ...string) (*sparseQuery, bool) {
+	q, err := parseSparse(r, set, defaults, allowed, defaultIncludes...)
+	if err != nil {
+		util.RespondWithError(w, 400, err.Error())
+		return nil, false
+	}
+	return q, true
+}
+
+// has field
+func (q *sparseQuery) has(field string) bool {
+	return contains(q.Fields, field)
+}
+
+// noteScope selects requested columns of notes and preloads included relations
+func (q *sparseQuery) noteScope(set fieldSet) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Select(set.columns(q.Fields, "notes.id", "notes.user_id"))
+		if q.Includes["tags"] {
+			db = db.Preload("Tags")
+		}
+		if q.Includes["author"] {
+			db = db.Preload("Author", func(db *gorm.DB) *gorm.DB {
+				return db.Select(publicUserFields.columns(publicUserFields.all()))
+			})
+		}
+		return db
+	}
+}
+
+// loadIncludes of already loaded notes
+func (q *sparseQuery) loadIncludes(notes ...*models.Note) error {
+	for _, note := range notes {
+		if q.Includes["tags"] && note.Tags == nil {
+			if err := note.LoadTags(); err != nil {
+				return err
+			}
+		}
+		if q.Includes["author"] && note.Author == nil {
+			author := &models.User{}
+			err := models.GetDB().Select(publicUserFields.columns(publicUserFields.all())).Take(author, note.UserID).Error
+			if err != nil {
+				return err
+			}
+			note.Author = author
+		}
+	}
+	return nil
+}
+
+// note view with requested fields and relations, own is owner view
+func (q *sparseQuery) note(n *models.Note, own bool) map[string]interface{} {
+	var view map[string]interface{}
+	if own {
+		view = q.pick(ownNote(n))
+	} else {
+		view = q.pick(publicNote(n))
+	}
+	if q.Includes["tags"] {
+		tags := n.Tags
+		if tags == nil {
+			tags = []models.Tag{}
+		}
+		view["tags"] = tags
+	}
+	if q.Includes["author"] && n.Author != nil {
+		view["author"] = publicUser(n.Author)
+	}
+	return view
+}
+
+// notes views
+func (q *sparseQuery) notes(notes []models.Note, own bool) []map[string]interface{} {
+	views := make([]map[string]interface{}, len(notes))
+	for i := range notes {
+		views[i] = q.note(&notes[i], own)
+	}
+	return views
+}
+
+// noteIDs of loaded notes, computed fields are fetched by them
+func noteIDs(notes []models.Note) []uint {
+	ids := make([]uint, len(notes))
+	for i := range notes {
+		ids[i] = notes[i].ID
+	}
+	return ids
+}
+
+// user view with requested fields, own is view for user themselves
+func (q *sparseQuery) user(u *models.User, own bool) map[string]interface{} {
+	if own {
+		return q.pick(ownUser(u))
+	}
+	return q.pick(publicUser(u))
+}
+
+// pick requested fields of view
+func (q *sparseQuery) pick(view fielder) map[string]interface{} {
+	picked := map[string]interface{}{}
+	for _, name := range q.Fields {
+		if v, ok := view.field(name); ok {
+			picked[name] = v
+		}
+	}
+	return picked
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []string, s string) []string {
+	rest := []string{}
+	for _, item := range list {
+		if item != s {
+			rest = append(rest, item)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func followHandler(follow bool) http.HandlerFunc {
+	return auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		f := &models.Follow{FollowerID: GetUserID(r)}
+		fmt.Sscan(mux.Vars(r)["user_id"], &f.FolloweeID)
+
+		var err error
+		if follow {
+			err = f.Create()
+		} else {
+			err = f.Remove()
+		}
+		if err == gorm.ErrRecordNotFound && follow {
+			util.RespondWithError(w, 404, "no such user")
+		} else if err == gorm.ErrRecordNotFound {
+			util.RespondWithError(w, 404, "user is not followed")
+		} else if models.IsErrValidation(err) {
+			util.RespondWithError(w, 422, err.Error())
+		} else if err != nil {
+			panic(err)
+		} else {
+			util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+		}
+	})
+}
+
+//FollowUser by current user
+var FollowUser = followHandler(true)
+
+//UnfollowUser ...
+var UnfollowUser = followHandler(false)
+
+// follows lists users on the other side of user's follows(newest first)
+func follows(followers bool) http.HandlerFunc {
+	column, other := "followee_id", "follower_id"
+	if !followers {
+		column, other = other, column
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, ok := sparseOrRespond(w, r, publicUserFields, publicUserFields.all(), nil)
+		if !ok {
+			return
+		}
+		user := &models.User{}
+		fmt.Sscan(mux.Vars(r)["user_id"], &user.ID)
+		err := user.Get()
+		if err == gorm.ErrRecordNotFound {
+			util.RespondWithError(w, 404, "no such user")
+			return
+		} else if err != nil {
+			panic(err)
+		}
+
+		scope := func(db *gorm.DB) *gorm.DB {
+			return db.Where("follows."+column+" = ?", user.ID)
+		}
+		users := []models.User{}
+		err = models.GetDB().Model(&models.Follow{}).Scopes(scope, Paginate(r)).
+			Select(publicUserFields.columns(q.Fields, "users.id")).
+			Joins("JOIN users ON users.id = follows." + other).
+			Order("follows.created_at DESC").Find(&users).Error
+		if err != nil {
+			panic(err)
+		}
+
+		views := make([]map[string]interface{}, len(users))
+		for i := range users {
+			views[i] = q.user(&users[i], false)
+		}
+		resp := util.ResponseBaseOK()
+		resp["users"] = views
+		resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Follow{}).Scopes(scope))
+		util.RespondWithJSON(w, 200, resp)
+	}
+}
+
+//FollowersList of user
+var FollowersList = follows(true)
+
+//FollowingList is authors followed by user
+var FollowingList = follows(false)
+
+// FollowedBy user from request(authors of notes are followed)
+func FollowedBy(req *http.Request) func(db *gorm.DB) *gorm.DB {
+	userID := GetUserID(req)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("notes.user_id IN (?)", models.GetDB().Model(&models.Follow{}).
+			Select("followee_id").Where("follower_id = ?", userID))
+	}
+}
+
+//Feed of published notes of followed authors, same as published notes list
+var Feed = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	respondWithPublished(w, r, Published, FollowedBy(r))
+})
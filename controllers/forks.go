@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+//ForkNote makes private copy of published note for current user
+var ForkNote = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+
+	fork, err := note.Fork(GetUserID(r))
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["note"] = ownNote(fork)
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//NoteForks lists forks of note for its owner(newest first)
+var NoteForks = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note := &models.Note{UserID: GetUserID(r)}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+
+	err := note.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	notes := []models.Note{}
+	err = models.GetDB().Scopes(models.ForksOf(note.ID), Paginate(r)).Order("id DESC").Find(&notes).Error
+	if err != nil {
+		panic(err)
+	}
+	forks, err := models.Forks(notes)
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["forks"] = forks
+	resp["forks_count"] = note.ForksCount
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Note{}).Scopes(models.ForksOf(note.ID)))
+	util.RespondWithJSON(w, 200, resp)
+})
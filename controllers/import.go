@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"notes/auth"
+	"notes/importer"
+	"notes/models"
+	"notes/util"
+	"path"
+	"strings"
+
+	. "notes/config"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var importFormatByType = map[string]string{
+	"application/zip":              importer.FormatMarkdown,
+	"application/x-zip-compressed": importer.FormatMarkdown,
+	"application/json":             importer.FormatJSON,
+	"application/xml":              importer.FormatENEX,
+	"text/xml":                     importer.FormatENEX,
+	"application/enex+xml":         importer.FormatENEX,
+}
+
+var importFormatByExt = map[string]string{
+	".zip":  importer.FormatMarkdown,
+	".json": importer.FormatJSON,
+	".enex": importer.FormatENEX,
+	".xml":  importer.FormatENEX,
+}
+
+// importData reads uploaded file(raw body or "file" field of multipart form) and detects its format
+func importData(r *http.Request) (data []byte, format string, err error) {
+	format = r.URL.Query().Get("format")
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var src io.Reader = r.Body
+	if mediaType == "multipart/form-data" {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", fmt.Errorf("file field is required")
+		}
+		defer file.Close()
+		src = file
+		if format == "" {
+			format = importFormatByExt[strings.ToLower(path.Ext(header.Filename))]
+			mediaType = header.Header.Get("Content-Type")
+		}
+	}
+	if format == "" {
+		format = importFormatByType[mediaType]
+	}
+	if format == "" {
+		return nil, "", fmt.Errorf("unknown format, specify format parameter(markdown, json or enex)")
+	}
+
+	data, err = ioutil.ReadAll(src)
+	if err != nil {
+		return nil, "", fmt.Errorf("file is too big or broken")
+	}
+	return data, format, nil
+}
+
+//ImportNotes starts asynchronous import job
+var ImportNotes = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, Cfg.ImportMaxSize)
+	defer r.Body.Close()
+
+	data, format, err := importData(r)
+	if err != nil {
+		util.RespondWithError(w, 400, err.Error())
+		return
+	}
+	if !importer.Known(format) {
+		util.RespondWithError(w, 400, "unknown format "+format)
+		return
+	}
+
+	job := &models.ImportJob{UserID: GetUserID(r), Format: format}
+	job.Create()
+	running := *job
+	go importer.Run(&running, data)
+
+	resp := util.ResponseBaseOK()
+	resp["job"] = job
+	util.RespondWithJSON(w, 202, resp)
+})
+
+//ImportJobDetail shows progress and errors of import
+var ImportJobDetail = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	job := &models.ImportJob{UserID: GetUserID(r)}
+	fmt.Sscan(mux.Vars(r)["job_id"], &job.ID)
+
+	err := job.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such import job")
+	} else if err != nil {
+		panic(err)
+	} else {
+		resp := util.ResponseBaseOK()
+		resp["job"] = job
+		util.RespondWithJSON(w, 200, resp)
+	}
+})
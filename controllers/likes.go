@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func likeHandler(like bool) http.HandlerFunc {
+	return auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		note := &models.Note{}
+		fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+
+		var err error
+		if like {
+			err = note.Like(GetUserID(r))
+		} else {
+			err = note.Unlike(GetUserID(r))
+		}
+		if err == gorm.ErrRecordNotFound {
+			util.RespondWithError(w, 404, "no such note")
+			return
+		} else if err != nil {
+			panic(err)
+		}
+
+		resp := util.ResponseBaseOK()
+		resp["liked"] = like
+		resp["likes_count"] = note.LikesCount
+		util.RespondWithJSON(w, 200, resp)
+	})
+}
+
+//LikeNote published note(repeated like changes nothing)
+var LikeNote = likeHandler(true)
+
+//UnlikeNote ...
+var UnlikeNote = likeHandler(false)
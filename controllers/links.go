@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+)
+
+//NoteBacklinks are notes linking to note(only ones readable by user)
+var NoteBacklinks = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	q, ok := sparseOrRespond(w, r, publicNoteFields, publicNoteFields.all("body"), noteIncludes)
+	if !ok {
+		return
+	}
+	note, ok := accessibleNote(w, r, models.PermissionRead)
+	if !ok {
+		return
+	}
+
+	notes, err := note.Backlinks(GetUserID(r))
+	if err != nil {
+		panic(err)
+	}
+	for i := range notes {
+		if err := q.loadIncludes(&notes[i]); err != nil {
+			panic(err)
+		}
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["notes"] = q.notes(notes, false)
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//NoteOutlinks are links of note, links to missing or not readable notes are broken
+var NoteOutlinks = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note, ok := accessibleNote(w, r, models.PermissionRead)
+	if !ok {
+		return
+	}
+
+	links, err := note.Outlinks(GetUserID(r))
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["links"] = links
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//BrokenLinksList of user's notes
+var BrokenLinksList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r)
+	notes := []models.Note{}
+	err := models.GetDB().Select("id, title").Scopes(models.WithBrokenLinks(userID), Paginate(r)).Order("id").Find(&notes).Error
+	if err != nil {
+		panic(err)
+	}
+	broken, err := models.FindBrokenLinks(userID, notes)
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["notes"] = broken
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Note{}).Scopes(models.WithBrokenLinks(userID)))
+	util.RespondWithJSON(w, 200, resp)
+})
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"notes/auth"
+	"notes/live"
+	"notes/models"
+	"notes/util"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// auth is done by token, not cookies, so cross-origin connections are safe
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(*http.Request) bool { return true },
+	// token is sent as second protocol, handshake is answered with first one
+	Subprotocols: []string{"access_token"},
+}
+
+//LiveNote is websocket for collaborative editing of note
+var LiveNote = auth.RequireAuthProtocol(func(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r)
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+
+	canWrite := true
+	err := note.GetAccessible(userID, models.PermissionWrite)
+	if err == models.ErrForbidden {
+		canWrite = false // read-only collaborators can watch
+	} else if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	user := &models.User{}
+	user.ID = userID
+	if err := user.Get(); err != nil {
+		panic("user should always be valid because of authorization")
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader already responded with error
+		log.Printf("when upgrading to websocket: %v", err)
+		return
+	}
+	live.Serve(conn, note, live.Presence{UserID: user.ID, Username: user.Username}, canWrite)
+})
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/reminders"
+	"notes/util"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type reminderRequest struct {
+	RemindAt string `json:"remind_at"`
+	TimeZone string `json:"time_zone"`
+	RRule    string `json:"rrule"`
+	Email    bool   `json:"email"`
+}
+
+//CreateReminder about note for current user(note should be accessible)
+var CreateReminder = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	req := &reminderRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	note, ok := accessibleNote(w, r, models.PermissionRead)
+	if !ok {
+		return
+	}
+
+	reminder := &models.Reminder{NoteID: note.ID, UserID: GetUserID(r), TimeZone: req.TimeZone, RRule: req.RRule, Email: req.Email}
+	err := reminder.ParseRemindAt(req.RemindAt)
+	if err == nil {
+		err = reminder.Create()
+	}
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	reminders.WakeUp()
+
+	resp := util.ResponseBaseOK()
+	resp["reminder"] = reminder
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//RemindersList of user for note
+var RemindersList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note, ok := accessibleNote(w, r, models.PermissionRead)
+	if !ok {
+		return
+	}
+
+	list := []models.Reminder{}
+	err := models.GetDB().Where("note_id = ? AND user_id = ?", note.ID, GetUserID(r)).Order("id").Find(&list).Error
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["reminders"] = list
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//ReminderRemove ...
+var ReminderRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	reminder := &models.Reminder{UserID: GetUserID(r)}
+	fmt.Sscan(mux.Vars(r)["note_id"], &reminder.NoteID)
+	fmt.Sscan(mux.Vars(r)["reminder_id"], &reminder.ID)
+
+	err := reminder.Remove()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such reminder")
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+// upcomingReminders of user
+func upcomingReminders(req *http.Request) func(db *gorm.DB) *gorm.DB {
+	userID := GetUserID(req)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ? AND next_at IS NOT NULL", userID)
+	}
+}
+
+//UpcomingReminders of user, nearest first
+var UpcomingReminders = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	list := []models.Reminder{}
+	err := models.GetDB().Scopes(upcomingReminders(r), Paginate(r)).Order("next_at").Find(&list).Error
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["reminders"] = list
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Reminder{}).Scopes(upcomingReminders(r)))
+	util.RespondWithJSON(w, 200, resp)
+})
@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 	"notes/models"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -11,7 +12,7 @@ import (
 
 // Published ...
 func Published(db *gorm.DB) *gorm.DB {
-	return db.Where("published")
+	return models.LiveAt(time.Now())(db)
 }
 
 // OwnedBy user from request
@@ -27,7 +28,63 @@ func Notes(db *gorm.DB) *gorm.DB { // not working (why??)
 	return db.Model(&models.Note{})
 }
 
+// SharedWith user from request (joins note_shares)
+func SharedWith(req *http.Request) func(db *gorm.DB) *gorm.DB {
+	userID := GetUserID(req)
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Joins("JOIN note_shares ON note_shares.note_id = notes.id").
+			Where("note_shares.user_id = ?", userID)
+	}
+}
+
 // NewFirst (by update)
 func NewFirst(db *gorm.DB) *gorm.DB {
-	return db.Order("created_at DESC")
+	return db.Order("notes.created_at DESC").Order("notes.id DESC")
+}
+
+// RecentlyPublishedFirst (by moment note went live)
+func RecentlyPublishedFirst(db *gorm.DB) *gorm.DB {
+	return db.Order("notes.published_at DESC").Order("notes.id DESC")
+}
+
+// published notes orderings by sort parameter
+var publishedOrders = map[string]func(db *gorm.DB) *gorm.DB{
+	"":    RecentlyPublishedFirst,
+	"new": RecentlyPublishedFirst,
+	"popular": func(db *gorm.DB) *gorm.DB {
+		return db.Order("notes.likes_count DESC").Order("notes.id DESC")
+	},
+	"trending": func(db *gorm.DB) *gorm.DB {
+		return db.Order("notes.trending_score DESC").Order("notes.id DESC")
+	},
+}
+
+// PublishedOrder from sort parameter: new(default), popular(by likes) or trending(by recent likes)
+func PublishedOrder(req *http.Request) (func(db *gorm.DB) *gorm.DB, bool) {
+	order, ok := publishedOrders[req.URL.Query().Get("sort")]
+	return order, ok
+}
+
+// PinnedFirst should go before other orderings, so pages stay consistent
+func PinnedFirst(db *gorm.DB) *gorm.DB {
+	return db.Order("notes.pinned DESC")
+}
+
+// Archived notes only with archived=true, hidden otherwise
+func Archived(req *http.Request) func(db *gorm.DB) *gorm.DB {
+	archived := req.URL.Query().Get("archived") == "true"
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("notes.archived = ?", archived)
+	}
+}
+
+// Starred notes only with starred=true
+func Starred(req *http.Request) func(db *gorm.DB) *gorm.DB {
+	starred := req.URL.Query().Get("starred") == "true"
+	return func(db *gorm.DB) *gorm.DB {
+		if !starred {
+			return db
+		}
+		return db.Where("notes.starred")
+	}
 }
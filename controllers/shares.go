@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type shareLinkRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	ExpiresIn int        `json:"expires_in"` // seconds, alternative to expires_at
+	Password  string     `json:"password"`
+	MaxViews  int        `json:"max_views"`
+}
+
+func sharedURL(token string) string {
+	return "/api/shared/" + token
+}
+
+//CreateShareLink for user's note
+var CreateShareLink = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+	note.UserID = GetUserID(r)
+
+	req := &shareLinkRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	err := note.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	if note.Visibility == models.VisibilityPrivate {
+		util.RespondWithError(w, 422, "private note cannot be shared, make it unlisted or public")
+		return
+	}
+
+	link := &models.ShareLink{
+		NoteID:    note.ID,
+		ExpiresAt: req.ExpiresAt,
+		Password:  req.Password,
+		MaxViews:  req.MaxViews,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		link.ExpiresAt = &expiresAt
+	}
+
+	err = link.Create()
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["share"] = link
+	resp["url"] = sharedURL(link.Token)
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//ShareLinksList of user's note
+var ShareLinksList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+	note.UserID = GetUserID(r)
+
+	err := note.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	links := []models.ShareLink{}
+	if err := models.GetDB().Where("note_id = ?", note.ID).Order("created_at DESC").Find(&links).Error; err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["shares"] = links
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//ShareLinkRemove revokes share link
+var ShareLinkRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	note := &models.Note{}
+	fmt.Sscan(mux.Vars(r)["note_id"], &note.ID)
+	note.UserID = GetUserID(r)
+
+	err := note.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such note")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	link := &models.ShareLink{NoteID: note.ID}
+	fmt.Sscan(mux.Vars(r)["share_id"], &link.ID)
+
+	err = link.Remove()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such share link")
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+// SharedNoteDetail is available without authorization (password in X-Share-Password header only)
+func SharedNoteDetail(w http.ResponseWriter, r *http.Request) {
+	q, ok := sparseOrRespond(w, r, publicNoteFields, publicNoteFields.all(), noteIncludes, "tags")
+	if !ok {
+		return
+	}
+	link := &models.ShareLink{Token: mux.Vars(r)["token"]}
+	note, err := link.Open(r.Header.Get("X-Share-Password"))
+	if err == nil {
+		err = q.loadIncludes(note)
+	}
+	switch err {
+	case nil:
+		resp := util.ResponseBaseOK()
+		resp["note"] = q.note(note, false)
+		util.RespondWithJSON(w, 200, resp)
+	case gorm.ErrRecordNotFound:
+		util.RespondWithError(w, 404, "no such shared note")
+	case models.ErrShareExpired:
+		util.RespondWithError(w, 410, err.Error())
+	case models.ErrSharePassword:
+		util.RespondWithError(w, 403, err.Error())
+	default:
+		panic(err)
+	}
+}
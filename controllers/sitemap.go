@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+	"notes/sitemap"
+	"notes/util"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func respondWithXML(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write(body)
+}
+
+// Sitemap of published notes and their authors(or index of its parts if it's too big)
+func Sitemap(w http.ResponseWriter, r *http.Request) {
+	base, ok := publicURL("")
+	if !ok {
+		util.RespondWithError(w, 404, "sitemap is disabled, PUBLIC_URL is not configured")
+		return
+	}
+	body, err := sitemap.Index(base)
+	if err != nil {
+		panic(err)
+	}
+	respondWithXML(w, body)
+}
+
+// SitemapPart listed by sitemap index
+func SitemapPart(w http.ResponseWriter, r *http.Request) {
+	base, ok := publicURL("")
+	if !ok {
+		util.RespondWithError(w, 404, "sitemap is disabled, PUBLIC_URL is not configured")
+		return
+	}
+	body, ok, err := sitemap.Part(base, mux.Vars(r)["name"])
+	if err != nil {
+		panic(err)
+	}
+	if !ok {
+		NotFound(w, r)
+		return
+	}
+	respondWithXML(w, body)
+}
+
+// robotsRules let crawlers see only public content
+var robotsRules = []string{
+	"User-agent: *",
+	"Allow: /api/notes",
+	"Allow: /api/users",
+	"Allow: /feeds/",
+	"Disallow: /api/me",
+	"Disallow: /api/shared/",
+	"Disallow: /api/attachments/",
+}
+
+// Robots is robots.txt with link to sitemap(if it's enabled)
+func Robots(w http.ResponseWriter, r *http.Request) {
+	body := strings.Join(robotsRules, "\n") + "\n"
+	if sitemapURL, ok := publicURL("/sitemap.xml"); ok {
+		body += "\nSitemap: " + sitemapURL + "\n"
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write([]byte(body))
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+	"strconv"
+)
+
+// max changes examined by one sync request
+const syncLimit = 500
+
+type syncedNote struct {
+	*OwnNoteView
+	Seq uint64 `json:"seq"`
+}
+
+// syncResult shows note of result by view
+type syncResult struct {
+	*models.SyncResult
+	Note *OwnNoteView `json:"note,omitempty"`
+}
+
+type tombstone struct {
+	ID  uint   `json:"id"`
+	Seq uint64 `json:"seq"`
+}
+
+//SyncPull returns notes changed(and removed) after since token
+var SyncPull = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r)
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+			util.RespondWithError(w, 400, "invalid since token")
+			return
+		}
+	}
+
+	changes, token, more := models.LastChanges(userID, since, syncLimit)
+
+	ids := []uint{}
+	for _, c := range changes {
+		if !c.Deleted {
+			ids = append(ids, c.NoteID)
+		}
+	}
+	byID := map[uint]models.Note{}
+	if len(ids) > 0 {
+		notes := []models.Note{}
+		if err := models.GetDB().Where("id IN ? AND user_id = ?", ids, userID).Find(&notes).Error; err != nil {
+			panic(err)
+		}
+		for _, n := range notes {
+			byID[n.ID] = n
+		}
+	}
+
+	notes := []syncedNote{}
+	deleted := []tombstone{}
+	for _, c := range changes {
+		if note, ok := byID[c.NoteID]; ok && !c.Deleted {
+			notes = append(notes, syncedNote{ownNote(&note), c.Seq})
+		} else {
+			deleted = append(deleted, tombstone{c.NoteID, c.Seq})
+		}
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["notes"] = notes
+	resp["deleted"] = deleted
+	resp["token"] = strconv.FormatUint(token, 10)
+	resp["has_more"] = more
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//SyncPush applies local changes of client and reports conflicts per note
+var SyncPush = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserID(r)
+	req := &struct {
+		Changes []models.SyncChange `json:"changes"`
+	}{}
+
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+	if len(req.Changes) > syncLimit {
+		util.RespondWithError(w, 422, "too many changes in one request")
+		return
+	}
+
+	results := []syncResult{}
+	for i := range req.Changes {
+		result := syncResult{SyncResult: req.Changes[i].Apply(userID)}
+		if result.SyncResult.Note != nil {
+			result.Note = ownNote(result.SyncResult.Note)
+		}
+		results = append(results, result)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["results"] = results
+	util.RespondWithJSON(w, 200, resp)
+})
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+//TemplatesList of user
+var TemplatesList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	templates := []models.Template{}
+	if err := models.GetDB().Where("user_id = ?", GetUserID(r)).Order("name, id").Find(&templates).Error; err != nil {
+		panic(err)
+	}
+	resp := util.ResponseBaseOK()
+	resp["templates"] = templates
+	util.RespondWithJSON(w, 200, resp)
+})
+
+// PublicTemplates scope
+func PublicTemplates(db *gorm.DB) *gorm.DB {
+	return db.Where("public")
+}
+
+//PublicTemplatesList ...
+func PublicTemplatesList(w http.ResponseWriter, r *http.Request) {
+	templates := []models.Template{}
+	err := models.GetDB().Scopes(PublicTemplates, Paginate(r)).Order("id DESC").Find(&templates).Error
+	if err != nil {
+		panic(err)
+	}
+	resp := util.ResponseBaseOK()
+	resp["templates"] = templates
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.Template{}).Scopes(PublicTemplates))
+	util.RespondWithJSON(w, 200, resp)
+}
+
+// templateRequest is body of create, other fields are set by server
+type templateRequest struct {
+	Name   string `json:"name"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Public bool   `json:"public"`
+}
+
+//CreateTemplate for user
+var CreateTemplate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	body := &templateRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		util.RespondWithError(w, 400, "body cannot be used for create")
+		return
+	}
+
+	template := &models.Template{UserID: GetUserID(r), Name: body.Name, Title: body.Title, Body: body.Body, Public: body.Public}
+	err := template.Create()
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["template"] = template
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//TemplateDetails of own or public template with list of its variables
+var TemplateDetails = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	template := &models.Template{}
+	fmt.Sscan(mux.Vars(r)["template_id"], &template.ID)
+
+	err := template.GetUsable(GetUserID(r))
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such template")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["template"] = template
+	resp["variables"] = template.Variables()
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//TemplateUpdate ...
+var TemplateUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	template := &models.Template{}
+	fmt.Sscan(mux.Vars(r)["template_id"], &template.ID)
+	template.UserID = GetUserID(r)
+
+	patch := &models.TemplatePatch{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	err := template.Update(patch)
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such template")
+	} else if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+//TemplateRemove ...
+var TemplateRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	template := &models.Template{}
+	fmt.Sscan(mux.Vars(r)["template_id"], &template.ID)
+	template.UserID = GetUserID(r)
+
+	err := template.Remove()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such template")
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+// fromTemplate fills empty title and body of note with expanded template
+func fromTemplate(r *http.Request, note *models.Note, vars map[string]string, timeZone string) error {
+	template := &models.Template{}
+	if _, err := fmt.Sscan(r.URL.Query().Get("template_id"), &template.ID); err != nil {
+		return models.ErrValidation("Validation error. template_id should be a number")
+	}
+	if err := template.GetUsable(note.UserID); err != nil {
+		return err
+	}
+
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return models.ErrValidation("Validation error. Unknown time zone")
+	}
+	user := &models.User{}
+	user.ID = note.UserID
+	if err := user.Get(); err != nil {
+		return err
+	}
+	all := models.TemplateVars(user, time.Now().In(loc))
+	for name, value := range vars {
+		all[name] = value
+	}
+
+	title, body, err := template.Expand(all)
+	if err != nil {
+		return err
+	}
+	if note.Title == "" {
+		note.Title = title
+	}
+	if note.Body == "" {
+		note.Body = body
+	}
+	return nil
+}
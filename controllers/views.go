@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"notes/models"
+	"time"
+)
+
+// Responses never serialize models directly, views select fields explicitly,
+// so new(or secret) fields of models aren't leaked by accident
+
+//UserView is public view of user
+type UserView struct {
+	ID          uint      `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Website     string    `json:"website"`
+	AvatarID    *uint     `json:"avatar_id"`
+}
+
+//OwnUserView is view of user for themselves
+type OwnUserView struct {
+	UserView
+	UpdatedAt time.Time `json:"updated_at"`
+	Email     string    `json:"email"`
+}
+
+// fields of views by json name, sparse fieldsets pick requested ones
+var (
+	userViewFields = map[string]func(v *UserView) interface{}{
+		"id":           func(v *UserView) interface{} { return v.ID },
+		"created_at":   func(v *UserView) interface{} { return v.CreatedAt },
+		"username":     func(v *UserView) interface{} { return v.Username },
+		"display_name": func(v *UserView) interface{} { return v.DisplayName },
+		"bio":          func(v *UserView) interface{} { return v.Bio },
+		"website":      func(v *UserView) interface{} { return v.Website },
+		"avatar_id":    func(v *UserView) interface{} { return v.AvatarID },
+	}
+	ownUserViewFields = map[string]func(v *OwnUserView) interface{}{
+		"updated_at": func(v *OwnUserView) interface{} { return v.UpdatedAt },
+		"email":      func(v *OwnUserView) interface{} { return v.Email },
+	}
+	noteViewFields = map[string]func(v *NoteView) interface{}{
+		"id":                func(v *NoteView) interface{} { return v.ID },
+		"created_at":        func(v *NoteView) interface{} { return v.CreatedAt },
+		"updated_at":        func(v *NoteView) interface{} { return v.UpdatedAt },
+		"title":             func(v *NoteView) interface{} { return v.Title },
+		"body":              func(v *NoteView) interface{} { return v.Body },
+		"user_id":           func(v *NoteView) interface{} { return v.UserID },
+		"published":         func(v *NoteView) interface{} { return v.Published },
+		"published_at":      func(v *NoteView) interface{} { return v.PublishedAt },
+		"forked_from":       func(v *NoteView) interface{} { return v.ForkedFromID },
+		"forks_count":       func(v *NoteView) interface{} { return v.ForksCount },
+		"comments_disabled": func(v *NoteView) interface{} { return v.CommentsDisabled },
+		"likes_count":       func(v *NoteView) interface{} { return v.LikesCount },
+	}
+	ownNoteViewFields = map[string]func(v *OwnNoteView) interface{}{
+		"visibility":   func(v *OwnNoteView) interface{} { return v.Visibility },
+		"pinned":       func(v *OwnNoteView) interface{} { return v.Pinned },
+		"archived":     func(v *OwnNoteView) interface{} { return v.Archived },
+		"starred":      func(v *OwnNoteView) interface{} { return v.Starred },
+		"publish_at":   func(v *OwnNoteView) interface{} { return v.PublishAt },
+		"unpublish_at": func(v *OwnNoteView) interface{} { return v.UnpublishAt },
+	}
+)
+
+// fielder is view which fields can be taken by json name
+type fielder interface {
+	field(name string) (interface{}, bool)
+}
+
+func (v *UserView) field(name string) (interface{}, bool) {
+	if get, ok := userViewFields[name]; ok {
+		return get(v), true
+	}
+	return nil, false
+}
+
+func (v *OwnUserView) field(name string) (interface{}, bool) {
+	if get, ok := ownUserViewFields[name]; ok {
+		return get(v), true
+	}
+	return v.UserView.field(name)
+}
+
+func (v *NoteView) field(name string) (interface{}, bool) {
+	if get, ok := noteViewFields[name]; ok {
+		return get(v), true
+	}
+	return nil, false
+}
+
+func (v *OwnNoteView) field(name string) (interface{}, bool) {
+	if get, ok := ownNoteViewFields[name]; ok {
+		return get(v), true
+	}
+	return v.NoteView.field(name)
+}
+
+// publicUser view
+func publicUser(u *models.User) *UserView {
+	return &UserView{
+		ID:          u.ID,
+		CreatedAt:   u.CreatedAt,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		Website:     u.Website,
+		AvatarID:    u.AvatarID,
+	}
+}
+
+// ownUser view
+func ownUser(u *models.User) *OwnUserView {
+	return &OwnUserView{UserView: *publicUser(u), UpdatedAt: u.UpdatedAt, Email: u.Email}
+}
+
+//NoteView is public view of note(published, shared by link or linked)
+type NoteView struct {
+	ID               uint         `json:"id"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+	Title            string       `json:"title"`
+	Body             string       `json:"body"`
+	UserID           uint         `json:"user_id"`
+	Published        bool         `json:"published"`
+	PublishedAt      *time.Time   `json:"published_at"`
+	Tags             []models.Tag `json:"tags,omitempty"`
+	ForkedFromID     *uint        `json:"forked_from"`
+	ForksCount       int          `json:"forks_count"`
+	CommentsDisabled bool         `json:"comments_disabled"`
+	LikesCount       int          `json:"likes_count"`
+}
+
+//OwnNoteView is view of note for owner and collaborators
+type OwnNoteView struct {
+	NoteView
+	Visibility  models.Visibility `json:"visibility"`
+	Pinned      bool              `json:"pinned"`
+	Archived    bool              `json:"archived"`
+	Starred     bool              `json:"starred"`
+	PublishAt   *time.Time        `json:"publish_at"`
+	UnpublishAt *time.Time        `json:"unpublish_at"`
+}
+
+// publicNote view
+func publicNote(n *models.Note) *NoteView {
+	return &NoteView{
+		ID:               n.ID,
+		CreatedAt:        n.CreatedAt,
+		UpdatedAt:        n.UpdatedAt,
+		Title:            n.Title,
+		Body:             n.Body,
+		UserID:           n.UserID,
+		Published:        n.Published,
+		PublishedAt:      n.PublishedAt,
+		Tags:             n.Tags,
+		ForkedFromID:     n.ForkedFromID,
+		ForksCount:       n.ForksCount,
+		CommentsDisabled: n.CommentsDisabled,
+		LikesCount:       n.LikesCount,
+	}
+}
+
+// ownNote view
+func ownNote(n *models.Note) *OwnNoteView {
+	return &OwnNoteView{
+		NoteView:    *publicNote(n),
+		Visibility:  n.Visibility,
+		Pinned:      n.Pinned,
+		Archived:    n.Archived,
+		Starred:     n.Starred,
+		PublishAt:   n.PublishAt,
+		UnpublishAt: n.UnpublishAt,
+	}
+}
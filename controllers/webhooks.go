@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notes/auth"
+	"notes/models"
+	"notes/util"
+	"notes/webhooks"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+//WebhooksList of user
+var WebhooksList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	hooks := []models.Webhook{}
+	if err := models.GetDB().Where("user_id = ?", GetUserID(r)).Order("created_at").Find(&hooks).Error; err != nil {
+		panic(err)
+	}
+	resp := util.ResponseBaseOK()
+	resp["webhooks"] = hooks
+	util.RespondWithJSON(w, 200, resp)
+})
+
+// webhookWithSecret is shown only once, secret is not readable later
+type webhookWithSecret struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// webhookRequest is body of create, other fields are set by server
+type webhookRequest struct {
+	URL    string            `json:"url"`
+	Events models.StringList `json:"events"`
+	Secret string            `json:"secret"`
+}
+
+//CreateWebhook for user
+var CreateWebhook = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	body := &webhookRequest{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		util.RespondWithError(w, 400, "body cannot be used for create")
+		return
+	}
+
+	hook := &models.Webhook{UserID: GetUserID(r), URL: body.URL, Events: body.Events, Secret: body.Secret}
+	err := hook.Create()
+	if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["webhook"] = &webhookWithSecret{hook, hook.Secret}
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//WebhookUpdate ...
+var WebhookUpdate = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	hook := &models.Webhook{}
+	fmt.Sscan(mux.Vars(r)["webhook_id"], &hook.ID)
+	hook.UserID = GetUserID(r)
+
+	patch := &models.WebhookPatch{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		util.RespondWithError(w, 400, "invalid request")
+		return
+	}
+
+	err := hook.Update(patch)
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such webhook")
+	} else if models.IsErrValidation(err) {
+		util.RespondWithError(w, 422, err.Error())
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+//WebhookRemove ...
+var WebhookRemove = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	hook := &models.Webhook{}
+	fmt.Sscan(mux.Vars(r)["webhook_id"], &hook.ID)
+	hook.UserID = GetUserID(r)
+
+	err := hook.Remove()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such webhook")
+	} else if err != nil {
+		panic(err)
+	} else {
+		util.RespondWithJSON(w, 200, util.ResponseBaseOK())
+	}
+})
+
+//WebhookDeliveriesList shows attempts of delivering events
+var WebhookDeliveriesList = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	hook := &models.Webhook{}
+	fmt.Sscan(mux.Vars(r)["webhook_id"], &hook.ID)
+	hook.UserID = GetUserID(r)
+
+	err := hook.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such webhook")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	err = models.GetDB().Where("webhook_id = ?", hook.ID).Scopes(Paginate(r)).
+		Order("created_at DESC").Find(&deliveries).Error
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["deliveries"] = deliveries
+	resp["pagination"] = PaginationData(r, models.GetDB().Model(&models.WebhookDelivery{}).Where("webhook_id = ?", hook.ID))
+	util.RespondWithJSON(w, 200, resp)
+})
+
+//WebhookTest sends test event to webhook
+var WebhookTest = auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+	hook := &models.Webhook{}
+	fmt.Sscan(mux.Vars(r)["webhook_id"], &hook.ID)
+	hook.UserID = GetUserID(r)
+
+	err := hook.Get()
+	if err == gorm.ErrRecordNotFound {
+		util.RespondWithError(w, 404, "no such webhook")
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	delivery, err := webhooks.Enqueue(hook, &webhooks.Payload{
+		Event:  webhooks.TestEvent,
+		Time:   time.Now(),
+		UserID: hook.UserID,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	resp := util.ResponseBaseOK()
+	resp["delivery"] = delivery
+	util.RespondWithJSON(w, 200, resp)
+})
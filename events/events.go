@@ -0,0 +1,159 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// event types
+const (
+	NoteCreated     = "note.created"
+	NoteUpdated     = "note.updated"
+	NoteDeleted     = "note.deleted"
+	NotePublished   = "note.published"
+	NoteUnpublished = "note.unpublished"
+	ReminderDue     = "reminder.due"
+)
+
+// Types are all event types which can be published
+var Types = []string{NoteCreated, NoteUpdated, NoteDeleted, NotePublished, NoteUnpublished, ReminderDue}
+
+// Known checks that event type exists
+func Known(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event happened with user's object
+type Event struct {
+	ID     uint64    `json:"id"`
+	Type   string    `json:"type"`
+	UserID uint      `json:"user_id"`
+	NoteID uint      `json:"note_id,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// Subscription receives events of user(or all events when user is 0).
+// C is closed when subscriber is too slow, events can be got back by Since
+type Subscription struct {
+	C      chan Event
+	userID uint
+}
+
+func (s *Subscription) match(e Event) bool {
+	return s.userID == 0 || s.userID == e.UserID
+}
+
+// Hub is in-process pub/sub with bounded log of last events
+type Hub struct {
+	mu     sync.Mutex
+	lastID uint64
+	log    []Event // ring buffer
+	start  int
+	subs   map[*Subscription]bool
+}
+
+// NewHub which remembers logSize last events
+func NewHub(logSize int) *Hub {
+	return &Hub{log: make([]Event, 0, logSize), subs: map[*Subscription]bool{}}
+}
+
+// Publish event to subscribers, ID and Time are set by hub
+func (h *Hub) Publish(e Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e.ID = h.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if len(h.log) < cap(h.log) {
+		h.log = append(h.log, e)
+	} else if cap(h.log) > 0 {
+		h.log[h.start] = e
+		h.start = (h.start + 1) % cap(h.log)
+	}
+
+	for s := range h.subs {
+		if !s.match(e) {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+			delete(h.subs, s)
+			close(s.C)
+		}
+	}
+	return e
+}
+
+// Subscribe to events of user(0 for all)
+func (h *Hub) Subscribe(userID uint) *Subscription {
+	s, _, _ := h.SubscribeSince(userID, 0)
+	return s
+}
+
+// SubscribeSince subscribes and returns logged events of user after lastID atomically.
+// ok is false if some events after lastID are already dropped from log
+func (h *Hub) SubscribeSince(userID uint, lastID uint64) (sub *Subscription, missed []Event, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscription{C: make(chan Event, 64), userID: userID}
+	h.subs[sub] = true
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+	// lastID from the future means that hub was restarted
+	ok = lastID <= h.lastID && lastID+uint64(len(h.log)) >= h.lastID
+	for i := range h.log {
+		e := h.log[(h.start+i)%len(h.log)]
+		if e.ID > lastID && sub.match(e) {
+			missed = append(missed, e)
+		}
+	}
+	return sub, missed, ok
+}
+
+// Unsubscribe and close channel
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[s] {
+		delete(h.subs, s)
+		close(s.C)
+	}
+}
+
+// LogSize is size of default hub log
+const LogSize = 1000
+
+var hub = NewHub(LogSize)
+
+// Publish to default hub
+func Publish(e Event) Event {
+	return hub.Publish(e)
+}
+
+// Subscribe to default hub
+func Subscribe(userID uint) *Subscription {
+	return hub.Subscribe(userID)
+}
+
+// SubscribeSince to default hub
+func SubscribeSince(userID uint, lastID uint64) (*Subscription, []Event, bool) {
+	return hub.SubscribeSince(userID, lastID)
+}
+
+// Unsubscribe from default hub
+func Unsubscribe(s *Subscription) {
+	hub.Unsubscribe(s)
+}
@@ -6,8 +6,9 @@ require (
 	github.com/caarlos0/env v3.5.0+incompatible
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/stretchr/testify v1.7.0
-	github.com/urfave/negroni v1.0.0 // indirect
+	github.com/urfave/negroni v1.0.0
 	golang.org/x/crypto v0.0.0-20210314154223-e6e6c4f2bb5b
 	gorm.io/driver/mysql v1.0.5
 	gorm.io/driver/sqlite v1.1.4
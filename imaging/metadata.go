@@ -0,0 +1,341 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformed image can't be parsed
+var ErrMalformed = errors.New("malformed image")
+
+const (
+	markerSOI  = 0xd8
+	markerEOI  = 0xd9
+	markerSOS  = 0xda
+	markerAPP1 = 0xe1 // exif and xmp
+	markerAPPD = 0xed // photoshop iptc
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	pngHeader  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// HasMetadata tells that images of content type can carry metadata which StripMetadata removes
+func HasMetadata(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp", "image/gif":
+		return true
+	}
+	return false
+}
+
+// StripMetadata removes exif(with gps), xmp and other textual metadata of jpeg, png, webp and gif,
+// other formats are returned as is. Orientation of jpeg is kept, otherwise photos would be shown rotated
+func StripMetadata(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWEBP(data)
+	case "image/gif":
+		return stripGIF(data)
+	}
+	return data, nil
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, ErrMalformed
+	}
+	out := &bytes.Buffer{}
+	out.Write(data[:2])
+	orientation := 1
+	rest := &bytes.Buffer{}
+
+	i := 2
+	for {
+		if i+2 > len(data) || data[i] != 0xff {
+			return nil, ErrMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xff { // fill byte
+			i++
+			continue
+		}
+		if marker == markerSOS || marker == markerEOI {
+			rest.Write(data[i:])
+			break
+		}
+		if marker >= 0xd0 && marker <= 0xd7 || marker == 0x01 { // standalone markers
+			rest.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, ErrMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) || end < i+4 {
+			return nil, ErrMalformed
+		}
+		segment := data[i:end]
+		switch marker {
+		case markerAPP1:
+			if o := exifOrientation(segment[4:]); o != 0 {
+				orientation = o
+			}
+		case markerAPPD: // dropped
+		default:
+			rest.Write(segment)
+		}
+		i = end
+	}
+
+	if orientation != 1 {
+		out.Write(orientationSegment(orientation))
+	}
+	out.Write(rest.Bytes())
+	return out.Bytes(), nil
+}
+
+// Orientation of jpeg from exif, 1 if unknown
+func Orientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return 1
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		if marker == markerSOS || marker == markerEOI {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			break
+		}
+		if marker == markerAPP1 {
+			if o := exifOrientation(data[i+4 : end]); o != 0 {
+				return o
+			}
+		}
+		i = end
+	}
+	return 1
+}
+
+// exifOrientation finds orientation tag in first ifd of exif payload, 0 if there is no one
+func exifOrientation(payload []byte) int {
+	if !bytes.HasPrefix(payload, exifHeader) {
+		return 0
+	}
+	tiff := payload[len(exifHeader):]
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < count; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// orientationSegment is minimal exif app1 segment with only orientation tag
+func orientationSegment(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // header, first ifd at 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, // orientation, short, count 1
+		0, 0, 0, 0, // no next ifd
+	}
+	payload := append(append([]byte{}, exifHeader...), tiff...)
+	segment := []byte{0xff, markerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// png chunks with metadata
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngHeader) {
+		return nil, ErrMalformed
+	}
+	out := &bytes.Buffer{}
+	out.Write(pngHeader)
+	for i := len(pngHeader); i < len(data); {
+		if i+12 > len(data) {
+			return nil, ErrMalformed
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:i+4]))
+		if end > len(data) || end < i+12 {
+			return nil, ErrMalformed
+		}
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+// flags of webp VP8X chunk telling that metadata chunks are present
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWEBP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+	size := 8 + int64(binary.LittleEndian.Uint32(data[4:8]))
+	if size < 12 {
+		return nil, ErrMalformed
+	} else if size < int64(len(data)) {
+		data = data[:size] // trailing garbage isn't part of image
+	}
+	out := &bytes.Buffer{}
+	out.Write(data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size + size%2 // chunks are padded to even size
+		if end == len(data)+1 {
+			end-- // padding of last chunk can be missing
+		}
+		if end > len(data) || end < i+8 {
+			return nil, ErrMalformed
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[i:end]...)
+			if size > 0 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:8], uint32(len(stripped)-8))
+	return stripped, nil
+}
+
+// gif blocks
+const (
+	gifExtension   = 0x21
+	gifImage       = 0x2c
+	gifTrailer     = 0x3b
+	gifComment     = 0xfe
+	gifApplication = 0xff
+)
+
+// stripGIF drops comments and application extensions(xmp and others) except animation looping ones
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || string(data[:3]) != "GIF" {
+		return nil, ErrMalformed
+	}
+	i := 13
+	if data[10]&0x80 != 0 { // global color table
+		i += 3 << (data[10]&7 + 1)
+	}
+	if i > len(data) {
+		return nil, ErrMalformed
+	}
+	out := &bytes.Buffer{}
+	out.Write(data[:i])
+	for {
+		if i >= len(data) {
+			return nil, ErrMalformed
+		}
+		switch data[i] {
+		case gifTrailer:
+			out.WriteByte(gifTrailer)
+			return out.Bytes(), nil
+		case gifExtension:
+			if i+2 > len(data) {
+				return nil, ErrMalformed
+			}
+			end, err := gifSubBlocks(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+			label := data[i+1]
+			if label != gifComment && (label != gifApplication || gifLooping(data[i+2:end])) {
+				out.Write(data[i:end])
+			}
+			i = end
+		case gifImage:
+			if i+10 > len(data) {
+				return nil, ErrMalformed
+			}
+			start, flags := i, data[i+9]
+			i += 10
+			if flags&0x80 != 0 { // local color table
+				i += 3 << (flags&7 + 1)
+			}
+			end, err := gifSubBlocks(data, i+1) // after lzw code size
+			if err != nil {
+				return nil, err
+			}
+			out.Write(data[start:end])
+			i = end
+		default:
+			return nil, ErrMalformed
+		}
+	}
+}
+
+// gifSubBlocks finds end of data sub-blocks starting at i
+func gifSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, ErrMalformed
+		}
+		size := int(data[i])
+		i += 1 + size
+		if size == 0 {
+			return i, nil
+		}
+	}
+}
+
+// gifLooping tells that application extension is animation loop count
+func gifLooping(blocks []byte) bool {
+	if len(blocks) < 12 || blocks[0] != 11 {
+		return false
+	}
+	id := string(blocks[1:12])
+	return id == "NETSCAPE2.0" || id == "ANIMEXTS1.0"
+}
@@ -0,0 +1,119 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Fit scales image down(never up) so that its longest side is at most maxSide.
+// Pixels are averaged over covered source area, which gives smooth thumbnails without extra dependencies
+func Fit(src image.Image, maxSide int) *image.RGBA {
+	rgba := toRGBA(src)
+	w, h := rgba.Rect.Dx(), rgba.Rect.Dy()
+	if w <= maxSide && h <= maxSide {
+		return rgba
+	}
+	dw, dh := maxSide, h*maxSide/w
+	if h > w {
+		dw, dh = w*maxSide/h, maxSide
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	return resize(rgba, dw, dh)
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, src, b.Min, draw.Src)
+	return rgba
+}
+
+// resize with box filter, colors are premultiplied so averaging transparent pixels is correct
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	sums := make([]uint64, dw*4)
+	counts := make([]uint64, dw)
+
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for i := range sums {
+			sums[i] = 0
+		}
+		for i := range counts {
+			counts[i] = 0
+		}
+		for y := y0; y < y1; y++ {
+			row := src.Pix[y*src.Stride:]
+			for dx := 0; dx < dw; dx++ {
+				x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+				if x1 == x0 {
+					x1 = x0 + 1
+				}
+				s := sums[dx*4 : dx*4+4]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					s[0] += uint64(p[0])
+					s[1] += uint64(p[1])
+					s[2] += uint64(p[2])
+					s[3] += uint64(p[3])
+				}
+				counts[dx] += uint64(x1 - x0)
+			}
+		}
+		out := dst.Pix[dy*dst.Stride:]
+		for dx := 0; dx < dw; dx++ {
+			for c := 0; c < 4; c++ {
+				out[dx*4+c] = uint8(sums[dx*4+c] / counts[dx])
+			}
+		}
+	}
+	return dst
+}
+
+// Orient rotates and flips image according to exif orientation(1-8)
+func Orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // 90 degree rotations swap sides
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var nx, ny int
+			switch orientation {
+			case 2: // mirrored horizontally
+				nx, ny = w-1-x, y
+			case 3: // rotated 180
+				nx, ny = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				nx, ny = x, h-1-y
+			case 5: // transposed
+				nx, ny = y, x
+			case 6: // rotated 90 clockwise
+				nx, ny = h-1-y, x
+			case 7: // transversed
+				nx, ny = h-1-y, w-1-x
+			case 8: // rotated 90 counterclockwise
+				nx, ny = y, w-1-x
+			}
+			copy(dst.Pix[ny*dst.Stride+nx*4:ny*dst.Stride+nx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
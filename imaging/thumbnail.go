@@ -0,0 +1,72 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// MaxPixels of decoded image, bigger images are rejected to keep memory bounded
+const MaxPixels = 50000000
+
+// ErrTooBig image
+var ErrTooBig = errors.New("image is too big")
+
+// Supported content types of images which can have thumbnails
+func Supported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// ThumbnailType is content type of thumbnails made of image with contentType
+func ThumbnailType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png" // keeps transparency
+}
+
+// Thumbnail of image which fits into maxSide, respects exif orientation
+func Thumbnail(data []byte, contentType string, maxSide int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooBig
+	}
+
+	var img image.Image
+	switch contentType {
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	default:
+		return nil, image.ErrFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	thumb := Fit(img, maxSide)
+	if contentType == "image/jpeg" {
+		thumb = Orient(thumb, Orientation(data))
+	}
+
+	out := &bytes.Buffer{}
+	if ThumbnailType(contentType) == "image/jpeg" {
+		err = jpeg.Encode(out, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(out, thumb)
+	}
+	return out.Bytes(), err
+}
@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"notes/models"
+	"regexp"
+	"strings"
+
+	. "notes/config"
+)
+
+type enexExport struct {
+	Notes []struct {
+		Title   string   `xml:"title"`
+		Content string   `xml:"content"`
+		Tags    []string `xml:"tag"`
+	} `xml:"note"`
+}
+
+func parseENEX(data []byte) ([]Item, models.ImportErrors, error) {
+	export := &enexExport{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	if err := decoder.Decode(export); err != nil {
+		return nil, nil, fmt.Errorf("invalid enex: %v", err)
+	}
+	if len(export.Notes) > Cfg.ImportMaxFiles {
+		return nil, nil, fmt.Errorf("enex has too many notes(max %d)", Cfg.ImportMaxFiles)
+	}
+
+	items := []Item{}
+	errors := models.ImportErrors{}
+	for i, n := range export.Notes {
+		file := fmt.Sprintf("#%d %s", i+1, n.Title)
+		body, err := enmlToText(n.Content)
+		if err != nil {
+			errors = append(errors, models.ImportError{File: file, Error: err.Error()})
+			continue
+		}
+		items = append(items, Item{File: file, Title: n.Title, Body: body, Tags: n.Tags})
+	}
+	return items, errors, nil
+}
+
+var blockElements = map[string]bool{
+	"div": true, "p": true, "li": true, "tr": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+var manyNewlines = regexp.MustCompile(`\n{3,}`)
+
+// enmlToText converts evernote xhtml content to plain text
+func enmlToText(enml string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(enml))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	text := &strings.Builder{}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", fmt.Errorf("invalid note content: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "br":
+				text.WriteString("\n")
+			case "li":
+				text.WriteString("- ")
+			case "en-todo":
+				checked := false
+				for _, a := range t.Attr {
+					checked = checked || (a.Name.Local == "checked" && a.Value == "true")
+				}
+				if checked {
+					text.WriteString("[x] ")
+				} else {
+					text.WriteString("[ ] ")
+				}
+			}
+		case xml.EndElement:
+			if blockElements[t.Name.Local] {
+				text.WriteString("\n")
+			}
+		}
+	}
+	return strings.TrimSpace(manyNewlines.ReplaceAllString(text.String(), "\n\n")), nil
+}
@@ -0,0 +1,153 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"notes/models"
+
+	. "notes/config"
+)
+
+// supported formats
+const (
+	FormatMarkdown = "markdown" // zip of .md files with optional front matter
+	FormatJSON     = "json"     // array of notes
+	FormatENEX     = "enex"     // evernote export
+)
+
+// Known checks that format is supported
+func Known(format string) bool {
+	return format == FormatMarkdown || format == FormatJSON || format == FormatENEX
+}
+
+// Item is note parsed from import data
+type Item struct {
+	File      string
+	Title     string
+	Body      string
+	Tags      []string
+	Published bool
+}
+
+// Parse data of format into items.
+// Broken files are reported in errors, err means that data can't be parsed at all
+func Parse(format string, data []byte) (items []Item, errors models.ImportErrors, err error) {
+	switch format {
+	case FormatMarkdown:
+		return parseMarkdownZip(data)
+	case FormatJSON:
+		return parseJSON(data)
+	case FormatENEX:
+		return parseENEX(data)
+	default:
+		return nil, nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func parseJSON(data []byte) ([]Item, models.ImportErrors, error) {
+	notes := []struct {
+		Title     string   `json:"title"`
+		Body      string   `json:"body"`
+		Tags      []string `json:"tags"`
+		Published bool     `json:"published"`
+	}{}
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, nil, fmt.Errorf("invalid json: %v", err)
+	}
+	if len(notes) > Cfg.ImportMaxFiles {
+		return nil, nil, fmt.Errorf("json has too many notes(max %d)", Cfg.ImportMaxFiles)
+	}
+
+	items := []Item{}
+	for i, n := range notes {
+		items = append(items, Item{
+			File:      fmt.Sprintf("#%d", i+1),
+			Title:     n.Title,
+			Body:      n.Body,
+			Tags:      n.Tags,
+			Published: n.Published,
+		})
+	}
+	return items, nil, nil
+}
+
+// how often progress of job is saved
+const progressEvery = 20
+
+// Run job, notes are validated and created one by one
+func Run(job *models.ImportJob, data []byte) {
+	// models panic on db errors, it must not kill server outside of request
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("import job %d panicked: %v", job.ID, r)
+			job.Status = models.ImportFailed
+			if len(job.Errors) < models.MaxImportErrors {
+				job.Errors = append(job.Errors, models.ImportError{Error: "server internal error"})
+			}
+			save(job)
+		}
+	}()
+
+	job.Status = models.ImportRunning
+	save(job)
+
+	items, errors, err := Parse(job.Format, data)
+	if err != nil {
+		job.Status = models.ImportFailed
+		job.Errors = append(job.Errors, models.ImportError{Error: err.Error()})
+		save(job)
+		return
+	}
+	job.Total = len(items) + len(errors)
+	for _, e := range errors {
+		job.Fail(e)
+	}
+
+	for i, item := range items {
+		note := &models.Note{
+			Title:     item.Title,
+			Body:      item.Body,
+			UserID:    job.UserID,
+			Published: item.Published,
+			Tags:      models.TagsFromNames(item.Tags),
+		}
+		if err := note.Create(); err != nil {
+			job.Fail(models.ImportError{File: item.File, Error: err.Error()})
+		} else {
+			job.Imported++
+		}
+		if (i+1)%progressEvery == 0 {
+			save(job)
+		}
+	}
+
+	job.Status = models.ImportDone
+	save(job)
+}
+
+// FailInterrupted marks jobs which were pending or running when server stopped as failed,
+// their data isn't stored so they can't be resumed
+func FailInterrupted() error {
+	jobs := []models.ImportJob{}
+	err := models.GetDB().Where("status IN ?", []string{models.ImportPending, models.ImportRunning}).Find(&jobs).Error
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		jobs[i].Status = models.ImportFailed
+		if len(jobs[i].Errors) < models.MaxImportErrors {
+			jobs[i].Errors = append(jobs[i].Errors, models.ImportError{Error: "interrupted by server restart, import it again"})
+		}
+		if err := jobs[i].Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func save(job *models.ImportJob) {
+	if err := job.Save(); err != nil {
+		log.Printf("when saving import job %d: %v", job.ID, err)
+	}
+}
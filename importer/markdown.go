@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"notes/models"
+	"path"
+	"strings"
+
+	. "notes/config"
+)
+
+// max size of one unpacked file
+const maxFileSize = 1 << 20
+
+func parseMarkdownZip(data []byte) ([]Item, models.ImportErrors, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid zip archive: %v", err)
+	}
+
+	// zip bomb protection, whole job fails so nothing is imported partially
+	if len(archive.File) > Cfg.ImportMaxFiles {
+		return nil, nil, fmt.Errorf("archive has too many files(max %d)", Cfg.ImportMaxFiles)
+	}
+	unpacked := int64(0)
+
+	items := []Item{}
+	errors := models.ImportErrors{}
+	for _, f := range archive.File {
+		name := f.Name
+		base := path.Base(name)
+		ext := strings.ToLower(path.Ext(name))
+		if f.FileInfo().IsDir() || strings.HasPrefix(base, ".") || strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		if ext != ".md" && ext != ".markdown" {
+			errors = append(errors, models.ImportError{File: name, Error: "not a markdown file"})
+			continue
+		}
+		if f.UncompressedSize64 > maxFileSize {
+			errors = append(errors, models.ImportError{File: name, Error: "file is too big"})
+			continue
+		}
+
+		content, err := readZipFile(f)
+		unpacked += int64(len(content))
+		if unpacked > Cfg.ImportMaxUnpacked {
+			return nil, nil, fmt.Errorf("archive is too big when unpacked(max %d bytes)", Cfg.ImportMaxUnpacked)
+		}
+		if err != nil {
+			errors = append(errors, models.ImportError{File: name, Error: err.Error()})
+			continue
+		}
+		item := parseMarkdown(strings.TrimSuffix(base, path.Ext(base)), content)
+		item.File = name
+		items = append(items, item)
+	}
+	return items, errors, nil
+}
+
+func readZipFile(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	// size in header can lie
+	content, err := ioutil.ReadAll(io.LimitReader(r, maxFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(content) > maxFileSize {
+		return "", fmt.Errorf("file is too big")
+	}
+	return string(content), nil
+}
+
+// parseMarkdown with front matter(title, tags, published),
+// without title in front matter it's taken from leading "# heading" or from file name
+func parseMarkdown(name, content string) Item {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	item := Item{Title: name}
+
+	meta, body := splitFrontMatter(content)
+	titleFound := false
+	if title, ok := meta["title"]; ok && len(title) > 0 {
+		item.Title = title[0]
+		titleFound = true
+	}
+	item.Tags = meta["tags"]
+	if published, ok := meta["published"]; ok && len(published) > 0 {
+		item.Published = published[0] == "true" || published[0] == "yes"
+	}
+
+	body = strings.TrimLeft(body, "\n")
+	if !titleFound && strings.HasPrefix(body, "# ") {
+		line := body
+		if i := strings.Index(body, "\n"); i >= 0 {
+			line, body = body[:i], body[i+1:]
+		} else {
+			body = ""
+		}
+		item.Title = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+	}
+	item.Body = strings.TrimSpace(body)
+	return item
+}
+
+// splitFrontMatter parses simple yaml front matter: "key: value", "key: [a, b]" and lists of "- value"
+func splitFrontMatter(content string) (map[string][]string, string) {
+	meta := map[string][]string{}
+	if !strings.HasPrefix(content, "---\n") {
+		return meta, content
+	}
+	end := strings.Index(content[4:], "\n---")
+	if end < 0 {
+		return meta, content
+	}
+	header := content[4 : 4+end]
+	body := content[4+end+4:]
+	if i := strings.Index(body, "\n"); i >= 0 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+
+	lastKey := ""
+	for _, line := range strings.Split(header, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "- ") && lastKey != "" {
+			meta[lastKey] = append(meta[lastKey], unquote(strings.TrimPrefix(trimmed, "- ")))
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		lastKey = strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		if value == "" {
+			meta[lastKey] = []string{}
+			continue
+		}
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			value = value[1 : len(value)-1]
+		}
+		if lastKey == "tags" {
+			for _, v := range strings.Split(value, ",") {
+				meta[lastKey] = append(meta[lastKey], unquote(strings.TrimSpace(v)))
+			}
+		} else {
+			meta[lastKey] = []string{unquote(value)}
+		}
+	}
+	return meta, body
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
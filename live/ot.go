@@ -0,0 +1,244 @@
+package live
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Component of operation, exactly one of fields is set.
+// In json it is number > 0 for retain, number < 0 for delete and string for insert(like ot.js)
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// MarshalJSON ...
+func (c Component) MarshalJSON() ([]byte, error) {
+	switch {
+	case c.Insert != "":
+		return json.Marshal(c.Insert)
+	case c.Delete > 0:
+		return json.Marshal(-c.Delete)
+	default:
+		return json.Marshal(c.Retain)
+	}
+}
+
+// UnmarshalJSON ...
+func (c *Component) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		*c = Component{Insert: v}
+	case float64:
+		n := int(v)
+		if float64(n) != v {
+			return fmt.Errorf("invalid component %v", v)
+		}
+		if n >= 0 {
+			*c = Component{Retain: n}
+		} else {
+			*c = Component{Delete: -n}
+		}
+	default:
+		return fmt.Errorf("invalid component %s", b)
+	}
+	return nil
+}
+
+func (c Component) isRetain() bool { return c.Retain > 0 }
+func (c Component) isInsert() bool { return c.Insert != "" }
+func (c Component) isDelete() bool { return c.Delete > 0 }
+
+// Operation on text, all lengths are in runes
+type Operation []Component
+
+// ErrOperation means that operation can't be applied
+var ErrOperation = errors.New("operation does not match document")
+
+func (o Operation) retain(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if len(o) > 0 && o[len(o)-1].isRetain() {
+		o[len(o)-1].Retain += n
+		return o
+	}
+	return append(o, Component{Retain: n})
+}
+
+func (o Operation) insert(s string) Operation {
+	if s == "" {
+		return o
+	}
+	last := len(o) - 1
+	if last >= 0 && o[last].isInsert() {
+		o[last].Insert += s
+		return o
+	}
+	// insert goes before delete to keep operation canonical
+	if last >= 0 && o[last].isDelete() {
+		if last > 0 && o[last-1].isInsert() {
+			o[last-1].Insert += s
+			return o
+		}
+		o = append(o, o[last])
+		o[last] = Component{Insert: s}
+		return o
+	}
+	return append(o, Component{Insert: s})
+}
+
+func (o Operation) delete(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if len(o) > 0 && o[len(o)-1].isDelete() {
+		o[len(o)-1].Delete += n
+		return o
+	}
+	return append(o, Component{Delete: n})
+}
+
+// normalize merges adjacent components of same kind and drops empty ones
+func (o Operation) normalize() Operation {
+	var res Operation
+	for _, c := range o {
+		switch {
+		case c.isRetain():
+			res = res.retain(c.Retain)
+		case c.isInsert():
+			res = res.insert(c.Insert)
+		case c.isDelete():
+			res = res.delete(c.Delete)
+		}
+	}
+	return res
+}
+
+// BaseLen is length of document operation can be applied to
+func (o Operation) BaseLen() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLen is length of document after applying
+func (o Operation) TargetLen() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + utf8.RuneCountInString(c.Insert)
+	}
+	return n
+}
+
+// Apply operation to doc
+func (o Operation) Apply(doc string) (string, error) {
+	runes := []rune(doc)
+	if o.BaseLen() != len(runes) {
+		return "", ErrOperation
+	}
+
+	res := make([]rune, 0, o.TargetLen())
+	pos := 0
+	for _, c := range o {
+		switch {
+		case c.isRetain():
+			res = append(res, runes[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.isInsert():
+			res = append(res, []rune(c.Insert)...)
+		case c.isDelete():
+			pos += c.Delete
+		}
+	}
+	return string(res), nil
+}
+
+// Transform concurrent operations a and b into a' and b' so that apply(apply(doc, a), b') == apply(apply(doc, b), a').
+// Inserts of a go first when both insert at same position
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, ErrOperation
+	}
+
+	var a1, b1 Operation
+	i, j := 0, 0
+	var ca, cb Component
+	next := func(o Operation, k *int, c *Component) {
+		if *k < len(o) {
+			*c = o[*k]
+			*k++
+		} else {
+			*c = Component{}
+		}
+	}
+	empty := func(c Component) bool { return !c.isRetain() && !c.isInsert() && !c.isDelete() }
+	next(a, &i, &ca)
+	next(b, &j, &cb)
+
+	for {
+		if empty(ca) && empty(cb) {
+			break
+		}
+
+		if ca.isInsert() {
+			a1 = a1.insert(ca.Insert)
+			b1 = b1.retain(utf8.RuneCountInString(ca.Insert))
+			next(a, &i, &ca)
+			continue
+		}
+		if cb.isInsert() {
+			a1 = a1.retain(utf8.RuneCountInString(cb.Insert))
+			b1 = b1.insert(cb.Insert)
+			next(b, &j, &cb)
+			continue
+		}
+		if empty(ca) || empty(cb) {
+			return nil, nil, ErrOperation
+		}
+
+		lenA, lenB := ca.Retain+ca.Delete, cb.Retain+cb.Delete
+		min := lenA
+		if lenB < min {
+			min = lenB
+		}
+
+		switch {
+		case ca.isRetain() && cb.isRetain():
+			a1 = a1.retain(min)
+			b1 = b1.retain(min)
+		case ca.isDelete() && cb.isRetain():
+			a1 = a1.delete(min)
+		case ca.isRetain() && cb.isDelete():
+			b1 = b1.delete(min)
+		}
+		// both deletes cancel each other
+
+		shrink := func(c *Component, n int) {
+			if c.isRetain() {
+				c.Retain -= n
+			} else {
+				c.Delete -= n
+			}
+		}
+		shrink(&ca, min)
+		shrink(&cb, min)
+		if lenA == min {
+			next(a, &i, &ca)
+		}
+		if lenB == min {
+			next(b, &j, &cb)
+		}
+	}
+
+	return a1, b1, nil
+}
@@ -0,0 +1,350 @@
+package live
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"notes/config"
+	"notes/models"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// Presence of user in session
+type Presence struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// Message is sent in both directions.
+// Client sends "op" with revision it is based on, server answers with "ack"
+// and sends "op" of others, "presence" on join/leave and "error" for rejected ops.
+// "reset" with new body is sent when note is changed outside of session, its revision replaces whole body,
+// and to client which op is based on revision older than kept history
+type Message struct {
+	Type    string     `json:"type"`
+	Rev     int        `json:"rev"`
+	Op      Operation  `json:"op,omitempty"`
+	Body    string     `json:"body,omitempty"`
+	UserID  uint       `json:"user_id,omitempty"`
+	Users   []Presence `json:"users,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+const (
+	sendBuffer = 64
+	// ops kept for transform, oldest half is dropped when exceeded
+	maxHistory = 512
+)
+
+type client struct {
+	conn     *websocket.Conn
+	user     Presence
+	canWrite bool
+	send     chan *Message
+}
+
+// session is shared state of note edited by connected clients
+type session struct {
+	noteID  uint
+	ownerID uint
+
+	mu      sync.Mutex
+	body    string
+	history []Operation // history[i] moves document from revision offset+i to offset+i+1
+	offset  int
+	clients map[*client]bool
+	dirty   bool
+	stop    chan struct{}
+	// stored body which session is based on, save is done only if it's still stored
+	base string
+}
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[uint]*session{}
+)
+
+// Serve connection of user to note until it's closed
+func Serve(conn *websocket.Conn, note *models.Note, user Presence, canWrite bool) {
+	c := &client{conn: conn, user: user, canWrite: canWrite, send: make(chan *Message, sendBuffer)}
+	// op inserting whole body, escaped rune takes up to 12 bytes in json
+	conn.SetReadLimit(int64(config.Cfg.BodyLength)*12 + 1024)
+	go c.writeLoop()
+
+	s := join(note, c)
+	defer leave(s, c)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg := &Message{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			c.trySend(&Message{Type: "error", Message: "invalid message"})
+			continue
+		}
+		if msg.Type != "op" {
+			c.trySend(&Message{Type: "error", Message: "unknown message type"})
+			continue
+		}
+		if err := s.apply(c, msg.Rev, msg.Op); err != nil {
+			c.trySend(&Message{Type: "error", Rev: msg.Rev, Message: err.Error()})
+		}
+	}
+}
+
+func (c *client) writeLoop() {
+	for msg := range c.send {
+		if err := c.conn.WriteJSON(msg); err != nil {
+			c.conn.Close()
+			for range c.send {
+			}
+			return
+		}
+	}
+	c.conn.Close()
+}
+
+// trySend drops slow client instead of blocking session
+func (c *client) trySend(msg *Message) {
+	select {
+	case c.send <- msg:
+	default:
+		c.conn.Close()
+	}
+}
+
+func join(note *models.Note, c *client) *session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	s, ok := sessions[note.ID]
+	if !ok {
+		// reload under lock, previous session could save body after note was fetched
+		if err := models.GetDB().Take(note, note.ID).Error; err != nil {
+			log.Printf("when loading live note %d: %v", note.ID, err)
+		}
+		s = &session{
+			noteID:  note.ID,
+			ownerID: note.UserID,
+			body:    note.Body,
+			clients: map[*client]bool{},
+			stop:    make(chan struct{}),
+			base:    note.Body,
+		}
+		sessions[note.ID] = s
+		go s.saveLoop(config.Cfg.LiveSaveInterval)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[c] = true
+	c.trySend(&Message{Type: "init", Rev: s.rev(), Body: s.body, Users: s.presence()})
+	s.broadcast(c, &Message{Type: "presence", Rev: s.rev(), Users: s.presence()})
+	return s
+}
+
+// leave closes session and saves body on last disconnect
+func leave(s *session, c *client) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	s.mu.Lock()
+	delete(s.clients, c)
+	close(c.send)
+	last := len(s.clients) == 0
+	if !last {
+		s.broadcast(nil, &Message{Type: "presence", Rev: s.rev(), Users: s.presence()})
+	}
+	s.mu.Unlock()
+
+	if last {
+		delete(sessions, s.noteID)
+		close(s.stop)
+		// under sessionsMu so that next session will load saved body
+		s.save()
+	}
+}
+
+func (s *session) presence() []Presence {
+	users := []Presence{}
+	seen := map[uint]bool{}
+	for c := range s.clients {
+		if !seen[c.user.UserID] {
+			seen[c.user.UserID] = true
+			users = append(users, c.user)
+		}
+	}
+	return users
+}
+
+func (s *session) broadcast(except *client, msg *Message) {
+	for c := range s.clients {
+		if c != except {
+			c.trySend(msg)
+		}
+	}
+}
+
+// AccessChanged rechecks access of users connected to note after it's shared or unshared,
+// users without access are disconnected
+func AccessChanged(noteID uint) {
+	sessionsMu.Lock()
+	s, ok := sessions[noteID]
+	sessionsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	users := map[uint]error{}
+	for c := range s.clients {
+		users[c.user.UserID] = nil
+	}
+	s.mu.Unlock()
+
+	for userID := range users {
+		note := &models.Note{Model: models.Model{ID: noteID}}
+		users[userID] = note.GetAccessible(userID, models.PermissionWrite)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		err, ok := users[c.user.UserID]
+		switch {
+		case !ok: // joined after check, so it has actual access
+		case err == nil:
+			c.canWrite = true
+		case err == models.ErrForbidden:
+			c.canWrite = false
+		case err == gorm.ErrRecordNotFound:
+			c.conn.Close()
+		default:
+			log.Printf("when checking access to live note %d: %v", noteID, err)
+		}
+	}
+}
+
+// rev is current revision of body
+func (s *session) rev() int {
+	return s.offset + len(s.history)
+}
+
+func (s *session) apply(c *client, rev int, op Operation) error {
+	op = op.normalize()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !c.canWrite {
+		return errors.New("you have no write access to this note")
+	}
+	if rev < s.offset {
+		c.trySend(&Message{Type: "reset", Rev: s.rev(), Body: s.body})
+		return errors.New("revision is too old, body is resent")
+	}
+	if rev > s.rev() {
+		return errors.New("invalid revision")
+	}
+	for _, concurrent := range s.history[rev-s.offset:] {
+		var err error
+		if op, _, err = Transform(op, concurrent); err != nil {
+			return err
+		}
+	}
+
+	body, err := op.Apply(s.body)
+	if err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(body) > config.Cfg.BodyLength {
+		return errors.New("body is too big")
+	}
+
+	s.body = body
+	s.push(op)
+	s.dirty = true
+
+	newRev := s.rev()
+	c.trySend(&Message{Type: "ack", Rev: newRev})
+	s.broadcast(c, &Message{Type: "op", Rev: newRev, Op: op, UserID: c.user.UserID})
+	return nil
+}
+
+func (s *session) saveLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.save()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *session) save() {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	body, base := s.body, s.base
+	s.dirty = false
+	s.mu.Unlock()
+
+	// only change of body conflicts with session, other fields of note are kept
+	note := &models.Note{Model: models.Model{ID: s.noteID}, UserID: s.ownerID}
+	err := note.Update(&models.NotePatch{Body: &body, IfBody: &base})
+	if err == nil {
+		s.mu.Lock()
+		s.base = body
+		s.mu.Unlock()
+		return
+	}
+	if err != models.ErrNoteChanged {
+		log.Printf("when saving live note %d: %v", s.noteID, err)
+		s.mu.Lock()
+		s.dirty = true // retried with next save
+		s.mu.Unlock()
+		return
+	}
+
+	// body is changed outside of session, that edit wins over session's one
+	stored := &models.Note{}
+	if err := models.GetDB().Select("id, body").Take(stored, s.noteID).Error; err != nil {
+		log.Printf("when reloading live note %d: %v", s.noteID, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.base = stored.Body
+	s.reset(stored.Body)
+}
+
+// reset body of session to stored one, must be called under lock
+func (s *session) reset(body string) {
+	op := Operation{}.delete(utf8.RuneCountInString(s.body)).insert(body)
+	s.body = body
+	s.push(op)
+	s.dirty = false
+	s.broadcast(nil, &Message{Type: "reset", Rev: s.rev(), Body: body})
+}
+
+// push op to history, compacting it when it's too long
+func (s *session) push(op Operation) {
+	s.history = append(s.history, op)
+	if len(s.history) > maxHistory {
+		drop := len(s.history) / 2
+		s.offset += drop
+		s.history = append([]Operation(nil), s.history[drop:]...)
+	}
+}
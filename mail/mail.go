@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	. "notes/config"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer sends emails through smtp server(with PLAIN auth if user is set)
+type SMTPMailer struct {
+	Addr     string // host:port
+	User     string
+	Password string
+	From     string
+}
+
+// NewSMTPMailer configured by Cfg, nil if smtp is not configured
+func NewSMTPMailer() *SMTPMailer {
+	if Cfg.SMTPAddr == "" {
+		return nil
+	}
+	return &SMTPMailer{Addr: Cfg.SMTPAddr, User: Cfg.SMTPUser, Password: Cfg.SMTPPassword, From: Cfg.MailFrom}
+}
+
+// Send email
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", to)
+	}
+	var auth smtp.Auth
+	if m.User != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.User, m.Password, host)
+	}
+	msg := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg))
+}
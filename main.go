@@ -5,8 +5,15 @@ import (
 	"log"
 	"net/http"
 	"notes/controllers"
+	"notes/importer"
 	"notes/models"
+	"notes/publishing"
+	"notes/reminders"
+	"notes/sitemap"
+	"notes/storage"
+	"notes/thumbnails"
 	"notes/util"
+	"notes/webhooks"
 	"os"
 
 	. "notes/config"
@@ -29,16 +36,83 @@ type InternalServerErrorResponder struct{}
 func GetRouter() http.Handler {
 	router := mux.NewRouter()
 	router.HandleFunc("/api/notes", controllers.PublishedNotesList).Methods("GET")
+	router.HandleFunc("/api/templates", controllers.PublicTemplatesList).Methods("GET")
 	router.HandleFunc("/api/users", controllers.CreateAccount).Methods("POST")
 	router.HandleFunc("/api/me", controllers.Login).Methods("POST")
 	router.HandleFunc("/api/me/notes", controllers.NotesList).Methods("GET")
 	router.HandleFunc("/api/me/notes", controllers.CreateNote).Methods("POST")
+	router.HandleFunc("/api/me/notes/export", controllers.NotebookExport).Methods("GET")
 	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}", controllers.NoteDetails).Methods("GET")
 	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}", controllers.NoteRemove).Methods("DELETE")
 	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}", controllers.NoteUpdate).Methods("PUT")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/export", controllers.NoteExport).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/attachments", controllers.AttachmentsList).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/attachments", controllers.UploadAttachment).Methods("POST")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/attachments/{attachment_id:[0-9]+}", controllers.AttachmentRemove).Methods("DELETE")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/items", controllers.ChecklistItemsList).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/items", controllers.CreateChecklistItem).Methods("POST")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/items/order", controllers.ChecklistReorder).Methods("PUT")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/items/{item_id:[0-9]+}", controllers.ChecklistItemUpdate).Methods("PUT")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/items/{item_id:[0-9]+}", controllers.ChecklistItemRemove).Methods("DELETE")
+	router.HandleFunc("/api/me/todo", controllers.TodoList).Methods("GET")
+	router.HandleFunc("/api/me/feed", controllers.Feed).Methods("GET")
+	router.HandleFunc("/api/me/profile", controllers.ProfileUpdate).Methods("PUT")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/reminders", controllers.RemindersList).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/reminders", controllers.CreateReminder).Methods("POST")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/reminders/{reminder_id:[0-9]+}", controllers.ReminderRemove).Methods("DELETE")
+	router.HandleFunc("/api/me/reminders", controllers.UpcomingReminders).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/backlinks", controllers.NoteBacklinks).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/outlinks", controllers.NoteOutlinks).Methods("GET")
+	router.HandleFunc("/api/me/links/broken", controllers.BrokenLinksList).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/forks", controllers.NoteForks).Methods("GET")
+	router.HandleFunc("/api/me/templates", controllers.TemplatesList).Methods("GET")
+	router.HandleFunc("/api/me/templates", controllers.CreateTemplate).Methods("POST")
+	router.HandleFunc("/api/me/templates/{template_id:[0-9]+}", controllers.TemplateDetails).Methods("GET")
+	router.HandleFunc("/api/me/templates/{template_id:[0-9]+}", controllers.TemplateUpdate).Methods("PUT")
+	router.HandleFunc("/api/me/templates/{template_id:[0-9]+}", controllers.TemplateRemove).Methods("DELETE")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/live", controllers.LiveNote).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/shares", controllers.ShareLinksList).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/shares", controllers.CreateShareLink).Methods("POST")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/shares/{share_id:[0-9]+}", controllers.ShareLinkRemove).Methods("DELETE")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/collaborators", controllers.CollaboratorsList).Methods("GET")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/collaborators", controllers.InviteCollaborator).Methods("POST")
+	router.HandleFunc("/api/me/notes/{note_id:[0-9]+}/collaborators/{user_id:[0-9]+}", controllers.RevokeCollaborator).Methods("DELETE")
+	router.HandleFunc("/api/me/shared-with-me", controllers.SharedWithMeList).Methods("GET")
+	router.HandleFunc("/api/me/events", controllers.EventsStream).Methods("GET")
+	router.HandleFunc("/api/me/webhooks", controllers.WebhooksList).Methods("GET")
+	router.HandleFunc("/api/me/webhooks", controllers.CreateWebhook).Methods("POST")
+	router.HandleFunc("/api/me/webhooks/{webhook_id:[0-9]+}", controllers.WebhookUpdate).Methods("PUT")
+	router.HandleFunc("/api/me/webhooks/{webhook_id:[0-9]+}", controllers.WebhookRemove).Methods("DELETE")
+	router.HandleFunc("/api/me/webhooks/{webhook_id:[0-9]+}/deliveries", controllers.WebhookDeliveriesList).Methods("GET")
+	router.HandleFunc("/api/me/webhooks/{webhook_id:[0-9]+}/test", controllers.WebhookTest).Methods("POST")
+	router.HandleFunc("/api/me/sync", controllers.SyncPull).Methods("GET")
+	router.HandleFunc("/api/me/sync", controllers.SyncPush).Methods("POST")
+	router.HandleFunc("/api/me/import", controllers.ImportNotes).Methods("POST")
+	router.HandleFunc("/api/me/import/{job_id:[0-9]+}", controllers.ImportJobDetail).Methods("GET")
 	router.HandleFunc("/api/me", controllers.UserDetails).Methods("GET")
 	router.HandleFunc("/api/notes/{note_id:[0-9]+}", controllers.PublishedNoteDetail).Methods("GET")
+	router.HandleFunc("/api/notes/{note_id:[0-9]+}/attachments", controllers.PublishedAttachmentsList).Methods("GET")
+	router.HandleFunc("/api/notes/{note_id:[0-9]+}/fork", controllers.ForkNote).Methods("POST")
+	router.HandleFunc("/api/notes/{note_id:[0-9]+}/like", controllers.LikeNote).Methods("PUT")
+	router.HandleFunc("/api/notes/{note_id:[0-9]+}/like", controllers.UnlikeNote).Methods("DELETE")
+	router.HandleFunc("/api/notes/{note_id:[0-9]+}/comments", controllers.CommentsList).Methods("GET")
+	router.HandleFunc("/api/notes/{note_id:[0-9]+}/comments", controllers.CreateComment).Methods("POST")
+	router.HandleFunc("/api/notes/{note_id:[0-9]+}/comments/{comment_id:[0-9]+}", controllers.CommentUpdate).Methods("PUT")
+	router.HandleFunc("/api/notes/{note_id:[0-9]+}/comments/{comment_id:[0-9]+}", controllers.CommentRemove).Methods("DELETE")
+	router.HandleFunc("/api/attachments/{attachment_id:[0-9]+}", controllers.DownloadAttachment).Methods("GET")
 	router.HandleFunc("/api/users/{user_id:[0-9]+}", controllers.AnotherUserDetail).Methods("GET")
+	router.HandleFunc("/api/users/by-name/{username}", controllers.UserByName).Methods("GET")
+	router.HandleFunc("/api/users/{user_id:[0-9]+}/notes", controllers.UserNotesList).Methods("GET")
+	router.HandleFunc("/api/users/{user_id:[0-9]+}/follow", controllers.FollowUser).Methods("PUT")
+	router.HandleFunc("/api/users/{user_id:[0-9]+}/follow", controllers.UnfollowUser).Methods("DELETE")
+	router.HandleFunc("/api/users/{user_id:[0-9]+}/followers", controllers.FollowersList).Methods("GET")
+	router.HandleFunc("/api/users/{user_id:[0-9]+}/following", controllers.FollowingList).Methods("GET")
+	router.HandleFunc("/api/shared/{token:[A-Za-z0-9_-]+}", controllers.SharedNoteDetail).Methods("GET")
+	router.HandleFunc("/feeds/notes.{format:atom|rss}", controllers.NotesFeed).Methods("GET")
+	router.HandleFunc("/feeds/users/{user_id:[0-9]+}/notes.{format:atom|rss}", controllers.UserNotesFeed).Methods("GET")
+	router.HandleFunc("/sitemap.xml", controllers.Sitemap).Methods("GET")
+	router.HandleFunc("/sitemaps/{name:(?:notes|authors)-[0-9]+}.xml", controllers.SitemapPart).Methods("GET")
+	router.HandleFunc("/robots.txt", controllers.Robots).Methods("GET")
 	router.NotFoundHandler = http.HandlerFunc(controllers.NotFound)
 	router.MethodNotAllowedHandler = http.HandlerFunc(controllers.MethodNotAllowed)
 
@@ -69,6 +143,18 @@ func main() {
 	}
 	models.Init(conn)
 	models.Migrate()
+	if err := storage.Init(); err != nil {
+		log.Fatal("when initializing storage:", err)
+	}
+	if err := importer.FailInterrupted(); err != nil {
+		log.Fatal("when failing interrupted imports:", err)
+	}
+
+	go webhooks.NewDispatcher().Run(nil)
+	go thumbnails.Run(nil)
+	go reminders.NewScheduler().Run(nil)
+	go publishing.Run(nil)
+	go sitemap.Run(nil)
 
 	router := GetRouter()
 
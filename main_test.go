@@ -1,17 +1,46 @@
 package main
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
 	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
+	"mime/multipart"
+	"net"
 	"net/http/httptest"
+	"notes/events"
+	"notes/imaging"
+	"notes/importer"
+	"notes/live"
 	"notes/models"
+	"notes/publishing"
+	"notes/reminders"
+	"notes/rrule"
+	"notes/sitemap"
+	"notes/storage"
+	"notes/thumbnails"
+	"notes/webhooks"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	. "notes/config"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -47,27 +76,124 @@ func NoteBodyDataTest(title, body string) io.Reader {
 
 type NotesTestSuite struct {
 	suite.Suite
-	ts *httptest.Server
+	ts           *httptest.Server
+	stop         chan struct{}
+	startWorkers sync.Once
+	mailer       *fakeMailer
+	leaks        leakGuard
+}
+
+// leakGuard remembers responses which have password field(on any depth)
+type leakGuard struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+// teeWriter copies response body, streams(events, websockets) still work through it
+type teeWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (t *teeWriter) Write(b []byte) (int, error) {
+	t.body.Write(b)
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *teeWriter) Flush() {
+	t.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (t *teeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return t.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (g *leakGuard) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tee := &teeWriter{ResponseWriter: w}
+		h.ServeHTTP(tee, r)
+
+		var body interface{}
+		if json.Unmarshal(tee.body.Bytes(), &body) == nil && hasPassword(body) {
+			g.mu.Lock()
+			g.paths = append(g.paths, r.Method+" "+r.URL.Path)
+			g.mu.Unlock()
+		}
+	})
+}
+
+// Take leaked paths and forget them
+func (g *leakGuard) Take() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	paths := g.paths
+	g.paths = nil
+	return paths
+}
+
+func hasPassword(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if strings.Contains(strings.ToLower(k), "password") || hasPassword(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasPassword(item) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (n *NotesTestSuite) SetupSuite() {
-	n.ts = httptest.NewServer(GetRouter())
+	n.ts = httptest.NewServer(n.leaks.Wrap(GetRouter()))
+	n.stop = make(chan struct{})
+
+	dir, err := ioutil.TempDir("", "notes-attachments")
+	n.Require().Nil(err)
+	Cfg.StoragePath = dir
+	n.Require().Nil(storage.Init())
 }
 
 func (n *NotesTestSuite) SetupTest() {
 	conn, err := gorm.Open(sqlite.Open(":memory:"))
 	n.Require().Nil(err, "test db should work")
 
+	// in-memory db exists per connection, background goroutines must use the same one
+	sqlDB, err := conn.DB()
+	n.Require().Nil(err)
+	sqlDB.SetMaxOpenConns(1)
+
 	models.Init(conn)
 	models.Migrate()
+
+	// background workers need db, so they're started with first test
+	n.startWorkers.Do(func() {
+		dispatcher := &webhooks.Dispatcher{Client: webhooks.NewClient(time.Second), MaxAttempts: 3, Backoff: 10 * time.Millisecond}
+		go dispatcher.Run(n.stop)
+		go thumbnails.Run(n.stop)
+		n.mailer = &fakeMailer{sent: make(chan sentMail, 16)}
+		scheduler := &reminders.Scheduler{Notifiers: []reminders.Notifier{reminders.EventNotifier{}, &reminders.MailNotifier{Mailer: n.mailer}},
+			Lease: 200 * time.Millisecond, MaxAttempts: 3}
+		go scheduler.Run(n.stop)
+		go publishing.Run(n.stop)
+		go sitemap.Run(n.stop)
+	})
 }
 
 func (n *NotesTestSuite) TearDownTest() {
+	n.Require().Empty(n.leaks.Take(), "responses should never have password field")
 	models.Truncate()
 }
 
 func (n *NotesTestSuite) TearDownSuite() {
+	close(n.stop)
 	n.ts.Close()
+	os.RemoveAll(Cfg.StoragePath)
 }
 
 func (n *NotesTestSuite) TestCreateUser() {
@@ -175,6 +301,9 @@ func (n *NotesTestSuite) TestPublishedNotesList() {
 	user2.Create()
 
 	expectedNotes := []models.Note{user1.Notes[0], user2.Notes[0]}
+	for i := range expectedNotes {
+		expectedNotes[i].Visibility = "" // only owner sees it
+	}
 
 	resp := Must(http.Get(n.ts.URL + "/api/notes"))
 	n.Require().Equal(200, resp.StatusCode)
@@ -301,7 +430,7 @@ func (n *NotesTestSuite) TestUserDetail() {
 	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
 
 	n.Assert().Equal(user.Username, rd.User.Username)
-	n.Assert().Equal("<hashed>", rd.User.Password)
+	n.Assert().Empty(rd.User.Password)
 }
 
 func (n *NotesTestSuite) TestPagination() {
@@ -331,6 +460,1336 @@ func (n *NotesTestSuite) TestPagination() {
 	n.Require().ElementsMatch(actualIDs, []uint{1})
 }
 
+func (n *NotesTestSuite) TestNoteStates() {
+	user := CreateUserTest()
+	notes := []*models.Note{}
+	for cnt := 0; cnt < Cfg.PerPage+2; cnt++ {
+		note := &models.Note{UserID: user.ID, Title: fmt.Sprintf("title %d", cnt)}
+		note.Create()
+		notes = append(notes, note)
+	}
+	yes := true
+	client := &http.Client{}
+	update := func(note *models.Note, patch interface{}) *http.Response {
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("%s/api/me/notes/%d", n.ts.URL, note.ID), AsJSONBody(patch))
+		AuthorizeRequest(req, user)
+		return Must(client.Do(req))
+	}
+	n.Require().Equal(200, update(notes[0], Object{"pinned": true, "starred": true}).StatusCode)
+	n.Require().Equal(200, update(notes[1], Object{"pinned": true}).StatusCode)
+	n.Require().Equal(200, update(notes[1], Object{"archived": true}).StatusCode)
+	n.Require().Equal(200, update(notes[1], Object{"pinned": true}).StatusCode, "archived note stays unpinned")
+	n.Require().Nil(notes[3].Update(&models.NotePatch{Starred: &yes}))
+
+	list := func(query string) *ResponseData {
+		req, _ := http.NewRequest("GET", n.ts.URL+"/api/me/notes?"+query, nil)
+		AuthorizeRequest(req, user)
+		resp := Must(client.Do(req))
+		n.Require().Equal(200, resp.StatusCode)
+		rd := &ResponseData{}
+		n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+		n.Require().True(rd.Success, rd.Message)
+		return rd
+	}
+	ids := func(rd *ResponseData) []uint {
+		res := []uint{}
+		for _, note := range rd.Notes {
+			res = append(res, note.ID)
+		}
+		return res
+	}
+
+	// pinned note is on top of first page, archived one isn't listed
+	rd := list("")
+	n.Require().Equal(2, rd.Pagination["max_page"])
+	n.Require().Len(rd.Notes, Cfg.PerPage)
+	n.Require().Equal(notes[0].ID, rd.Notes[0].ID)
+	n.Require().True(rd.Notes[0].Pinned)
+	n.Require().Equal(notes[len(notes)-1].ID, rd.Notes[1].ID)
+	rd = list("page=2")
+	n.Require().Equal([]uint{notes[2].ID}, ids(rd))
+
+	rd = list("archived=true")
+	n.Require().Equal([]uint{notes[1].ID}, ids(rd))
+	n.Require().False(rd.Notes[0].Pinned, "archiving unpins note")
+	n.Require().Equal(1, rd.Pagination["max_page"])
+
+	rd = list("starred=true")
+	n.Require().Equal([]uint{notes[0].ID, notes[3].ID}, ids(rd))
+
+	// states belong to owner
+	other := &models.User{Username: "collaborator", Password: "secret123"}
+	other.Create()
+	(&models.NoteShare{NoteID: notes[4].ID, UserID: other.ID, Permission: models.PermissionWrite}).Save(user.ID)
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("%s/api/me/notes/%d", n.ts.URL, notes[4].ID), AsJSONBody(Object{"pinned": true}))
+	AuthorizeRequest(req, other)
+	n.Require().Equal(403, Must(client.Do(req)).StatusCode)
+}
+
+type ChecklistData struct {
+	ResponseData
+	Item  models.ChecklistItem   `json:"item"`
+	Items []models.ChecklistItem `json:"items"`
+}
+
+func (n *NotesTestSuite) TestChecklist() {
+	user := CreateUserTest()
+	note := &models.Note{Title: "groceries", Body: "for weekend", UserID: user.ID}
+	note.Create()
+	other := &models.Note{Title: "work", Body: "tasks", UserID: user.ID}
+	other.Create()
+
+	client := &http.Client{}
+	call := func(method, url string, body interface{}) (*http.Response, *ChecklistData) {
+		var reader io.Reader
+		if body != nil {
+			reader = AsJSONBody(body)
+		}
+		req, _ := http.NewRequest(method, n.ts.URL+url, reader)
+		AuthorizeRequest(req, user)
+		resp := Must(client.Do(req))
+		rd := &ChecklistData{}
+		json.NewDecoder(resp.Body).Decode(rd)
+		return resp, rd
+	}
+	itemsURL := fmt.Sprintf("/api/me/notes/%d/items", note.ID)
+	texts := func() []string {
+		_, rd := call("GET", itemsURL, nil)
+		res := []string{}
+		for _, item := range rd.Items {
+			res = append(res, item.Text)
+		}
+		return res
+	}
+
+	ids := map[string]uint{}
+	for _, text := range []string{"milk", "bread", "eggs"} {
+		resp, rd := call("POST", itemsURL, Object{"text": text})
+		n.Require().Equal(200, resp.StatusCode, rd.Message)
+		ids[text] = rd.Item.ID
+	}
+	resp, rd := call("POST", itemsURL, Object{"text": "butter", "position": 1, "due_date": "2030-01-02T10:00:00Z"})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	ids["butter"] = rd.Item.ID
+	n.Require().Equal([]string{"milk", "butter", "bread", "eggs"}, texts())
+	resp, _ = call("POST", itemsURL, Object{"text": "  "})
+	n.Require().Equal(422, resp.StatusCode)
+
+	resp, rd = call("PUT", fmt.Sprintf("%s/%d", itemsURL, ids["milk"]), Object{"done": true})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	n.Require().True(rd.Item.Done)
+	resp, rd = call("PUT", fmt.Sprintf("%s/%d", itemsURL, ids["butter"]), Object{"text": "salted butter"})
+	n.Require().NotNil(rd.Item.DueDate, "missing due_date keeps it")
+	resp, rd = call("PUT", fmt.Sprintf("%s/%d", itemsURL, ids["butter"]), Object{"due_date": nil})
+	n.Require().Nil(rd.Item.DueDate, "null due_date removes it")
+	resp, rd = call("PUT", fmt.Sprintf("%s/%d", itemsURL, ids["butter"]), Object{"due_date": "2030-01-03T10:00:00Z"})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+
+	resp, rd = call("PUT", itemsURL+"/order", Object{"ids": []uint{ids["eggs"], ids["milk"], ids["bread"], ids["butter"]}})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	n.Require().Equal([]string{"eggs", "milk", "bread", "salted butter"}, texts())
+	resp, _ = call("PUT", itemsURL+"/order", Object{"ids": []uint{ids["eggs"], ids["eggs"], ids["bread"], ids["butter"]}})
+	n.Require().Equal(422, resp.StatusCode)
+
+	resp, _ = call("DELETE", fmt.Sprintf("%s/%d", itemsURL, ids["eggs"]), nil)
+	n.Require().Equal(200, resp.StatusCode)
+	_, rd = call("GET", itemsURL, nil)
+	n.Require().Equal(0, rd.Items[0].Position)
+	n.Require().Equal("milk", rd.Items[0].Text)
+
+	call("POST", fmt.Sprintf("/api/me/notes/%d/items", other.ID), Object{"text": "report", "due_date": "2030-01-01T09:00:00Z"})
+	call("POST", fmt.Sprintf("/api/me/notes/%d/items", other.ID), Object{"text": "call", "done": true})
+
+	// completion in list
+	req, _ := http.NewRequest("GET", n.ts.URL+"/api/me/notes", nil)
+	AuthorizeRequest(req, user)
+	list := &struct {
+		Notes []struct {
+			ID         uint `json:"id"`
+			Completion *int `json:"completion"`
+		} `json:"notes"`
+	}{}
+	n.Require().Nil(json.NewDecoder(Must(client.Do(req)).Body).Decode(list))
+	completion := map[uint]int{}
+	for _, item := range list.Notes {
+		n.Require().NotNil(item.Completion)
+		completion[item.ID] = *item.Completion
+	}
+	n.Require().Equal(map[uint]int{note.ID: 33, other.ID: 50}, completion)
+
+	// todo view: open items, nearest due date first
+	resp, rd = call("GET", "/api/me/todo", nil)
+	n.Require().Equal(200, resp.StatusCode)
+	todo := []string{}
+	for _, item := range rd.Items {
+		todo = append(todo, item.Text)
+	}
+	n.Require().Equal([]string{"report", "salted butter", "bread"}, todo)
+}
+
+type sentMail struct {
+	to, subject, body string
+}
+
+type fakeMailer struct {
+	sent  chan sentMail
+	mu    sync.Mutex
+	fails int // next sends fail
+}
+
+func (m *fakeMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fails > 0 {
+		m.fails--
+		return fmt.Errorf("smtp is unavailable")
+	}
+	m.sent <- sentMail{to, subject, body}
+	return nil
+}
+
+type ReminderData struct {
+	ResponseData
+	Reminder  models.Reminder   `json:"reminder"`
+	Reminders []models.Reminder `json:"reminders"`
+}
+
+func (n *NotesTestSuite) TestRRule() {
+	occurrences := func(rule string, start time.Time, limit int) []time.Time {
+		r, err := rrule.Parse(rule)
+		n.Require().Nil(err)
+		res := []time.Time{}
+		after := start.Add(-time.Second)
+		for len(res) < limit {
+			next, ok := r.Next(start, after)
+			if !ok {
+				break
+			}
+			res = append(res, next)
+			after = next
+		}
+		return res
+	}
+
+	start := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC) // monday
+	n.Require().Equal([]time.Time{start, start.AddDate(0, 0, 2), start.AddDate(0, 0, 7)},
+		occurrences("FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3", start, 10))
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	n.Require().Nil(err)
+	days := occurrences("FREQ=DAILY", time.Date(2030, 3, 30, 9, 0, 0, 0, berlin), 2)
+	n.Require().Equal(8, days[0].UTC().Hour())
+	n.Require().Equal(7, days[1].UTC().Hour(), "wall clock is kept after dst switch")
+	n.Require().Equal(9, days[1].Hour())
+
+	months := occurrences("FREQ=MONTHLY;UNTIL=20300401", time.Date(2030, 1, 31, 9, 0, 0, 0, time.UTC), 10)
+	n.Require().Len(months, 2, "february and april have no 31st")
+	n.Require().Equal(time.March, months[1].Month())
+
+	for _, rule := range []string{"", "FREQ=HOURLY", "FREQ=DAILY;BYDAY=MO", "FREQ=DAILY;COUNT=2;UNTIL=20300101", "FREQ=DAILY;INTERVAL=0"} {
+		_, err := rrule.Parse(rule)
+		n.Require().NotNil(err, rule)
+	}
+}
+
+func (n *NotesTestSuite) TestReminders() {
+	user := UserTest()
+	user.Email = "tum0xa@example.com"
+	n.Require().Nil(user.Create())
+	stranger := &models.User{Username: "stranger", Password: "secret123"}
+	stranger.Create()
+	note := &models.Note{Title: "dentist", Body: "call to reschedule", UserID: user.ID}
+	note.Create()
+
+	client := &http.Client{}
+	call := func(method, url string, as *models.User, body interface{}) (*http.Response, *ReminderData) {
+		var reader io.Reader
+		if body != nil {
+			reader = AsJSONBody(body)
+		}
+		req, _ := http.NewRequest(method, n.ts.URL+url, reader)
+		AuthorizeRequest(req, as)
+		resp := Must(client.Do(req))
+		rd := &ReminderData{}
+		json.NewDecoder(resp.Body).Decode(rd)
+		return resp, rd
+	}
+	remindersURL := fmt.Sprintf("/api/me/notes/%d/reminders", note.ID)
+
+	sub := events.Subscribe(user.ID)
+	defer events.Unsubscribe(sub)
+	resp, rd := call("POST", remindersURL, user, Object{"remind_at": time.Now().Add(time.Second).Format(time.RFC3339), "email": true})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	n.Require().NotNil(rd.Reminder.NextAt)
+
+	timeout := time.After(5 * time.Second)
+	for fired := false; !fired; {
+		select {
+		case e := <-sub.C:
+			fired = e.Type == events.ReminderDue && e.NoteID == note.ID
+		case <-timeout:
+			n.FailNow("reminder is not fired")
+		}
+	}
+	select {
+	case m := <-n.mailer.sent:
+		n.Require().Equal(user.Email, m.to)
+		n.Require().Contains(m.subject, "dentist")
+		n.Require().Contains(m.body, "call to reschedule")
+	case <-time.After(5 * time.Second):
+		n.FailNow("reminder email is not sent")
+	}
+	_, rd = call("GET", remindersURL, user, nil)
+	n.Require().Len(rd.Reminders, 1)
+	n.Require().Nil(rd.Reminders[0].NextAt, "one-off reminder is over")
+	n.Require().NotNil(rd.Reminders[0].FiredAt)
+
+	// failed delivery is retried when lease expires
+	n.mailer.mu.Lock()
+	n.mailer.fails = 1
+	n.mailer.mu.Unlock()
+	resp, rd = call("POST", remindersURL, user, Object{"remind_at": time.Now().Add(time.Second).Format(time.RFC3339), "email": true})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	retried := rd.Reminder
+	select {
+	case m := <-n.mailer.sent:
+		n.Require().Contains(m.subject, "dentist")
+	case <-time.After(5 * time.Second):
+		n.FailNow("reminder is not retried")
+	}
+	for i := 0; i < 100 && retried.NextAt != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		models.GetDB().Take(&retried, retried.ID)
+	}
+	n.Require().Nil(retried.NextAt, "reminder is passed after delivery")
+	n.Require().Zero(retried.Attempts)
+	n.Require().Nil(retried.Remove())
+
+	resp, rd = call("POST", remindersURL, user, Object{"remind_at": "2030-01-07T09:00", "time_zone": "Europe/Berlin", "rrule": "freq=weekly;byday=mo"})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	n.Require().Equal("FREQ=WEEKLY;BYDAY=MO", rd.Reminder.RRule)
+	n.Require().Equal(time.Date(2030, 1, 7, 8, 0, 0, 0, time.UTC), rd.Reminder.NextAt.UTC())
+	weekly := rd.Reminder
+
+	_, rd = call("GET", "/api/me/reminders", user, nil)
+	n.Require().Len(rd.Reminders, 1)
+	n.Require().Equal(weekly.ID, rd.Reminders[0].ID)
+
+	for _, body := range []Object{
+		{"remind_at": "2030-01-07T09:00", "time_zone": "Mars/Olympus"},
+		{"remind_at": "2030-01-07T09:00", "rrule": "FREQ=SECONDLY"},
+		{"remind_at": "2001-01-07T09:00"},
+		{"remind_at": "tomorrow"},
+	} {
+		resp, _ = call("POST", remindersURL, user, body)
+		n.Require().Equal(422, resp.StatusCode, body)
+	}
+	resp, _ = call("POST", remindersURL, stranger, Object{"remind_at": "2030-01-07T09:00"})
+	n.Require().Equal(404, resp.StatusCode)
+
+	resp, _ = call("DELETE", fmt.Sprintf("%s/%d", remindersURL, weekly.ID), stranger, nil)
+	n.Require().Equal(404, resp.StatusCode)
+	resp, _ = call("DELETE", fmt.Sprintf("%s/%d", remindersURL, weekly.ID), user, nil)
+	n.Require().Equal(200, resp.StatusCode)
+	_, rd = call("GET", "/api/me/reminders", user, nil)
+	n.Require().Len(rd.Reminders, 0)
+}
+
+func (n *NotesTestSuite) TestScheduledPublishing() {
+	user := CreateUserTest()
+	sub := events.Subscribe(user.ID)
+	defer events.Unsubscribe(sub)
+
+	client := &http.Client{}
+	call := func(method, url string, body interface{}) *http.Response {
+		req, _ := http.NewRequest(method, n.ts.URL+url, AsJSONBody(body))
+		AuthorizeRequest(req, user)
+		return Must(client.Do(req))
+	}
+	waitFor := func(eventType string, noteID uint) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-sub.C:
+				if e.Type == eventType && e.NoteID == noteID {
+					return
+				}
+			case <-timeout:
+				n.FailNow(eventType + " is not emitted")
+			}
+		}
+	}
+	isListed := func(noteID uint) bool {
+		rd := &ResponseData{}
+		json.NewDecoder(Must(http.Get(n.ts.URL + "/api/notes")).Body).Decode(rd)
+		for _, note := range rd.Notes {
+			if note.ID == noteID {
+				return true
+			}
+		}
+		return false
+	}
+	detailStatus := func(noteID uint) int {
+		return Must(http.Get(fmt.Sprintf("%s/api/notes/%d", n.ts.URL, noteID))).StatusCode
+	}
+
+	now := time.Now().Truncate(time.Second)
+	resp := call("POST", "/api/me/notes", Object{"title": "announcement", "body": "sale!",
+		"publish_at": now.Add(2 * time.Second), "unpublish_at": now.Add(3 * time.Second)})
+	n.Require().Equal(200, resp.StatusCode)
+	note := &models.Note{Title: "announcement"}
+	n.Require().Nil(note.Get())
+	n.Require().False(isListed(note.ID), "note isn't published before publish_at")
+	n.Require().Equal(404, detailStatus(note.ID))
+
+	waitFor(events.NotePublished, note.ID)
+	n.Require().True(isListed(note.ID))
+	n.Require().Equal(200, detailStatus(note.ID))
+
+	waitFor(events.NoteUnpublished, note.ID)
+	n.Require().False(isListed(note.ID))
+	n.Require().Equal(404, detailStatus(note.ID))
+	note = &models.Note{Model: models.Model{ID: note.ID}}
+	n.Require().Nil(note.Get())
+	n.Require().False(note.Published)
+	n.Require().Nil(note.UnpublishAt)
+	n.Require().Equal(now.Add(2*time.Second).UTC(), note.PublishedAt.UTC(), "scheduled note is published at publish_at")
+
+	// schedule is honored by queries even before transition is made
+	expired := &models.Note{Title: "old news", UserID: user.ID, Published: true, UnpublishAt: &now}
+	n.Require().Nil(models.GetDB().Create(expired).Error)
+	n.Require().False(isListed(expired.ID))
+
+	resp = call("PUT", fmt.Sprintf("/api/me/notes/%d", note.ID), Object{"publish_at": now.Add(time.Hour), "unpublish_at": now})
+	n.Require().Equal(422, resp.StatusCode)
+	resp = call("PUT", fmt.Sprintf("/api/me/notes/%d", note.ID), Object{"unpublish_at": now.Add(time.Hour)})
+	n.Require().Equal(200, resp.StatusCode)
+	n.Require().False(isListed(note.ID), "unpublish_at alone doesn't publish note")
+	resp = call("PUT", fmt.Sprintf("/api/me/notes/%d", note.ID), Object{"published": true})
+	n.Require().Equal(200, resp.StatusCode)
+	waitFor(events.NotePublished, note.ID)
+	n.Require().True(isListed(note.ID))
+}
+
+type LinksData struct {
+	ResponseData
+	Links []models.LinkInfo `json:"links"`
+}
+
+func (n *NotesTestSuite) TestNoteLinks() {
+	user := CreateUserTest()
+	other := &models.User{Username: "neighbour", Password: "secret123"}
+	other.Create()
+	recipes := &models.Note{Title: "Recipes", UserID: user.ID}
+	recipes.Create()
+	diary := &models.Note{Title: "secret diary", UserID: other.ID}
+	diary.Create()
+	blog := &models.Note{Title: "blog post", UserID: other.ID, Published: true}
+	blog.Create()
+	home := &models.Note{Title: "Home", UserID: user.ID,
+		Body: fmt.Sprintf("see [[Recipes]], [[#%d]], [[#%d]] and [[ Todo ]], again [[Recipes]]", diary.ID, blog.ID)}
+	n.Require().Nil(home.Create())
+
+	client := &http.Client{}
+	get := func(url string, as *models.User, rd interface{}) string {
+		req, _ := http.NewRequest("GET", n.ts.URL+url, nil)
+		AuthorizeRequest(req, as)
+		resp := Must(client.Do(req))
+		n.Require().Equal(200, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		n.Require().Nil(err)
+		n.Require().Nil(json.Unmarshal(body, rd))
+		return string(body)
+	}
+	titles := func(notes []models.Note) []string {
+		res := []string{}
+		for _, note := range notes {
+			res = append(res, note.Title)
+		}
+		return res
+	}
+
+	rd := &LinksData{}
+	body := get(fmt.Sprintf("/api/me/notes/%d/outlinks", home.ID), user, rd)
+	n.Require().Equal([]models.LinkInfo{
+		{Target: "Recipes", NoteID: recipes.ID, Title: "Recipes"},
+		{Target: fmt.Sprintf("#%d", diary.ID), Broken: true},
+		{Target: fmt.Sprintf("#%d", blog.ID), NoteID: blog.ID, Title: "blog post"},
+		{Target: "Todo", Broken: true},
+	}, rd.Links)
+	n.Require().NotContains(body, "secret diary", "titles of private notes don't leak")
+
+	rd = &LinksData{}
+	get(fmt.Sprintf("/api/me/notes/%d/backlinks", recipes.ID), user, rd)
+	n.Require().Equal([]string{"Home"}, titles(rd.Notes))
+
+	broken := &struct{ Notes []models.BrokenLinks }{}
+	get("/api/me/links/broken", user, broken)
+	n.Require().Equal([]models.BrokenLinks{{NoteID: home.ID, Title: "Home", Targets: []string{fmt.Sprintf("#%d", diary.ID), "Todo"}}}, broken.Notes)
+
+	// title links are resolved when note appears
+	todo := &models.Note{Title: "Todo", UserID: user.ID}
+	todo.Create()
+	broken = &struct{ Notes []models.BrokenLinks }{}
+	get("/api/me/links/broken", user, broken)
+	n.Require().Len(broken.Notes[0].Targets, 1)
+
+	// link to note shared with user isn't broken, report is paginated
+	n.Require().Nil((&models.NoteShare{NoteID: diary.ID, UserID: user.ID, Permission: models.PermissionRead}).Save(other.ID))
+	pd := &ResponseData{}
+	get("/api/me/links/broken", user, pd)
+	n.Require().Empty(pd.Notes)
+	n.Require().NotEmpty(pd.Pagination)
+	rd = &LinksData{}
+	get(fmt.Sprintf("/api/me/notes/%d/outlinks", home.ID), user, rd)
+	n.Require().Equal("secret diary", rd.Links[1].Title)
+
+	// backlinks are shown only from readable notes
+	rd = &LinksData{}
+	get(fmt.Sprintf("/api/me/notes/%d/backlinks", blog.ID), other, rd)
+	n.Require().Empty(rd.Notes)
+	share := &models.NoteShare{NoteID: home.ID, UserID: other.ID, Permission: models.PermissionRead}
+	n.Require().Nil(share.Save(user.ID))
+	rd = &LinksData{}
+	get(fmt.Sprintf("/api/me/notes/%d/backlinks", blog.ID), other, rd)
+	n.Require().Equal([]string{"Home"}, titles(rd.Notes))
+	n.Require().Empty(rd.Notes[0].Body)
+
+	newBody := "nothing here"
+	n.Require().Nil((&models.Note{Model: models.Model{ID: home.ID}, UserID: user.ID}).Update(&models.NotePatch{Body: &newBody}))
+	rd = &LinksData{}
+	get(fmt.Sprintf("/api/me/notes/%d/backlinks", recipes.ID), user, rd)
+	n.Require().Empty(rd.Notes)
+}
+
+type TemplateData struct {
+	ResponseData
+	Template  models.Template   `json:"template"`
+	Templates []models.Template `json:"templates"`
+	Variables []string          `json:"variables"`
+}
+
+func (n *NotesTestSuite) TestTemplates() {
+	user := CreateUserTest()
+	other := &models.User{Username: "teammate", Password: "secret123"}
+	other.Create()
+
+	client := &http.Client{}
+	call := func(method, url string, as *models.User, body interface{}) (*http.Response, *TemplateData) {
+		var reader io.Reader
+		if body != nil {
+			reader = AsJSONBody(body)
+		}
+		req, _ := http.NewRequest(method, n.ts.URL+url, reader)
+		AuthorizeRequest(req, as)
+		resp := Must(client.Do(req))
+		rd := &TemplateData{}
+		json.NewDecoder(resp.Body).Decode(rd)
+		return resp, rd
+	}
+
+	resp, rd := call("POST", "/api/me/templates", user, Object{"name": "standup",
+		"title": "Standup {{date}}", "body": "by {{ user }}\ntopic: {{topic}}\n{{topic}} again", "user_id": user.ID + 1})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	standup := rd.Template
+	n.Require().Equal(user.ID, standup.UserID, "owner is set by server")
+	resp, _ = call("POST", "/api/me/templates", user, Object{"name": "", "title": "x"})
+	n.Require().Equal(422, resp.StatusCode)
+
+	resp, rd = call("GET", fmt.Sprintf("/api/me/templates/%d", standup.ID), user, nil)
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	n.Require().Equal([]string{"date", "user", "topic"}, rd.Variables)
+
+	notesURL := fmt.Sprintf("/api/me/notes?template_id=%d", standup.ID)
+	resp, rd = call("POST", notesURL, user, Object{})
+	n.Require().Equal(422, resp.StatusCode, "topic is missing")
+	n.Require().Contains(rd.Message, "topic")
+	resp, rd = call("POST", notesURL, user, Object{"variables": Object{"topic": "release"}, "time_zone": "Asia/Tokyo"})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	n.Require().Nil(err)
+	title := "Standup " + time.Now().In(tokyo).Format("2006-01-02")
+	note := &models.Note{Title: title, UserID: user.ID}
+	n.Require().Nil(note.Get())
+	n.Require().Equal("by tum0xa\ntopic: release\nrelease again", note.Body)
+
+	// private template can't be used by others until it is public
+	resp, _ = call("POST", notesURL, other, Object{"title": "my standup", "variables": Object{"topic": "x"}})
+	n.Require().Equal(404, resp.StatusCode)
+	resp, _ = call("GET", fmt.Sprintf("/api/me/templates/%d", standup.ID), other, nil)
+	n.Require().Equal(404, resp.StatusCode)
+	resp, _ = call("PUT", fmt.Sprintf("/api/me/templates/%d", standup.ID), other, Object{"public": true})
+	n.Require().Equal(404, resp.StatusCode)
+	resp, _ = call("PUT", fmt.Sprintf("/api/me/templates/%d", standup.ID), user, Object{"public": true})
+	n.Require().Equal(200, resp.StatusCode)
+
+	rd = &TemplateData{}
+	json.NewDecoder(Must(http.Get(n.ts.URL + "/api/templates")).Body).Decode(rd)
+	n.Require().Len(rd.Templates, 1)
+	resp, rd = call("POST", notesURL, other, Object{"title": "my standup", "variables": Object{"topic": "x"}})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	note = &models.Note{Title: "my standup", UserID: other.ID}
+	n.Require().Nil(note.Get())
+	n.Require().Equal("by teammate\ntopic: x\nx again", note.Body, "given title is kept, body is expanded")
+
+	resp, _ = call("DELETE", fmt.Sprintf("/api/me/templates/%d", standup.ID), other, nil)
+	n.Require().Equal(404, resp.StatusCode)
+	resp, _ = call("DELETE", fmt.Sprintf("/api/me/templates/%d", standup.ID), user, nil)
+	n.Require().Equal(200, resp.StatusCode)
+	_, rd = call("GET", "/api/me/templates", user, nil)
+	n.Require().Empty(rd.Templates)
+}
+
+type ForksData struct {
+	ResponseData
+	Forks      []models.Fork `json:"forks"`
+	ForksCount int           `json:"forks_count"`
+}
+
+func (n *NotesTestSuite) TestForkNote() {
+	author := CreateUserTest()
+	reader := &models.User{Username: "reader", Password: "secret123"}
+	reader.Create()
+	original := &models.Note{Title: "pancakes", Body: "flour, milk, eggs", UserID: author.ID, Published: true,
+		Tags: models.TagsFromNames([]string{"food"})}
+	original.Create()
+	private := &models.Note{Title: "drafts", UserID: author.ID}
+	private.Create()
+
+	client := &http.Client{}
+	call := func(method, url string, as *models.User, rd interface{}) *http.Response {
+		req, _ := http.NewRequest(method, n.ts.URL+url, nil)
+		AuthorizeRequest(req, as)
+		resp := Must(client.Do(req))
+		json.NewDecoder(resp.Body).Decode(rd)
+		return resp
+	}
+
+	rd := &ResponseData{}
+	resp := call("POST", fmt.Sprintf("/api/notes/%d/fork", original.ID), reader, rd)
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	fork := &models.Note{Model: models.Model{ID: rd.Note.ID}}
+	n.Require().Nil(fork.Get())
+	n.Require().Nil(fork.LoadTags())
+	n.Require().Equal(reader.ID, fork.UserID)
+	n.Require().Equal(original.Body, fork.Body)
+	n.Require().False(fork.Published)
+	n.Require().Equal(original.ID, *fork.ForkedFromID)
+	n.Require().Equal("food", fork.Tags[0].Name)
+
+	n.Require().Equal(404, call("POST", fmt.Sprintf("/api/notes/%d/fork", private.ID), reader, &ResponseData{}).StatusCode)
+	n.Require().Equal(422, call("POST", fmt.Sprintf("/api/notes/%d/fork", original.ID), author, &ResponseData{}).StatusCode)
+	n.Require().Equal(403, Must(http.Post(fmt.Sprintf("%s/api/notes/%d/fork", n.ts.URL, original.ID), "", nil)).StatusCode)
+
+	rd = &ResponseData{}
+	json.NewDecoder(Must(http.Get(fmt.Sprintf("%s/api/notes/%d", n.ts.URL, original.ID))).Body).Decode(rd)
+	n.Require().Equal(1, rd.Note.ForksCount)
+
+	forks := &ForksData{}
+	n.Require().Equal(200, call("GET", fmt.Sprintf("/api/me/notes/%d/forks", original.ID), author, forks).StatusCode)
+	n.Require().Len(forks.Forks, 1)
+	n.Require().Equal("reader", forks.Forks[0].Username)
+	n.Require().Empty(forks.Forks[0].Title, "title of private fork isn't shown")
+	n.Require().Equal(404, call("GET", fmt.Sprintf("/api/me/notes/%d/forks", original.ID), reader, &ForksData{}).StatusCode)
+
+	writer := &models.User{Username: "writer", Password: "secret123"}
+	writer.Create()
+	n.Require().Equal(200, call("POST", fmt.Sprintf("/api/notes/%d/fork", original.ID), writer, &ResponseData{}).StatusCode)
+	forks = &ForksData{}
+	call("GET", fmt.Sprintf("/api/me/notes/%d/forks", original.ID), author, forks)
+	n.Require().Len(forks.Forks, 2)
+	n.Require().Equal([]string{"writer", "reader"}, []string{forks.Forks[0].Username, forks.Forks[1].Username})
+	n.Require().Equal(1, forks.Pagination["max_page"])
+	forks = &ForksData{}
+	call("GET", fmt.Sprintf("/api/me/notes/%d/forks?page=2", original.ID), author, forks)
+	n.Require().Empty(forks.Forks)
+	n.Require().Equal(2, forks.ForksCount)
+
+	n.Require().Nil((&models.Note{Model: models.Model{ID: fork.ID}, UserID: reader.ID}).Remove())
+	forks = &ForksData{}
+	call("GET", fmt.Sprintf("/api/me/notes/%d/forks", original.ID), author, forks)
+	n.Require().Len(forks.Forks, 1)
+	n.Require().Equal(1, forks.ForksCount)
+
+	// fork fields and counters can't be set by client
+	req, _ := http.NewRequest("POST", n.ts.URL+"/api/me/notes", AsJSONBody(Object{"title": "forged", "body": "text",
+		"forked_from": private.ID, "forks_count": 777, "likes_count": 99999}))
+	AuthorizeRequest(req, reader)
+	n.Require().Equal(200, Must(client.Do(req)).StatusCode)
+	forged := &models.Note{Title: "forged"}
+	n.Require().Nil(forged.Get())
+	n.Require().Nil(forged.ForkedFromID)
+	n.Require().Equal(0, forged.ForksCount)
+	n.Require().Equal(0, forged.LikesCount)
+	forks = &ForksData{}
+	call("GET", fmt.Sprintf("/api/me/notes/%d/forks", private.ID), author, forks)
+	n.Require().Empty(forks.Forks)
+}
+
+type CommentsData struct {
+	ResponseData
+	Comment  models.Comment   `json:"comment"`
+	Comments []models.Comment `json:"comments"`
+}
+
+func (n *NotesTestSuite) TestComments() {
+	owner := CreateUserTest()
+	alice := &models.User{Username: "alice", Password: "secret123"}
+	alice.Create()
+	bob := &models.User{Username: "bob", Password: "secret123"}
+	bob.Create()
+	note := &models.Note{Title: "release notes", Body: "v2 is out", UserID: owner.ID, Published: true}
+	note.Create()
+	draft := &models.Note{Title: "draft", UserID: owner.ID}
+	draft.Create()
+
+	client := &http.Client{}
+	call := func(method, url string, as *models.User, body interface{}) (*http.Response, *CommentsData) {
+		var reader io.Reader
+		if body != nil {
+			reader = AsJSONBody(body)
+		}
+		req, _ := http.NewRequest(method, n.ts.URL+url, reader)
+		if as != nil {
+			AuthorizeRequest(req, as)
+		}
+		resp := Must(client.Do(req))
+		rd := &CommentsData{}
+		json.NewDecoder(resp.Body).Decode(rd)
+		return resp, rd
+	}
+	commentsURL := fmt.Sprintf("/api/notes/%d/comments", note.ID)
+	commentURL := func(id uint) string { return fmt.Sprintf("%s/%d", commentsURL, id) }
+
+	resp, rd := call("POST", commentsURL, alice, Object{"body": "great news"})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	first := rd.Comment
+	resp, rd = call("POST", commentsURL, bob, Object{"body": "agreed", "parent_id": first.ID})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	reply := rd.Comment
+	resp, rd = call("POST", commentsURL, alice, Object{"body": "thanks", "parent_id": reply.ID})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	_, rd = call("POST", commentsURL, bob, Object{"body": "spam spam"})
+	spam := rd.Comment
+
+	resp, _ = call("POST", fmt.Sprintf("/api/notes/%d/comments", draft.ID), alice, Object{"body": "hi"})
+	n.Require().Equal(404, resp.StatusCode, "only published notes have comments")
+	resp, _ = call("POST", commentsURL, alice, Object{"body": "  "})
+	n.Require().Equal(422, resp.StatusCode)
+	resp, _ = call("POST", commentsURL, alice, Object{"body": "hi", "parent_id": 12345})
+	n.Require().Equal(422, resp.StatusCode)
+
+	_, rd = call("GET", commentsURL, nil, nil)
+	n.Require().Len(rd.Comments, 2)
+	n.Require().Equal("alice", rd.Comments[0].Username)
+	n.Require().Equal("agreed", rd.Comments[0].Replies[0].Body)
+	n.Require().Equal("thanks", rd.Comments[0].Replies[0].Replies[0].Body)
+
+	// editing is for author, moderation is for owner
+	resp, _ = call("PUT", commentURL(first.ID), bob, Object{"body": "edited"})
+	n.Require().Equal(403, resp.StatusCode)
+	resp, rd = call("PUT", commentURL(first.ID), alice, Object{"body": "great news!"})
+	n.Require().Equal(200, resp.StatusCode, rd.Message)
+	resp, _ = call("PUT", commentURL(spam.ID), bob, Object{"hidden": true})
+	n.Require().Equal(403, resp.StatusCode)
+	resp, _ = call("PUT", commentURL(spam.ID), owner, Object{"hidden": true})
+	n.Require().Equal(200, resp.StatusCode)
+	_, rd = call("GET", commentsURL, alice, nil)
+	n.Require().True(rd.Comments[1].Hidden)
+	n.Require().Empty(rd.Comments[1].Body, "hidden comment isn't shown to others")
+	_, rd = call("GET", commentsURL, owner, nil)
+	n.Require().Equal("spam spam", rd.Comments[1].Body)
+
+	countOf := func() interface{} {
+		rd := &struct{ Notes []map[string]interface{} }{}
+		json.NewDecoder(Must(http.Get(n.ts.URL + "/api/notes")).Body).Decode(rd)
+		return rd.Notes[0]["comments_count"]
+	}
+	n.Require().Equal(3.0, countOf())
+
+	// comment with replies stays in thread
+	resp, _ = call("DELETE", commentURL(reply.ID), alice, nil)
+	n.Require().Equal(403, resp.StatusCode)
+	resp, _ = call("DELETE", commentURL(reply.ID), bob, nil)
+	n.Require().Equal(200, resp.StatusCode)
+	resp, _ = call("DELETE", commentURL(spam.ID), owner, nil)
+	n.Require().Equal(200, resp.StatusCode)
+	_, rd = call("GET", commentsURL, nil, nil)
+	n.Require().Len(rd.Comments, 1)
+	n.Require().True(rd.Comments[0].Replies[0].Deleted)
+	n.Require().Empty(rd.Comments[0].Replies[0].Body)
+	n.Require().Equal("thanks", rd.Comments[0].Replies[0].Replies[0].Body)
+	n.Require().Equal(2.0, countOf())
+
+	// long thread is cut
+	busy := &models.Comment{NoteID: note.ID, UserID: bob.ID, Body: "thread"}
+	n.Require().Nil(busy.Create())
+	n.Require().Equal(busy.ID, busy.RootID)
+	for i := 0; i <= models.MaxThreadReplies; i++ {
+		n.Require().Nil((&models.Comment{NoteID: note.ID, UserID: alice.ID, Body: "reply", ParentID: &busy.ID}).Create())
+	}
+	_, rd = call("GET", commentsURL, nil, nil)
+	n.Require().Len(rd.Comments, 2)
+	n.Require().Len(rd.Comments[1].Replies, models.MaxThreadReplies)
+	n.Require().True(rd.Comments[1].MoreReplies)
+	n.Require().False(rd.Comments[0].MoreReplies)
+
+	disabled := true
+	n.Require().Nil((&models.Note{Model: models.Model{ID: note.ID}, UserID: owner.ID}).Update(&models.NotePatch{CommentsDisabled: &disabled}))
+	resp, _ = call("POST", commentsURL, alice, Object{"body": "one more"})
+	n.Require().Equal(403, resp.StatusCode)
+	resp, _ = call("PUT", fmt.Sprintf("/api/me/notes/%d", note.ID), alice, Object{"comments_disabled": false})
+	n.Require().Equal(404, resp.StatusCode)
+}
+
+func (n *NotesTestSuite) TestLikes() {
+	author := CreateUserTest()
+	fans := []*models.User{}
+	for _, name := range []string{"fan1", "fan2"} {
+		fan := &models.User{Username: name, Password: "secret123"}
+		fan.Create()
+		fans = append(fans, fan)
+	}
+	notes := map[string]*models.Note{}
+	for _, title := range []string{"old hit", "fresh", "hot"} {
+		note := &models.Note{Title: title, UserID: author.ID, Published: true}
+		note.Create()
+		notes[title] = note
+	}
+	draft := &models.Note{Title: "draft", UserID: author.ID}
+	draft.Create()
+
+	client := &http.Client{}
+	like := func(method string, note *models.Note, as *models.User) (int, Object) {
+		req, _ := http.NewRequest(method, fmt.Sprintf("%s/api/notes/%d/like", n.ts.URL, note.ID), nil)
+		AuthorizeRequest(req, as)
+		resp := Must(client.Do(req))
+		rd := Object{}
+		json.NewDecoder(resp.Body).Decode(&rd)
+		return resp.StatusCode, rd
+	}
+	titles := func(sort string) []string {
+		rd := &ResponseData{}
+		resp := Must(http.Get(n.ts.URL + "/api/notes?sort=" + sort))
+		n.Require().Equal(200, resp.StatusCode)
+		json.NewDecoder(resp.Body).Decode(rd)
+		res := []string{}
+		for _, note := range rd.Notes {
+			res = append(res, note.Title)
+		}
+		return res
+	}
+
+	for _, fan := range fans {
+		status, rd := like("PUT", notes["hot"], fan)
+		n.Require().Equal(200, status, rd["message"])
+	}
+	status, rd := like("PUT", notes["hot"], fans[0])
+	n.Require().Equal(200, status)
+	n.Require().Equal(2.0, rd["likes_count"], "note is liked once by user")
+	like("PUT", notes["fresh"], fans[0])
+	status, _ = like("PUT", draft, fans[0])
+	n.Require().Equal(404, status)
+
+	// four likes made three days before the fresh one weigh less than it
+	fresh := &models.Note{Model: models.Model{ID: notes["fresh"].ID}}
+	n.Require().Nil(fresh.Get())
+	decayed := fresh.TrendingScore - 3*math.Ln2 + math.Log(4)
+	n.Require().Nil(models.GetDB().Model(&models.Note{}).Where("id = ?", notes["old hit"].ID).
+		UpdateColumns(map[string]interface{}{"likes_count": 4, "trending_score": decayed}).Error)
+
+	n.Require().Equal([]string{"old hit", "hot", "fresh"}, titles("popular"))
+	n.Require().Equal([]string{"hot", "fresh", "old hit"}, titles("trending"))
+	n.Require().Equal(400, Must(http.Get(n.ts.URL+"/api/notes?sort=random")).StatusCode)
+
+	// likes_count of new note is not taken from client
+	req, _ := http.NewRequest("POST", n.ts.URL+"/api/me/notes", AsJSONBody(Object{"title": "forged", "body": "text",
+		"published": true, "likes_count": 99999}))
+	AuthorizeRequest(req, author)
+	n.Require().Equal(200, Must(client.Do(req)).StatusCode)
+	n.Require().Equal([]string{"old hit", "hot", "fresh", "forged"}, titles("popular"))
+
+	for _, fan := range fans {
+		status, rd = like("DELETE", notes["hot"], fan)
+		n.Require().Equal(200, status)
+	}
+	n.Require().Equal(0.0, rd["likes_count"])
+	hot := &models.Note{Model: models.Model{ID: notes["hot"].ID}}
+	n.Require().Nil(hot.Get())
+	n.Require().Equal(0.0, hot.TrendingScore, "score of note without likes is zero")
+	n.Require().Equal([]string{"fresh", "old hit", "forged", "hot"}, titles("trending"))
+
+	// like of note which isn't published anymore can be withdrawn, score of remaining likes is kept
+	n.Require().Nil(fresh.Get())
+	monthsAgo := fresh.TrendingScore - 60*math.Ln2
+	models.GetDB().Model(&models.Like{}).Where("note_id = ?", fresh.ID).UpdateColumn("created_at", time.Now().Add(-60*models.TrendingHalfLife))
+	models.GetDB().Model(fresh).UpdateColumn("trending_score", monthsAgo)
+	like("PUT", fresh, fans[1])
+	n.Require().Nil(models.GetDB().Take(fresh, fresh.ID).Error)
+	published := false
+	n.Require().Nil(fresh.Update(&models.NotePatch{Published: &published}))
+	status, rd = like("DELETE", fresh, fans[1])
+	n.Require().Equal(200, status, rd["message"])
+	n.Require().Equal(1.0, rd["likes_count"])
+	fresh = &models.Note{Model: models.Model{ID: notes["fresh"].ID}}
+	n.Require().Nil(fresh.Get())
+	n.Require().InDelta(monthsAgo, fresh.TrendingScore, 1e-6)
+	status, _ = like("DELETE", draft, fans[1])
+	n.Require().Equal(404, status, "unpublished note without like isn't seen")
+}
+
+type FollowsData struct {
+	ResponseData
+	Users          []models.User `json:"users"`
+	FollowersCount int           `json:"followers_count"`
+	FollowingCount int           `json:"following_count"`
+}
+
+func (n *NotesTestSuite) TestFollowAndFeed() {
+	reader := CreateUserTest()
+	authors := []*models.User{}
+	for _, name := range []string{"writer", "poet", "stranger"} {
+		author := &models.User{Username: name, Password: "secret123"}
+		author.Create()
+		authors = append(authors, author)
+		(&models.Note{Title: name + " note", UserID: author.ID, Published: true}).Create()
+		(&models.Note{Title: name + " draft", UserID: author.ID}).Create()
+	}
+
+	client := &http.Client{}
+	call := func(method, url string, as *models.User) (*http.Response, *FollowsData) {
+		req, _ := http.NewRequest(method, n.ts.URL+url, nil)
+		if as != nil {
+			AuthorizeRequest(req, as)
+		}
+		resp := Must(client.Do(req))
+		rd := &FollowsData{}
+		json.NewDecoder(resp.Body).Decode(rd)
+		return resp, rd
+	}
+	followURL := func(u *models.User) string { return fmt.Sprintf("/api/users/%d/follow", u.ID) }
+
+	for _, author := range authors[:2] {
+		resp, rd := call("PUT", followURL(author), reader)
+		n.Require().Equal(200, resp.StatusCode, rd.Message)
+	}
+	resp, _ := call("PUT", followURL(authors[0]), reader)
+	n.Require().Equal(200, resp.StatusCode, "following twice changes nothing")
+	resp, _ = call("PUT", followURL(reader), reader)
+	n.Require().Equal(422, resp.StatusCode)
+	resp, _ = call("PUT", "/api/users/12345/follow", reader)
+	n.Require().Equal(404, resp.StatusCode)
+	resp, _ = call("PUT", followURL(reader), authors[2])
+	n.Require().Equal(200, resp.StatusCode)
+
+	_, rd := call("GET", fmt.Sprintf("/api/users/%d/following", reader.ID), nil)
+	n.Require().Len(rd.Users, 2)
+	n.Require().NotEmpty(rd.Pagination)
+	_, rd = call("GET", fmt.Sprintf("/api/users/%d/followers", authors[0].ID), nil)
+	n.Require().Equal("tum0xa", rd.Users[0].Username)
+	n.Require().Empty(rd.Users[0].Password)
+	_, rd = call("GET", fmt.Sprintf("/api/users/%d", reader.ID), nil)
+	n.Require().Equal(1, rd.FollowersCount)
+	n.Require().Equal(2, rd.FollowingCount)
+
+	_, rd = call("GET", "/api/me/feed", reader)
+	n.Require().NotEmpty(rd.Pagination)
+	titles := []string{}
+	for _, note := range rd.Notes {
+		titles = append(titles, note.Title)
+	}
+	n.Require().Equal([]string{"poet note", "writer note"}, titles)
+
+	// feed is ordered by publishing, not by creation
+	yes := true
+	draft := &models.Note{}
+	n.Require().Nil(models.GetDB().Where("title = ?", "writer draft").Take(draft).Error)
+	n.Require().Nil(draft.Update(&models.NotePatch{Published: &yes}))
+	_, rd = call("GET", "/api/me/feed", reader)
+	n.Require().Equal("writer draft", rd.Notes[0].Title)
+	n.Require().NotNil(rd.Notes[0].PublishedAt)
+
+	resp, _ = call("DELETE", followURL(authors[1]), reader)
+	n.Require().Equal(200, resp.StatusCode)
+	resp, _ = call("DELETE", followURL(authors[1]), reader)
+	n.Require().Equal(404, resp.StatusCode)
+	_, rd = call("GET", "/api/me/feed", reader)
+	n.Require().Len(rd.Notes, 2)
+}
+
+type ProfileData struct {
+	ResponseData
+	AvatarURL string `json:"avatar_url"`
+}
+
+func (n *NotesTestSuite) TestProfiles() {
+	user := CreateUserTest()
+	other := &models.User{Username: "other", Password: "secret123"}
+	other.Create()
+	note := &models.Note{Title: "private photos", UserID: user.ID}
+	note.Create()
+	(&models.Note{Title: "public one", UserID: user.ID, Published: true}).Create()
+	(&models.Note{Title: "public two", UserID: user.ID, Published: true}).Create()
+	(&models.Note{Title: "not mine", UserID: other.ID, Published: true}).Create()
+
+	rd := &AttachmentData{}
+	json.NewDecoder(n.uploadAttachment(user, note.ID, "me.jpg", photoWithExif(32, 32)).Body).Decode(rd)
+	photo := rd.Attachment
+	rd = &AttachmentData{}
+	json.NewDecoder(n.uploadAttachment(user, note.ID, "cv.txt", []byte("plain text")).Body).Decode(rd)
+	text := rd.Attachment
+
+	client := &http.Client{}
+	update := func(as *models.User, body Object) int {
+		req, _ := http.NewRequest("PUT", n.ts.URL+"/api/me/profile", AsJSONBody(body))
+		AuthorizeRequest(req, as)
+		return Must(client.Do(req)).StatusCode
+	}
+	profile := func(url string) (int, *ProfileData) {
+		resp := Must(http.Get(n.ts.URL + url))
+		pd := &ProfileData{}
+		json.NewDecoder(resp.Body).Decode(pd)
+		return resp.StatusCode, pd
+	}
+
+	n.Require().Equal(200, update(user, Object{"display_name": " Tum ", "bio": "writes notes",
+		"website": "https://example.com", "avatar_id": photo.ID}))
+	for _, body := range []Object{
+		{"website": "javascript:alert(1)"},
+		{"bio": strings.Repeat("x", 501)},
+		{"avatar_id": text.ID},
+	} {
+		n.Require().Equal(422, update(user, body), body)
+	}
+	n.Require().Equal(422, update(other, Object{"avatar_id": photo.ID}), "avatar should be own attachment")
+
+	status, pd := profile("/api/users/by-name/tum0xa")
+	n.Require().Equal(200, status)
+	n.Require().Equal("Tum", pd.User.DisplayName)
+	n.Require().Equal("writes notes", pd.User.Bio)
+	n.Require().Equal("https://example.com", pd.User.Website)
+	n.Require().Empty(pd.User.Password)
+	status, _ = profile("/api/users/by-name/nobody")
+	n.Require().Equal(404, status)
+
+	// avatar is public while attachments of private note are not
+	n.Require().Equal(200, Must(http.Get(n.ts.URL+pd.AvatarURL)).StatusCode)
+	n.Require().Equal(403, Must(http.Get(fmt.Sprintf("%s/api/attachments/%d", n.ts.URL, text.ID))).StatusCode)
+	n.Require().Equal(200, update(user, Object{"avatar_id": 0}))
+	n.Require().Equal(403, Must(http.Get(n.ts.URL+pd.AvatarURL)).StatusCode)
+
+	// profile can't be set at signup, and avatar of another user's attachment isn't public
+	resp := Must(http.Post(n.ts.URL+"/api/users", "application/json", AsJSONBody(Object{"username": "attacker",
+		"password": "secret123", "avatar_id": photo.ID, "bio": "hi"})))
+	n.Require().Equal(200, resp.StatusCode)
+	_, attacker := profile("/api/users/by-name/attacker")
+	n.Require().Nil(attacker.User.AvatarID)
+	n.Require().Empty(attacker.User.Bio)
+	models.GetDB().Model(&models.User{}).Where("id = ?", other.ID).Update("avatar_id", photo.ID)
+	n.Require().Equal(403, Must(http.Get(n.ts.URL+pd.AvatarURL)).StatusCode)
+	models.GetDB().Model(&models.User{}).Where("id = ?", other.ID).Update("avatar_id", nil)
+
+	// removing attachment used as avatar drops avatar instead of leaving dead link
+	n.Require().Equal(200, update(user, Object{"avatar_id": photo.ID}))
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/api/me/notes/%d/attachments/%d", n.ts.URL, note.ID, photo.ID), nil)
+	AuthorizeRequest(req, user)
+	n.Require().Equal(200, Must(client.Do(req)).StatusCode)
+	_, pd = profile("/api/users/by-name/tum0xa")
+	n.Require().Nil(pd.User.AvatarID)
+	n.Require().Empty(pd.AvatarURL)
+	n.Require().Equal(200, update(user, Object{"bio": "still writes notes"}))
+
+	resp = Must(http.Get(fmt.Sprintf("%s/api/users/%d/notes", n.ts.URL, user.ID)))
+	n.Require().Equal(200, resp.StatusCode)
+	nd := &ResponseData{}
+	json.NewDecoder(resp.Body).Decode(nd)
+	n.Require().NotEmpty(nd.Pagination)
+	n.Require().Len(nd.Notes, 2)
+	n.Require().Equal("public two", nd.Notes[0].Title)
+	n.Require().Equal(404, Must(http.Get(n.ts.URL+"/api/users/12345/notes")).StatusCode)
+}
+
+func (n *NotesTestSuite) TestSparseFields() {
+	user := CreateUserTest()
+	reader := &models.User{Username: "reader", Password: "secret123"}
+	reader.Create()
+	note := &models.Note{Title: "public note", Body: "long body", UserID: user.ID, Published: true,
+		Tags: models.TagsFromNames([]string{"go"})}
+	note.Create()
+	(&models.NoteShare{NoteID: note.ID, UserID: reader.ID, Permission: models.PermissionRead}).Save(user.ID)
+
+	client := &http.Client{}
+	get := func(as *models.User, url string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("GET", n.ts.URL+url, nil)
+		if as != nil {
+			AuthorizeRequest(req, as)
+		}
+		resp := Must(client.Do(req))
+		body := map[string]interface{}{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+	keys := func(v interface{}) []string {
+		list := []string{}
+		for k := range v.(map[string]interface{}) {
+			list = append(list, k)
+		}
+		return list
+	}
+	first := func(body map[string]interface{}) map[string]interface{} {
+		notes := body["notes"].([]interface{})
+		n.Require().NotEmpty(notes)
+		return notes[0].(map[string]interface{})
+	}
+
+	status, body := get(user, "/api/me/notes?fields=title,updated_at")
+	n.Require().Equal(200, status)
+	n.Require().ElementsMatch([]string{"id", "title", "updated_at"}, keys(first(body)))
+	_, body = get(user, "/api/me/notes")
+	n.Require().NotContains(keys(first(body)), "body")
+	n.Require().Contains(keys(first(body)), "completion")
+
+	_, body = get(nil, "/api/notes?fields=title,comments_count&include=author,tags")
+	published := first(body)
+	n.Require().ElementsMatch([]string{"id", "title", "comments_count", "author", "tags"}, keys(published))
+	n.Require().Equal("tum0xa", published["author"].(map[string]interface{})["username"])
+	n.Require().Equal([]interface{}{"go"}, published["tags"])
+
+	for _, url := range []string{"/api/notes?fields=visibility", "/api/notes?include=comments",
+		"/api/me/notes?fields=title,password", fmt.Sprintf("/api/users/%d?fields=email", user.ID)} {
+		status, _ = get(user, url)
+		n.Require().Equal(400, status, url)
+	}
+
+	_, body = get(nil, fmt.Sprintf("/api/notes/%d?fields=title&include=", note.ID))
+	n.Require().ElementsMatch([]string{"id", "title"}, keys(body["note"]))
+	_, body = get(user, fmt.Sprintf("/api/me/notes/%d", note.ID))
+	n.Require().Contains(keys(body["note"]), "tags", "detail includes tags by default")
+	n.Require().Contains(keys(body["note"]), "body")
+	_, body = get(reader, "/api/me/shared-with-me?fields=title,permission")
+	n.Require().ElementsMatch([]string{"id", "title", "permission"}, keys(first(body)))
+	n.Require().Equal("read", first(body)["permission"])
+
+	_, body = get(nil, fmt.Sprintf("/api/users/%d?fields=username", user.ID))
+	n.Require().ElementsMatch([]string{"id", "username"}, keys(body["user"]))
+	_, body = get(user, "/api/me?fields=email")
+	n.Require().ElementsMatch([]string{"id", "email"}, keys(body["user"]))
+}
+
+func (n *NotesTestSuite) TestFeeds() {
+	defer func(url string) { Cfg.PublicURL = url }(Cfg.PublicURL)
+	user := CreateUserTest()
+	models.GetDB().Model(user).UpdateColumn("display_name", "Tum")
+	other := &models.User{Username: "other", Password: "secret123"}
+	other.Create()
+	note := &models.Note{Title: "markdown note", Body: "Some **bold** text", UserID: user.ID, Published: true,
+		Tags: models.TagsFromNames([]string{"go"})}
+	note.Create()
+	(&models.Note{Title: "private note", UserID: user.ID}).Create()
+	(&models.Note{Title: "other note", UserID: other.ID, Published: true}).Create()
+
+	type atom struct {
+		Updated string `xml:"updated"`
+		Entries []struct {
+			Title    string `xml:"title"`
+			ID       string `xml:"id"`
+			Author   string `xml:"author>name"`
+			Summary  string `xml:"summary"`
+			Content  string `xml:"content"`
+			Category []struct {
+				Term string `xml:"term,attr"`
+			} `xml:"category"`
+		} `xml:"entry"`
+	}
+	get := func(url string, header ...string) *http.Response {
+		req, _ := http.NewRequest("GET", n.ts.URL+url, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		if host := req.Header.Get("Host"); host != "" {
+			req.Host = host
+		}
+		return Must(http.DefaultClient.Do(req))
+	}
+
+	Cfg.PublicURL = ""
+	n.Require().Equal(404, get("/feeds/notes.atom").StatusCode, "links can't be taken from request")
+	Cfg.PublicURL = "https://notes.example/"
+	resp := get("/feeds/notes.atom", "Host", "evil.example", "X-Forwarded-Proto", "http")
+	n.Require().Equal(200, resp.StatusCode)
+	n.Require().Equal("application/atom+xml; charset=utf-8", resp.Header.Get("Content-Type"))
+	lastModified := resp.Header.Get("Last-Modified")
+	n.Require().NotEmpty(lastModified)
+	feed := &atom{}
+	n.Require().Nil(xml.NewDecoder(resp.Body).Decode(feed))
+	n.Require().Len(feed.Entries, 2, "only published notes are in feed")
+	n.Require().Equal("markdown note", feed.Entries[1].Title)
+	n.Require().Equal(fmt.Sprintf("https://notes.example/api/notes/%d", note.ID), feed.Entries[1].ID)
+	n.Require().Equal("Tum", feed.Entries[1].Author)
+	n.Require().Equal("go", feed.Entries[1].Category[0].Term)
+	n.Require().Equal("Some **bold** text", feed.Entries[1].Summary)
+	n.Require().Empty(feed.Entries[1].Content)
+
+	n.Require().Equal(304, get("/feeds/notes.atom", "If-Modified-Since", lastModified).StatusCode)
+	models.GetDB().Model(note).UpdateColumn("updated_at", time.Now().Add(time.Hour))
+	resp = get("/feeds/notes.atom", "If-Modified-Since", lastModified)
+	n.Require().Equal(200, resp.StatusCode, "feed is changed")
+	n.Require().NotEqual(lastModified, resp.Header.Get("Last-Modified"))
+
+	// Last-Modified doesn't go back when the newest note leaves feed
+	models.GetDB().Model(&models.Note{}).Where("true").UpdateColumn("updated_at", time.Now().Add(-2*time.Hour))
+	models.GetDB().Model(&models.NoteChange{}).Where("true").UpdateColumn("created_at", time.Now().Add(-3*time.Hour))
+	newest := &models.Note{Title: "newest note", UserID: other.ID, Published: true}
+	newest.Create()
+	models.GetDB().Model(newest).UpdateColumn("updated_at", time.Now().Add(-time.Hour))
+	models.GetDB().Model(&models.NoteChange{}).Where("note_id = ?", newest.ID).UpdateColumn("created_at", time.Now().Add(-time.Hour))
+	resp = get("/feeds/notes.atom")
+	feed = &atom{}
+	n.Require().Nil(xml.NewDecoder(resp.Body).Decode(feed))
+	n.Require().Equal("newest note", feed.Entries[0].Title, "ordered by publishing")
+	lastModified, etag := resp.Header.Get("Last-Modified"), resp.Header.Get("ETag")
+	n.Require().NotEmpty(etag)
+	n.Require().Equal(304, get("/feeds/notes.atom", "If-None-Match", etag).StatusCode)
+	n.Require().Nil(newest.Remove())
+	resp = get("/feeds/notes.atom", "If-Modified-Since", lastModified)
+	n.Require().Equal(200, resp.StatusCode, "removal changes feed")
+	before, _ := http.ParseTime(lastModified)
+	after, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	n.Require().True(after.After(before))
+	n.Require().NotEqual(etag, resp.Header.Get("ETag"))
+
+	// changes of private notes aren't seen through feed
+	models.GetDB().Model(&models.NoteChange{}).Where("true").UpdateColumn("created_at", time.Now().Add(-3*time.Hour))
+	lastModified = get("/feeds/notes.atom").Header.Get("Last-Modified")
+	private := &models.Note{Title: "private note", UserID: user.ID}
+	private.Create()
+	title := "private edit"
+	private.Update(&models.NotePatch{Title: &title})
+	n.Require().Equal(304, get("/feeds/notes.atom", "If-Modified-Since", lastModified).StatusCode)
+
+	feed = &atom{}
+	n.Require().Nil(xml.NewDecoder(get("/feeds/notes.atom?full=true").Body).Decode(feed))
+	n.Require().Contains(feed.Entries[1].Content, "<strong>bold</strong>")
+
+	resp = get(fmt.Sprintf("/feeds/users/%d/notes.rss", user.ID))
+	n.Require().Equal(200, resp.StatusCode)
+	n.Require().Equal("application/rss+xml; charset=utf-8", resp.Header.Get("Content-Type"))
+	rss := &struct {
+		Title string `xml:"channel>title"`
+		Items []struct {
+			Title   string `xml:"title"`
+			Creator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}{}
+	n.Require().Nil(xml.NewDecoder(resp.Body).Decode(rss))
+	n.Require().Equal("Notes of Tum", rss.Title)
+	n.Require().Len(rss.Items, 1)
+	n.Require().Equal("markdown note", rss.Items[0].Title)
+	n.Require().Equal("Tum", rss.Items[0].Creator)
+	_, err := time.Parse(time.RFC1123Z, rss.Items[0].PubDate)
+	n.Require().Nil(err)
+
+	n.Require().Equal(404, get("/feeds/users/12345/notes.atom").StatusCode)
+	n.Require().Equal(404, get("/feeds/notes.json").StatusCode)
+}
+
+func (n *NotesTestSuite) TestSitemap() {
+	defer func(size int) { Cfg.SitemapSize = size }(Cfg.SitemapSize)
+	defer func(url string) { Cfg.PublicURL = url }(Cfg.PublicURL)
+	user := CreateUserTest()
+	other := &models.User{Username: "other", Password: "secret123"}
+	other.Create()
+	for _, note := range []*models.Note{
+		{Title: "first", UserID: user.ID, Published: true},
+		{Title: "second", UserID: user.ID, Published: true},
+		{Title: "private", UserID: user.ID},
+		{Title: "of other", UserID: other.ID, Published: true},
+	} {
+		note.Create()
+	}
+
+	type urlset struct {
+		XMLName xml.Name
+		URLs    []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+		Sitemaps []struct {
+			Loc string `xml:"loc"`
+		} `xml:"sitemap"`
+	}
+	get := func(path string) (int, *urlset) {
+		resp := Must(http.Get(n.ts.URL + path))
+		set := &urlset{}
+		if resp.StatusCode == 200 {
+			n.Require().Equal("application/xml; charset=utf-8", resp.Header.Get("Content-Type"))
+			n.Require().Nil(xml.NewDecoder(resp.Body).Decode(set))
+		}
+		return resp.StatusCode, set
+	}
+	locs := func(set *urlset) []string {
+		list := []string{}
+		for _, u := range set.URLs {
+			list = append(list, strings.TrimPrefix(u.Loc, n.ts.URL))
+		}
+		for _, s := range set.Sitemaps {
+			list = append(list, strings.TrimPrefix(s.Loc, n.ts.URL))
+		}
+		return list
+	}
+
+	Cfg.PublicURL = ""
+	status, _ := get("/sitemap.xml")
+	n.Require().Equal(404, status, "links can't be taken from request")
+	robots := Must(http.Get(n.ts.URL + "/robots.txt"))
+	body, _ := ioutil.ReadAll(robots.Body)
+	n.Require().NotContains(string(body), "Sitemap:")
+
+	Cfg.PublicURL = n.ts.URL
+	status, set := get("/sitemap.xml")
+	n.Require().Equal(200, status)
+	n.Require().Equal("urlset", set.XMLName.Local)
+	n.Require().Equal([]string{"/api/notes/1", "/api/notes/2", "/api/notes/4", "/api/users/1", "/api/users/2"}, locs(set))
+	n.Require().NotEmpty(set.URLs[0].LastMod)
+
+	req, _ := http.NewRequest("GET", n.ts.URL+"/robots.txt", nil)
+	req.Host = "evil.example"
+	robots = Must(http.DefaultClient.Do(req))
+	body, _ = ioutil.ReadAll(robots.Body)
+	n.Require().Contains(string(body), "Sitemap: "+n.ts.URL+"/sitemap.xml")
+	n.Require().Contains(string(body), "Disallow: /api/me")
+
+	// too many urls for one file
+	Cfg.SitemapSize = 2
+	_, set = get("/sitemap.xml")
+	n.Require().Equal("sitemapindex", set.XMLName.Local)
+	n.Require().Equal([]string{"/sitemaps/notes-0.xml", "/sitemaps/notes-1.xml", "/sitemaps/notes-2.xml",
+		"/sitemaps/authors-0.xml", "/sitemaps/authors-1.xml"}, locs(set))
+	_, set = get("/sitemaps/notes-1.xml")
+	n.Require().Equal([]string{"/api/notes/2"}, locs(set))
+	status, _ = get("/sitemaps/notes-7.xml")
+	n.Require().Equal(404, status)
+
+	// parts are regenerated when notes are published or unpublished
+	client := &http.Client{}
+	publish := func(noteID uint, published bool) {
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("%s/api/me/notes/%d", n.ts.URL, noteID), AsJSONBody(Object{"published": published}))
+		AuthorizeRequest(req, user)
+		n.Require().Equal(200, Must(client.Do(req)).StatusCode)
+	}
+	publish(2, false)
+	n.Require().Eventually(func() bool {
+		status, _ := get("/sitemaps/notes-1.xml")
+		return status == 404
+	}, time.Second, 10*time.Millisecond)
+	publish(3, true)
+	n.Require().Eventually(func() bool {
+		_, set := get("/sitemaps/notes-1.xml")
+		return len(set.URLs) == 1 && strings.HasSuffix(set.URLs[0].Loc, "/api/notes/3")
+	}, time.Second, 10*time.Millisecond)
+}
+
 func (n *NotesTestSuite) TestNotePublishedDetail() {
 	user := CreateUserTest()
 	note := &models.Note{
@@ -406,6 +1865,1062 @@ func (n *NotesTestSuite) TestBrokenDB() {
 	n.Require().NotEmpty(rd.Message)
 }
 
+func (n *NotesTestSuite) TestShareLink() {
+	user := CreateUserTest()
+	note := &models.Note{
+		Title:      "secret stuff",
+		Body:       "only for friends",
+		UserID:     user.ID,
+		Visibility: models.VisibilityUnlisted,
+	}
+	note.Create()
+	n.Require().False(note.Published, "unlisted note should not be published")
+
+	client := &http.Client{}
+	shareURL := fmt.Sprintf(n.ts.URL+"/api/me/notes/%d/shares", note.ID)
+
+	req, _ := http.NewRequest("POST", shareURL, AsJSONBody(Object{"password": "letmein", "max_views": 1}))
+	AuthorizeRequest(req, user)
+	resp := Must(client.Do(req))
+	n.Require().Equal(200, resp.StatusCode)
+
+	rd := &struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		URL     string `json:"url"`
+	}{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+	n.Require().True(rd.Success, rd.Message)
+	n.Require().NotEmpty(rd.URL)
+
+	resp = Must(http.Get(n.ts.URL + rd.URL))
+	n.Require().Equal(403, resp.StatusCode, "password is required")
+	resp = Must(http.Get(n.ts.URL + rd.URL + "?password=letmein"))
+	n.Require().Equal(403, resp.StatusCode, "password isn't taken from url")
+
+	req, _ = http.NewRequest("GET", n.ts.URL+rd.URL, nil)
+	req.Header.Set("X-Share-Password", "letmein")
+	resp = Must(client.Do(req))
+	n.Require().Equal(200, resp.StatusCode)
+	nd := &ResponseData{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(nd))
+	n.Require().Equal(note.Body, nd.Note.Body)
+
+	req, _ = http.NewRequest("GET", n.ts.URL+rd.URL, nil)
+	req.Header.Set("X-Share-Password", "letmein")
+	resp = Must(client.Do(req))
+	n.Require().Equal(410, resp.StatusCode, "view limit is reached")
+
+	resp = Must(http.Get(n.ts.URL + "/api/shared/not-a-real-token"))
+	n.Require().Equal(404, resp.StatusCode)
+
+	resp = Must(http.Get(fmt.Sprintf(n.ts.URL+"/api/notes/%d", note.ID)))
+	n.Require().Equal(404, resp.StatusCode, "unlisted note is not public")
+
+	private := &models.Note{Title: "private one", UserID: user.ID}
+	private.Create()
+	req, _ = http.NewRequest("POST", fmt.Sprintf(n.ts.URL+"/api/me/notes/%d/shares", private.ID), AsJSONBody(Object{}))
+	AuthorizeRequest(req, user)
+	resp = Must(client.Do(req))
+	n.Require().Equal(422, resp.StatusCode)
+
+	// note published before visibility was added can be shared after migration
+	legacy := &models.Note{Title: "old public", UserID: user.ID, Published: true}
+	legacy.Create()
+	models.GetDB().Model(legacy).UpdateColumn("visibility", models.VisibilityPrivate)
+	models.Migrate()
+	req, _ = http.NewRequest("POST", fmt.Sprintf(n.ts.URL+"/api/me/notes/%d/shares", legacy.ID), AsJSONBody(Object{}))
+	AuthorizeRequest(req, user)
+	resp = Must(client.Do(req))
+	n.Require().Equal(200, resp.StatusCode)
+}
+
+func (n *NotesTestSuite) TestShareLinkExpired() {
+	user := CreateUserTest()
+	note := &models.Note{Title: "short living", UserID: user.ID, Visibility: models.VisibilityUnlisted}
+	note.Create()
+
+	link := &models.ShareLink{NoteID: note.ID}
+	n.Require().Nil(link.Create())
+	models.GetDB().Model(link).Update("expires_at", time.Now().Add(-time.Minute))
+
+	resp := Must(http.Get(n.ts.URL + "/api/shared/" + link.Token))
+	n.Require().Equal(410, resp.StatusCode)
+}
+
+func (n *NotesTestSuite) TestCollaborators() {
+	owner := CreateUserTest()
+	friend := &models.User{Username: "friend", Password: "password"}
+	friend.Create()
+	stranger := &models.User{Username: "stranger", Password: "password"}
+	stranger.Create()
+
+	note := &models.Note{Title: "team notes", Body: "agenda", UserID: owner.ID}
+	note.Create()
+	noteURL := fmt.Sprintf(n.ts.URL+"/api/me/notes/%d", note.ID)
+
+	client := &http.Client{}
+	do := func(method, url string, user *models.User, body io.Reader) *http.Response {
+		req, _ := http.NewRequest(method, url, body)
+		AuthorizeRequest(req, user)
+		return Must(client.Do(req))
+	}
+
+	resp := do("POST", noteURL+"/collaborators", owner, AsJSONBody(Object{"username": "friend", "permission": "read"}))
+	n.Require().Equal(200, resp.StatusCode)
+
+	n.Require().Equal(200, do("GET", noteURL, friend, nil).StatusCode)
+	n.Require().Equal(404, do("GET", noteURL, stranger, nil).StatusCode)
+	n.Require().Equal(403, do("PUT", noteURL, friend, AsJSONBody(Object{"body": "hacked"})).StatusCode)
+
+	resp = do("POST", noteURL+"/collaborators", owner, AsJSONBody(Object{"user_id": friend.ID, "permission": "write"}))
+	n.Require().Equal(200, resp.StatusCode)
+
+	n.Require().Equal(200, do("PUT", noteURL, friend, AsJSONBody(Object{"body": "new agenda"})).StatusCode)
+	models.GetDB().Take(note)
+	n.Require().Equal("new agenda", note.Body)
+	n.Require().Equal(owner.ID, note.UserID, "owner should not change")
+
+	n.Require().Equal(403, do("PUT", noteURL, friend, AsJSONBody(Object{"published": true})).StatusCode)
+	n.Require().Equal(403, do("DELETE", noteURL, friend, nil).StatusCode)
+
+	resp = do("GET", n.ts.URL+"/api/me/shared-with-me", friend, nil)
+	n.Require().Equal(200, resp.StatusCode)
+	rd := &struct {
+		Notes []map[string]interface{} `json:"notes"`
+	}{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+	n.Require().Len(rd.Notes, 1)
+	n.Require().Equal("write", rd.Notes[0]["permission"])
+
+	resp = do("DELETE", fmt.Sprintf(noteURL+"/collaborators/%d", friend.ID), owner, nil)
+	n.Require().Equal(200, resp.StatusCode)
+	n.Require().Equal(404, do("GET", noteURL, friend, nil).StatusCode)
+}
+
+func (n *NotesTestSuite) TestLiveNote() {
+	owner := CreateUserTest()
+	friend := &models.User{Username: "friend", Password: "password"}
+	friend.Create()
+	note := &models.Note{Title: "live note", Body: "hello", UserID: owner.ID}
+	note.Create()
+	(&models.NoteShare{NoteID: note.ID, UserID: friend.ID, Permission: models.PermissionWrite}).Save(owner.ID)
+
+	dial := func(user *models.User) *websocket.Conn {
+		url := fmt.Sprintf("ws%s/api/me/notes/%d/live", strings.TrimPrefix(n.ts.URL, "http"), note.ID)
+		dialer := &websocket.Dialer{Subprotocols: []string{"access_token", models.GenerateToken(user.ID)}}
+		conn, resp, err := dialer.Dial(url, nil)
+		n.Require().Nil(err)
+		n.Require().Equal("access_token", resp.Header.Get("Sec-WebSocket-Protocol"))
+		return conn
+	}
+	readUntil := func(conn *websocket.Conn, typ string) *live.Message {
+		for {
+			msg := &live.Message{}
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			n.Require().Nil(conn.ReadJSON(msg))
+			if msg.Type == typ {
+				return msg
+			}
+		}
+	}
+
+	a := dial(owner)
+	init := readUntil(a, "init")
+	n.Require().Equal("hello", init.Body)
+	b := dial(friend)
+	n.Require().Equal(0, readUntil(b, "init").Rev)
+	n.Require().Len(readUntil(a, "presence").Users, 2)
+
+	// both edits are based on revision 0
+	n.Require().Nil(a.WriteJSON(Object{"type": "op", "rev": 0, "op": []interface{}{5, " world"}}))
+	n.Require().Nil(b.WriteJSON(Object{"type": "op", "rev": 0, "op": []interface{}{"> ", 5}}))
+	readUntil(a, "ack")
+	readUntil(b, "ack")
+
+	n.Require().Nil(b.WriteJSON(Object{"type": "op", "rev": 0, "op": []interface{}{-3}}))
+	n.Require().NotEmpty(readUntil(b, "error").Message, "op doesn't match document")
+
+	// op based on revision dropped from history gets body resent
+	b.Close() // would be dropped as slow client otherwise
+	for rev := 2; rev < 602; rev += 2 {
+		n.Require().Nil(a.WriteJSON(Object{"type": "op", "rev": rev, "op": []interface{}{13, "!"}}))
+		n.Require().Equal(rev+1, readUntil(a, "ack").Rev)
+		n.Require().Nil(a.WriteJSON(Object{"type": "op", "rev": rev + 1, "op": []interface{}{13, -1}}))
+		n.Require().Equal(rev+2, readUntil(a, "ack").Rev)
+	}
+	b = dial(friend)
+	readUntil(b, "init")
+	n.Require().Nil(b.WriteJSON(Object{"type": "op", "rev": 2, "op": []interface{}{"x"}}))
+	resync := readUntil(b, "reset")
+	n.Require().Equal(602, resync.Rev)
+	n.Require().Equal("> hello world", resync.Body)
+	readUntil(b, "error")
+
+	// downgraded collaborator can't edit, revoked one is disconnected
+	authorized := func(req *http.Request) *http.Request {
+		AuthorizeRequest(req, owner)
+		return req
+	}
+	invite, _ := http.NewRequest("POST", fmt.Sprintf("%s/api/me/notes/%d/collaborators", n.ts.URL, note.ID),
+		AsJSONBody(Object{"user_id": friend.ID, "permission": "read"}))
+	n.Require().Equal(200, Must(http.DefaultClient.Do(authorized(invite))).StatusCode)
+	n.Require().Nil(b.WriteJSON(Object{"type": "op", "rev": 602, "op": []interface{}{"x", 13}}))
+	n.Require().Contains(readUntil(b, "error").Message, "no write access")
+	revoke, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/api/me/notes/%d/collaborators/%d", n.ts.URL, note.ID, friend.ID), nil)
+	n.Require().Equal(200, Must(http.DefaultClient.Do(authorized(revoke))).StatusCode)
+	b.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := b.ReadMessage(); err != nil {
+			netErr, ok := err.(net.Error)
+			n.Require().False(ok && netErr.Timeout(), "revoked collaborator should be disconnected")
+			break
+		}
+	}
+
+	a.Close()
+	b.Close()
+
+	expected := "> hello world"
+	for i := 0; i < 50 && note.Body != expected; i++ {
+		time.Sleep(20 * time.Millisecond)
+		models.GetDB().Take(note)
+	}
+	n.Require().Equal(expected, note.Body, "merged body should be saved on last disconnect")
+
+	// edit made outside of session isn't overwritten, session is reset to it
+	interval := Cfg.LiveSaveInterval
+	Cfg.LiveSaveInterval = 50 * time.Millisecond
+	defer func() { Cfg.LiveSaveInterval = interval }()
+	a = dial(owner)
+	defer a.Close()
+	n.Require().Equal(expected, readUntil(a, "init").Body)
+
+	// change of other fields isn't a conflict
+	title := "renamed"
+	n.Require().Nil((&models.Note{Model: models.Model{ID: note.ID}, UserID: owner.ID}).Update(&models.NotePatch{Title: &title}))
+	n.Require().Nil(a.WriteJSON(Object{"type": "op", "rev": 0, "op": []interface{}{13, "!"}}))
+	readUntil(a, "ack")
+	for i := 0; i < 50 && note.Body != expected+"!"; i++ {
+		time.Sleep(20 * time.Millisecond)
+		models.GetDB().Take(note)
+	}
+	n.Require().Equal(expected+"!", note.Body)
+	n.Require().Equal(title, note.Title)
+
+	restBody := "edited by rest"
+	n.Require().Nil((&models.Note{Model: models.Model{ID: note.ID}, UserID: owner.ID}).Update(&models.NotePatch{Body: &restBody}))
+	n.Require().Nil(a.WriteJSON(Object{"type": "op", "rev": 1, "op": []interface{}{"!", 14}}))
+	readUntil(a, "ack")
+	reset := readUntil(a, "reset")
+	n.Require().Equal(restBody, reset.Body)
+	n.Require().Equal(3, reset.Rev)
+	models.GetDB().Take(note)
+	n.Require().Equal(restBody, note.Body)
+}
+
+type sseEvent struct {
+	ID, Type string
+}
+
+func readSSEEvent(r *bufio.Reader) sseEvent {
+	e := sseEvent{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			panic("when reading event stream: " + err.Error())
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.Type != "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.Type = strings.TrimPrefix(line, "event: ")
+		}
+	}
+}
+
+func (n *NotesTestSuite) TestEventsStream() {
+	user := CreateUserTest()
+	another := &models.User{Username: "another", Password: "password"}
+	another.Create()
+
+	client := &http.Client{}
+	open := func(lastEventID string) (*http.Response, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, "GET", n.ts.URL+"/api/me/events", nil)
+		AuthorizeRequest(req, user)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp := Must(client.Do(req))
+		n.Require().Equal(200, resp.StatusCode)
+		n.Require().Equal("text/event-stream", resp.Header.Get("Content-Type"))
+		return resp, cancel
+	}
+
+	resp, cancel := open("")
+	stream := bufio.NewReader(resp.Body)
+
+	(&models.Note{Title: "not mine", UserID: another.ID}).Create()
+	note := &models.Note{Title: "live title", UserID: user.ID}
+	note.Create()
+	created := readSSEEvent(stream)
+	n.Require().Equal("note.created", created.Type)
+
+	published := true
+	(&models.Note{Model: models.Model{ID: note.ID}, UserID: user.ID}).Update(&models.NotePatch{Published: &published})
+	n.Require().Equal("note.updated", readSSEEvent(stream).Type)
+	n.Require().Equal("note.published", readSSEEvent(stream).Type)
+	cancel()
+	resp.Body.Close()
+
+	resp, cancel = open(created.ID)
+	defer cancel()
+	defer resp.Body.Close()
+	stream = bufio.NewReader(resp.Body)
+	n.Require().Equal("note.updated", readSSEEvent(stream).Type, "missed events should be resent")
+	n.Require().Equal("note.published", readSSEEvent(stream).Type)
+
+	(&models.Note{Model: models.Model{ID: note.ID}, UserID: user.ID}).Remove()
+	n.Require().Equal("note.deleted", readSSEEvent(stream).Type)
+}
+
+func (n *NotesTestSuite) TestWebhooks() {
+	user := CreateUserTest()
+
+	type received struct {
+		event, signature string
+		body             []byte
+	}
+	var mu sync.Mutex
+	hits := []received{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		hits = append(hits, received{r.Header.Get("X-Notes-Event"), r.Header.Get("X-Notes-Signature"), body})
+		if len(hits) == 1 {
+			w.WriteHeader(500) // first attempt fails, delivery should be retried
+		}
+	}))
+	defer receiver.Close()
+	waitHits := func(count int) []received {
+		for i := 0; i < 100; i++ {
+			mu.Lock()
+			if len(hits) >= count {
+				defer mu.Unlock()
+				return hits
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+		}
+		n.FailNow("webhook is not delivered")
+		return nil
+	}
+
+	client := &http.Client{}
+	createHook := func(url string) (int, uint, string) {
+		req, _ := http.NewRequest("POST", n.ts.URL+"/api/me/webhooks",
+			AsJSONBody(Object{"url": url, "events": []string{"note.created"}}))
+		AuthorizeRequest(req, user)
+		resp := Must(client.Do(req))
+		rd := &struct {
+			Webhook struct {
+				models.Webhook
+				Secret string `json:"secret"`
+			} `json:"webhook"`
+		}{}
+		json.NewDecoder(resp.Body).Decode(rd)
+		return resp.StatusCode, rd.Webhook.ID, rd.Webhook.Secret
+	}
+
+	// receiver is on loopback, it's refused by default
+	status, blockedID, _ := createHook(receiver.URL)
+	n.Require().Equal(200, status)
+	req, _ := http.NewRequest("POST", fmt.Sprintf(n.ts.URL+"/api/me/webhooks/%d/test", blockedID), nil)
+	AuthorizeRequest(req, user)
+	n.Require().Equal(200, Must(client.Do(req)).StatusCode)
+	blocked := &models.WebhookDelivery{}
+	for i := 0; i < 100 && blocked.Error == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+		models.GetDB().Where("webhook_id = ?", blockedID).Take(blocked)
+	}
+	n.Require().Contains(blocked.Error, "not allowed")
+	mu.Lock()
+	n.Require().Empty(hits)
+	mu.Unlock()
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf(n.ts.URL+"/api/me/webhooks/%d", blockedID), nil)
+	AuthorizeRequest(req, user)
+	n.Require().Equal(200, Must(client.Do(req)).StatusCode)
+
+	defer func(allow bool) { Cfg.WebhookAllowPrivate = allow }(Cfg.WebhookAllowPrivate)
+	Cfg.WebhookAllowPrivate = true
+	status, hookID, secret := createHook(receiver.URL)
+	n.Require().Equal(200, status)
+	n.Require().NotEmpty(secret, "secret should be generated")
+	req, _ = http.NewRequest("GET", n.ts.URL+"/api/me/webhooks", nil)
+	AuthorizeRequest(req, user)
+	listed, _ := ioutil.ReadAll(Must(client.Do(req)).Body)
+	n.Require().NotContains(string(listed), secret, "secret is shown only on create")
+
+	(&models.Note{Title: "hooked note", UserID: user.ID}).Create()
+
+	got := waitHits(2)
+	n.Require().Equal("note.created", got[1].event)
+	n.Require().Equal(webhooks.Sign(secret, got[1].body), got[1].signature)
+	payload := &webhooks.Payload{}
+	n.Require().Nil(json.Unmarshal(got[1].body, payload))
+	n.Require().Equal("hooked note", payload.Note.Title)
+
+	delivery := &models.WebhookDelivery{}
+	for i := 0; i < 100 && delivery.Status != models.DeliveryDelivered; i++ {
+		time.Sleep(10 * time.Millisecond)
+		models.GetDB().Where("webhook_id = ?", hookID).Take(delivery)
+	}
+	n.Require().Equal(models.DeliveryDelivered, delivery.Status)
+	n.Require().Equal(2, delivery.Attempts)
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf(n.ts.URL+"/api/me/webhooks/%d/test", hookID), nil)
+	AuthorizeRequest(req, user)
+	n.Require().Equal(200, Must(client.Do(req)).StatusCode)
+	n.Require().Equal(webhooks.TestEvent, waitHits(3)[2].event)
+
+	status, _, _ = createHook("ftp://example.com")
+	n.Require().Equal(422, status)
+
+	req, _ = http.NewRequest("PUT", fmt.Sprintf(n.ts.URL+"/api/me/webhooks/%d", hookID), AsJSONBody(Object{"secret": ""}))
+	AuthorizeRequest(req, user)
+	n.Require().Equal(422, Must(client.Do(req)).StatusCode, "deliveries can't be unsigned")
+
+	// leased delivery is attempted only by one dispatcher until lease expires
+	pending := &models.WebhookDelivery{WebhookID: hookID, Event: webhooks.TestEvent}
+	pending.Create()
+	now := time.Now()
+	models.GetDB().Model(pending).UpdateColumn("next_attempt_at", now.Add(time.Hour)) // out of reach of running dispatcher
+	first, second := *pending, *pending
+	claimed, err := first.Claim(now, time.Minute)
+	n.Require().Nil(err)
+	n.Require().True(claimed)
+	claimed, _ = second.Claim(now, time.Minute)
+	n.Require().False(claimed)
+	due, _ := models.DueDeliveries(now.Add(2*time.Hour), 10)
+	n.Require().Len(due, 1)
+	claimed, _ = due[0].Claim(now.Add(2*time.Hour), time.Minute)
+	n.Require().True(claimed, "expired lease is taken")
+	n.Require().NotNil(first.Release(), "result of expired lease isn't saved")
+	n.Require().Nil(due[0].Release())
+}
+
+type SyncData struct {
+	Notes []struct {
+		models.Note
+		Seq uint64 `json:"seq"`
+	} `json:"notes"`
+	Deleted []struct {
+		ID  uint   `json:"id"`
+		Seq uint64 `json:"seq"`
+	} `json:"deleted"`
+	Token   string              `json:"token"`
+	Results []models.SyncResult `json:"results"`
+}
+
+func (n *NotesTestSuite) TestSync() {
+	user := CreateUserTest()
+	kept := &models.Note{Title: "kept note", UserID: user.ID}
+	kept.Create()
+	removed := &models.Note{Title: "removed note", UserID: user.ID}
+	removed.Create()
+
+	client := &http.Client{}
+	sync := func(method, query string, body io.Reader) *SyncData {
+		req, _ := http.NewRequest(method, n.ts.URL+"/api/me/sync"+query, body)
+		AuthorizeRequest(req, user)
+		resp := Must(client.Do(req))
+		n.Require().Equal(200, resp.StatusCode)
+		sd := &SyncData{}
+		n.Require().Nil(json.NewDecoder(resp.Body).Decode(sd))
+		return sd
+	}
+
+	full := sync("GET", "", nil)
+	n.Require().Len(full.Notes, 2)
+	n.Require().Empty(full.Deleted)
+	baseSeq := full.Notes[0].Seq
+	if full.Notes[0].ID != kept.ID {
+		baseSeq = full.Notes[1].Seq
+	}
+
+	title := "changed title"
+	(&models.Note{Model: models.Model{ID: kept.ID}, UserID: user.ID}).Update(&models.NotePatch{Title: &title})
+	removed.Remove()
+
+	delta := sync("GET", "?since="+full.Token, nil)
+	n.Require().Len(delta.Notes, 1)
+	n.Require().Equal(title, delta.Notes[0].Title)
+	n.Require().Len(delta.Deleted, 1)
+	n.Require().Equal(removed.ID, delta.Deleted[0].ID)
+	n.Require().Empty(sync("GET", "?since="+delta.Token, nil).Notes)
+
+	push := sync("POST", "", AsJSONBody(Object{"changes": []Object{
+		{"client_id": "new", "title": "offline note"},
+		{"client_id": "stale", "id": kept.ID, "base_seq": baseSeq, "body": "stale edit"},
+		{"client_id": "fresh", "id": kept.ID, "base_seq": delta.Notes[0].Seq, "body": "fresh edit"},
+		{"client_id": "gone", "id": removed.ID, "base_seq": baseSeq, "body": "edit of removed"},
+		{"client_id": "invalid", "title": "no"},
+	}}))
+	statuses := map[string]string{}
+	for _, res := range push.Results {
+		statuses[res.ClientID] = res.Status
+	}
+	n.Require().Equal(map[string]string{
+		"new":     models.SyncCreated,
+		"stale":   models.SyncConflict,
+		"fresh":   models.SyncUpdated,
+		"gone":    models.SyncConflict,
+		"invalid": models.SyncError,
+	}, statuses)
+	n.Require().Equal(title, push.Results[1].Note.Title, "conflict should report server version")
+
+	models.GetDB().Take(kept)
+	n.Require().Equal("fresh edit", kept.Body)
+
+	// note changed between conflict check and write is not overwritten
+	stale := kept.UpdatedAt.Add(-time.Second)
+	body := "late edit"
+	note := &models.Note{Model: models.Model{ID: kept.ID}, UserID: user.ID}
+	n.Require().Equal(models.ErrNoteChanged, note.Update(&models.NotePatch{Body: &body, IfUpdatedAt: &stale}))
+	note = &models.Note{Model: models.Model{ID: kept.ID}, UserID: user.ID}
+	n.Require().Equal(models.ErrNoteChanged, note.RemoveIfUpdatedAt(stale))
+	models.GetDB().Take(kept)
+	n.Require().Equal("fresh edit", kept.Body)
+	note = &models.Note{Model: models.Model{ID: kept.ID}, UserID: user.ID}
+	n.Require().Nil(note.Update(&models.NotePatch{Body: &body, IfUpdatedAt: &kept.UpdatedAt}))
+}
+
+func (n *NotesTestSuite) importNotes(user *models.User, contentType string, data []byte) *models.ImportJob {
+	req, _ := http.NewRequest("POST", n.ts.URL+"/api/me/import", bytes.NewReader(data))
+	req.Header.Set("Content-Type", contentType)
+	AuthorizeRequest(req, user)
+	resp := Must((&http.Client{}).Do(req))
+	n.Require().Equal(202, resp.StatusCode)
+
+	rd := &struct {
+		Job models.ImportJob `json:"job"`
+	}{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+
+	for i := 0; i < 100; i++ {
+		req, _ := http.NewRequest("GET", fmt.Sprintf(n.ts.URL+"/api/me/import/%d", rd.Job.ID), nil)
+		AuthorizeRequest(req, user)
+		resp := Must((&http.Client{}).Do(req))
+		n.Require().Equal(200, resp.StatusCode)
+		n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+		if rd.Job.Status == models.ImportDone || rd.Job.Status == models.ImportFailed {
+			return &rd.Job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	n.FailNow("import is not finished")
+	return nil
+}
+
+func (n *NotesTestSuite) TestImportMarkdown() {
+	user := CreateUserTest()
+
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	files := []struct{ name, content string }{
+		{"notes/meeting.md", "---\ntitle: \"Weekly meeting\"\ntags: [work, Meeting]\npublished: true\n---\n\nagenda"},
+		{"todo.md", "# Shopping list\n\n- milk\n- bread\n"},
+		{"long.md", "---\ntitle: " + strings.Repeat("x", Cfg.TitleLength+1) + "\n---\nbody"},
+		{"picture.png", "not markdown"},
+	}
+	for _, f := range files {
+		w, _ := zw.Create(f.name)
+		w.Write([]byte(f.content))
+	}
+	zw.Close()
+
+	job := n.importNotes(user, "application/zip", archive.Bytes())
+	n.Require().Equal(models.ImportDone, job.Status)
+	n.Require().Equal(4, job.Total)
+	n.Require().Equal(2, job.Imported)
+	n.Require().Equal(2, job.Failed)
+	failed := []string{}
+	for _, e := range job.Errors {
+		failed = append(failed, e.File)
+	}
+	n.Require().ElementsMatch([]string{"long.md", "picture.png"}, failed)
+
+	meeting := &models.Note{}
+	n.Require().Nil(models.GetDB().Where("title = ?", "Weekly meeting").Take(meeting).Error)
+	n.Require().True(meeting.Published)
+	n.Require().Equal("agenda", meeting.Body)
+	n.Require().Nil(meeting.LoadTags())
+	n.Require().ElementsMatch([]string{"work", "meeting"}, []string{meeting.Tags[0].Name, meeting.Tags[1].Name})
+
+	todo := &models.Note{}
+	n.Require().Nil(models.GetDB().Where("title = ?", "Shopping list").Take(todo).Error)
+	n.Require().Equal("- milk\n- bread", todo.Body)
+}
+
+func (n *NotesTestSuite) TestImportLimits() {
+	user := CreateUserTest()
+	archive := func(count int, name, content string) []byte {
+		b := &bytes.Buffer{}
+		zw := zip.NewWriter(b)
+		for i := 0; i < count; i++ {
+			w, _ := zw.Create(fmt.Sprintf(name, i))
+			w.Write([]byte(content))
+		}
+		zw.Close()
+		return b.Bytes()
+	}
+	defer func(files int, unpacked int64) {
+		Cfg.ImportMaxFiles, Cfg.ImportMaxUnpacked = files, unpacked
+	}(Cfg.ImportMaxFiles, Cfg.ImportMaxUnpacked)
+	Cfg.ImportMaxFiles, Cfg.ImportMaxUnpacked = 150, 1000
+
+	job := n.importNotes(user, "application/zip", archive(151, "%d.md", "text"))
+	n.Require().Equal(models.ImportFailed, job.Status)
+	job = n.importNotes(user, "application/zip", archive(3, "note %d.md", strings.Repeat("x", 400)))
+	n.Require().Equal(models.ImportFailed, job.Status)
+	n.Require().Zero(job.Imported, "nothing is imported from bomb")
+
+	// errors report is limited, failures are still counted
+	job = n.importNotes(user, "application/zip", archive(120, "%d.txt", ""))
+	n.Require().Equal(models.ImportDone, job.Status)
+	n.Require().Equal(120, job.Failed)
+	n.Require().Len(job.Errors, models.MaxImportErrors)
+
+	// the same cap is applied to notes of json and enex
+	job = n.importNotes(user, "application/json", []byte("["+strings.TrimSuffix(strings.Repeat(`{"title": "many"},`, 151), ",")+"]"))
+	n.Require().Equal(models.ImportFailed, job.Status)
+	n.Require().Zero(job.Imported)
+	job = n.importNotes(user, "application/xml", []byte("<en-export>"+strings.Repeat("<note><title>many</title></note>", 151)+"</en-export>"))
+	n.Require().Equal(models.ImportFailed, job.Status)
+	n.Require().Zero(job.Imported)
+}
+
+func (n *NotesTestSuite) TestImportENEXAndJSON() {
+	user := CreateUserTest()
+
+	enex := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export>
+<note><title>From evernote</title><content><![CDATA[<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note><div>first&nbsp;line</div><div><en-todo checked="true"/>done</div></en-note>]]></content><tag>imported</tag></note>
+</en-export>`
+	job := n.importNotes(user, "application/xml", []byte(enex))
+	n.Require().Equal(1, job.Imported, job.Errors)
+	note := &models.Note{}
+	n.Require().Nil(models.GetDB().Where("title = ?", "From evernote").Take(note).Error)
+	n.Require().Equal("first\u00a0line\n[x] done", note.Body)
+
+	job = n.importNotes(user, "application/json", []byte(`[{"title": "from json", "body": "text"}, {"title": ""}]`))
+	n.Require().Equal(1, job.Imported)
+	n.Require().Equal(1, job.Failed)
+
+	job = n.importNotes(user, "application/json", []byte(`{broken`))
+	n.Require().Equal(models.ImportFailed, job.Status)
+
+	// job running when server stopped can't be finished
+	running := &models.ImportJob{UserID: user.ID, Format: importer.FormatJSON}
+	running.Create()
+	running.Status = models.ImportRunning
+	running.Save()
+	n.Require().Nil(importer.FailInterrupted())
+	n.Require().Nil(running.Get())
+	n.Require().Equal(models.ImportFailed, running.Status)
+	n.Require().Len(running.Errors, 1)
+	n.Require().Nil(job.Get())
+	n.Require().Len(job.Errors, 1, "finished job is kept")
+}
+
+func (n *NotesTestSuite) TestNoteExport() {
+	user := CreateUserTest()
+	note := &models.Note{
+		Title:  "Plan: <Q3> release!",
+		Body:   "## Steps\n\n- **ship** it\n- see [docs](https://example.com)\n\n<script>alert(1)</script>",
+		UserID: user.ID,
+		Tags:   models.TagsFromNames([]string{"work"}),
+	}
+	note.Create()
+	other := &models.Note{Title: "second", Body: "more", UserID: user.ID}
+	other.Create()
+
+	client := &http.Client{}
+	export := func(url, accept string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", n.ts.URL+url, nil)
+		AuthorizeRequest(req, user)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp := Must(client.Do(req))
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	noteURL := fmt.Sprintf("/api/me/notes/%d", note.ID)
+
+	resp, body := export(noteURL+"/export?format=markdown", "")
+	n.Require().Equal(200, resp.StatusCode)
+	n.Require().Equal("text/markdown; charset=utf-8", resp.Header.Get("Content-Type"))
+	n.Require().Equal(`attachment; filename=plan-q3-release.md`, resp.Header.Get("Content-Disposition"))
+	n.Require().True(strings.HasPrefix(body, "# Plan: <Q3> release!\n\nTags: work\n\n## Steps"), body)
+
+	resp, body = export(noteURL+"/export?format=text", "")
+	n.Require().Equal(200, resp.StatusCode)
+	n.Require().Contains(resp.Header.Get("Content-Disposition"), "plan-q3-release.txt")
+	n.Require().True(strings.HasPrefix(body, "Plan: <Q3> release!\n==================="), body)
+
+	resp, body = export(noteURL+"/export?format=html", "")
+	n.Require().Equal("text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	n.Require().Contains(body, "<title>Plan: &lt;Q3&gt; release!</title>")
+	n.Require().Contains(body, "<h2>Steps</h2>")
+	n.Require().Contains(body, "<li><strong>ship</strong> it</li>")
+	n.Require().Contains(body, `<a href="https://example.com">docs</a>`)
+	n.Require().Contains(body, "&lt;script&gt;")
+	n.Require().NotContains(body, "<script>")
+	n.Require().NotContains(body, "@media print")
+
+	_, body = export(noteURL+"/export?format=print", "")
+	n.Require().Contains(body, "@media print")
+
+	resp, _ = export(noteURL+"/export?format=pdf", "")
+	n.Require().Equal(400, resp.StatusCode)
+	resp, _ = export(fmt.Sprintf("/api/me/notes/%d/export", other.ID+1), "")
+	n.Require().Equal(404, resp.StatusCode)
+
+	// content negotiation
+	resp, body = export(noteURL, "text/plain;q=0.5, text/markdown")
+	n.Require().Equal("text/markdown; charset=utf-8", resp.Header.Get("Content-Type"))
+	n.Require().Equal("inline; filename=plan-q3-release.md", resp.Header.Get("Content-Disposition"))
+	n.Require().Equal("Accept", resp.Header.Get("Vary"))
+	resp, _ = export(noteURL, "text/html")
+	n.Require().Equal("text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	resp, _ = export(noteURL, "application/json, text/plain;q=0.9")
+	n.Require().Equal("application/json", resp.Header.Get("Content-Type"))
+	n.Require().Equal("Accept", resp.Header.Get("Vary"), "json is negotiated as well")
+
+	resp, body = export("/api/me/notes/export?format=markdown", "")
+	n.Require().Equal(200, resp.StatusCode)
+	n.Require().Contains(resp.Header.Get("Content-Disposition"), "filename="+user.Username+"-notes.md")
+	n.Require().Contains(body, "# Plan: <Q3> release!")
+	n.Require().Contains(body, "\n---\n\n# second\n\nmore")
+}
+
+func (n *NotesTestSuite) uploadAttachment(user *models.User, noteID uint, filename string, content []byte) *http.Response {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write(content)
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/api/me/notes/%d/attachments", n.ts.URL, noteID), body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	AuthorizeRequest(req, user)
+	return Must(http.DefaultClient.Do(req))
+}
+
+type AttachmentData struct {
+	ResponseData
+	Attachment  models.Attachment   `json:"attachment"`
+	Attachments []models.Attachment `json:"attachments"`
+	Storage     struct {
+		Used  int64 `json:"used"`
+		Quota int64 `json:"quota"`
+	} `json:"storage"`
+}
+
+func (n *NotesTestSuite) storageUsed(user *models.User) int64 {
+	req, _ := http.NewRequest("GET", n.ts.URL+"/api/me", nil)
+	AuthorizeRequest(req, user)
+	rd := &AttachmentData{}
+	n.Require().Nil(json.NewDecoder(Must(http.DefaultClient.Do(req)).Body).Decode(rd))
+	return rd.Storage.Used
+}
+
+func (n *NotesTestSuite) TestAttachments() {
+	user := CreateUserTest()
+	note := &models.Note{Title: "with files", Body: "see attached", UserID: user.ID}
+	note.Create()
+
+	resp := n.uploadAttachment(user, note.ID, "../hello.txt", []byte("hello world"))
+	n.Require().Equal(200, resp.StatusCode)
+	rd := &AttachmentData{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+	n.Require().True(rd.Success, rd.Message)
+	text := rd.Attachment
+	n.Require().Equal("hello.txt", text.Filename)
+	n.Require().Equal("text/plain; charset=utf-8", text.ContentType)
+	n.Require().Equal(int64(11), text.Size)
+	n.Require().Contains(text.URL, "sig=")
+	n.Require().Equal(int64(11), n.storageUsed(user))
+
+	resp = Must(http.Get(n.ts.URL + text.URL))
+	n.Require().Equal(200, resp.StatusCode)
+	content, _ := ioutil.ReadAll(resp.Body)
+	n.Require().Equal("hello world", string(content))
+	n.Require().Equal("inline; filename=hello.txt", resp.Header.Get("Content-Disposition"))
+
+	// client content type is ignored, html is never shown inline
+	resp = n.uploadAttachment(user, note.ID, "page.png", []byte("<html><script>alert(1)</script></html>"))
+	rd = &AttachmentData{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+	page := rd.Attachment
+	n.Require().Equal("text/html; charset=utf-8", page.ContentType)
+	resp = Must(http.Get(n.ts.URL + page.URL))
+	n.Require().Equal(200, resp.StatusCode)
+	n.Require().Equal("attachment; filename=page.png", resp.Header.Get("Content-Disposition"))
+
+	resp = Must(http.Get(n.ts.URL + strings.Replace(text.URL, "sig=", "sig=x", 1)))
+	n.Require().Equal(403, resp.StatusCode)
+	resp = Must(http.Get(n.ts.URL + text.URL[:strings.Index(text.URL, "?")]))
+	n.Require().Equal(403, resp.StatusCode)
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/me/notes/%d/attachments", n.ts.URL, note.ID), nil)
+	AuthorizeRequest(req, user)
+	rd = &AttachmentData{}
+	n.Require().Nil(json.NewDecoder(Must(http.DefaultClient.Do(req)).Body).Decode(rd))
+	n.Require().Len(rd.Attachments, 2)
+
+	// quota
+	quota := Cfg.StorageQuota
+	Cfg.StorageQuota = 60
+	resp = n.uploadAttachment(user, note.ID, "big.bin", bytes.Repeat([]byte{1}, 30))
+	Cfg.StorageQuota = quota
+	n.Require().Equal(413, resp.StatusCode)
+	resp = n.uploadAttachment(user, note.ID, "empty.txt", nil)
+	n.Require().Equal(422, resp.StatusCode)
+
+	// read-only collaborator can download, but not upload
+	reader := &models.User{Username: "reader", Password: "secret123"}
+	reader.Create()
+	(&models.NoteShare{NoteID: note.ID, UserID: reader.ID, Permission: models.PermissionRead}).Save(user.ID)
+	resp = n.uploadAttachment(reader, note.ID, "x.txt", []byte("x"))
+	n.Require().Equal(403, resp.StatusCode)
+
+	// published note attachments are public
+	note.Update(&models.NotePatch{Published: &[]bool{true}[0]})
+	resp = Must(http.Get(fmt.Sprintf("%s/api/notes/%d/attachments", n.ts.URL, note.ID)))
+	rd = &AttachmentData{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+	n.Require().Len(rd.Attachments, 2)
+	resp = Must(http.Get(n.ts.URL + rd.Attachments[0].URL))
+	n.Require().Equal(200, resp.StatusCode)
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("%s/api/me/notes/%d/attachments/%d", n.ts.URL, note.ID, page.ID), nil)
+	AuthorizeRequest(req, user)
+	n.Require().Equal(200, Must(http.DefaultClient.Do(req)).StatusCode)
+	n.Require().Equal(int64(11), n.storageUsed(user))
+
+	stored := &models.Attachment{}
+	n.Require().Nil(models.GetDB().Take(stored, text.ID).Error)
+
+	// content lost by storage is not found, not server error
+	n.Require().Nil(storage.Get().Delete(stored.Key))
+	n.Require().Equal(404, Must(http.Get(n.ts.URL+text.URL)).StatusCode)
+	n.Require().Nil(note.Remove())
+	n.Require().Equal(int64(0), n.storageUsed(user))
+	_, err := storage.Get().Get(stored.Key)
+	n.Require().Equal(storage.ErrNotFound, err)
+}
+
+// fakeS3 is in-process S3-compatible server which keeps objects in memory
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=key/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+		r.Header.Get("X-Amz-Date") == "" {
+		w.WriteHeader(403)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case "PUT":
+		f.objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+	case "GET":
+		obj, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write(obj)
+	case "DELETE":
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(204)
+	}
+}
+
+func (n *NotesTestSuite) TestAttachmentsS3() {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	local := storage.Get()
+	storage.Set(&storage.S3Store{Endpoint: server.URL, Region: "us-east-1", Bucket: "notes", AccessKey: "key", SecretKey: "secret"})
+	defer storage.Set(local)
+
+	user := CreateUserTest()
+	note := &models.Note{Title: "stored in s3", Body: "body", UserID: user.ID}
+	note.Create()
+
+	picture := &bytes.Buffer{}
+	gif.Encode(picture, image.NewGray(image.Rect(0, 0, 2, 2)), nil)
+	resp := n.uploadAttachment(user, note.ID, "photo.gif", picture.Bytes())
+	rd := &AttachmentData{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+	n.Require().True(rd.Success, rd.Message)
+	n.Require().Equal("image/gif", rd.Attachment.ContentType)
+
+	resp = Must(http.Get(n.ts.URL + rd.Attachment.URL))
+	n.Require().Equal(200, resp.StatusCode)
+	content, _ := ioutil.ReadAll(resp.Body)
+	n.Require().Equal(picture.Bytes(), content)
+
+	stored := &models.Attachment{}
+	for i := 0; i < 100; i++ {
+		n.Require().Nil(models.GetDB().Take(stored, rd.Attachment.ID).Error)
+		if stored.ThumbnailStatus != models.ThumbnailsPending {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	fake.mu.Lock()
+	n.Require().Len(fake.objects, 1+len(models.ThumbnailSizes), "original and thumbnails")
+	fake.mu.Unlock()
+
+	n.Require().Nil(note.Remove())
+	n.Require().Len(fake.objects, 0)
+}
+
+// photoWithExif is jpeg of w x h with exif orientation 6(rotated 90 clockwise) and fake gps data
+func photoWithExif(w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 200, 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	jpeg.Encode(buf, img, nil)
+
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0, 0, 0, 0, 0}
+	payload := append(append([]byte("Exif\x00\x00"), tiff...), []byte("GPS secret-location")...)
+	app1 := append([]byte{0xff, 0xe1, 0, byte(len(payload) + 2)}, payload...)
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func (n *NotesTestSuite) TestAttachmentThumbnails() {
+	user := CreateUserTest()
+	note := &models.Note{Title: "photos", Body: "trip", UserID: user.ID}
+	note.Create()
+
+	photo := photoWithExif(400, 200)
+	resp := n.uploadAttachment(user, note.ID, "trip.jpg", photo)
+	rd := &AttachmentData{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+	n.Require().True(rd.Success, rd.Message)
+	attachment := rd.Attachment
+	n.Require().Equal("image/jpeg", attachment.ContentType)
+
+	// metadata is stripped from original, orientation is kept
+	resp = Must(http.Get(n.ts.URL + attachment.URL))
+	original, _ := ioutil.ReadAll(resp.Body)
+	n.Require().Equal(int64(len(original)), attachment.Size)
+	n.Require().NotContains(string(original), "secret-location")
+	n.Require().Equal(6, imaging.Orientation(original))
+
+	stored := &models.Attachment{}
+	for i := 0; i < 100; i++ {
+		n.Require().Nil(models.GetDB().Take(stored, attachment.ID).Error)
+		if stored.ThumbnailStatus != models.ThumbnailsPending {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	n.Require().Equal(models.ThumbnailsDone, stored.ThumbnailStatus)
+	n.Require().ElementsMatch([]string{"small", "medium"}, stored.Thumbnails)
+
+	// thumbnails are rotated by orientation
+	for size, bounds := range map[string]image.Point{"small": {80, 160}, "medium": {200, 400}} {
+		resp = Must(http.Get(n.ts.URL + attachment.URL + "&size=" + size))
+		n.Require().Equal(200, resp.StatusCode)
+		n.Require().Equal("image/jpeg", resp.Header.Get("Content-Type"))
+		thumb, err := jpeg.Decode(resp.Body)
+		n.Require().Nil(err)
+		n.Require().Equal(bounds, thumb.Bounds().Size(), size)
+	}
+
+	resp = Must(http.Get(n.ts.URL + attachment.URL + "&size=huge"))
+	n.Require().Equal(400, resp.StatusCode)
+
+	resp = n.uploadAttachment(user, note.ID, "notes.txt", []byte("plain text"))
+	rd = &AttachmentData{}
+	n.Require().Nil(json.NewDecoder(resp.Body).Decode(rd))
+	n.Require().Empty(rd.Attachment.Thumbnails)
+	resp = Must(http.Get(n.ts.URL + rd.Attachment.URL + "&size=small"))
+	n.Require().Equal(404, resp.StatusCode)
+
+	n.Require().Nil(note.Remove())
+	_, err := storage.Get().Get(stored.ThumbnailKey("small"))
+	n.Require().Equal(storage.ErrNotFound, err)
+}
+
+func (n *NotesTestSuite) TestAttachmentMetadata() {
+	user := CreateUserTest()
+	note := &models.Note{Title: "pictures", Body: "body", UserID: user.ID}
+	note.Create()
+	download := func(filename string, content []byte) []byte {
+		rd := &AttachmentData{}
+		n.Require().Nil(json.NewDecoder(n.uploadAttachment(user, note.ID, filename, content).Body).Decode(rd))
+		n.Require().True(rd.Success, rd.Message)
+		resp := Must(http.Get(n.ts.URL + rd.Attachment.URL))
+		n.Require().Equal(200, resp.StatusCode)
+		n.Require().Contains(resp.Header.Get("Content-Disposition"), "inline")
+		data, _ := ioutil.ReadAll(resp.Body)
+		return data
+	}
+	chunk := func(fourCC, payload string) string {
+		size := make([]byte, 4)
+		binary.LittleEndian.PutUint32(size, uint32(len(payload)))
+		if len(payload)%2 == 1 {
+			payload += "\x00"
+		}
+		return fourCC + string(size) + payload
+	}
+
+	chunks := chunk("VP8X", "\x0c\x00\x00\x00\x01\x00\x00\x01\x00\x00") + chunk("VP8L", "fake bitstream") +
+		chunk("EXIF", "GPS secret-location") + chunk("XMP ", "<x:xmpmeta>secret-location</x:xmpmeta>")
+	webp := []byte("RIFF\x00\x00\x00\x00WEBP" + chunks)
+	binary.LittleEndian.PutUint32(webp[4:8], uint32(len(webp)-8))
+	stripped := download("photo.webp", webp)
+	n.Require().NotContains(string(stripped), "secret-location")
+	n.Require().Contains(string(stripped), "fake bitstream")
+	n.Require().Equal(uint32(len(stripped)-8), binary.LittleEndian.Uint32(stripped[4:8]))
+	n.Require().Zero(stripped[20]&0x0c, "vp8x has no metadata flags")
+
+	picture := &bytes.Buffer{}
+	gif.Encode(picture, image.NewGray(image.Rect(0, 0, 2, 2)), nil)
+	data := picture.Bytes()
+	comment := append([]byte{0x21, 0xfe, 15}, "secret-location\x00"...)
+	withComment := append(append(append([]byte{}, data[:len(data)-1]...), comment...), 0x3b)
+	stripped = download("photo.gif", withComment)
+	n.Require().Equal(data, stripped)
+	_, err := gif.Decode(bytes.NewReader(stripped))
+	n.Require().Nil(err)
+}
+
 func TestNotesTestSuite(t *testing.T) {
 	suite.Run(t, &NotesTestSuite{})
 }
@@ -424,6 +2939,40 @@ func AsJSONBody(obj interface{}) io.Reader {
 	return b
 }
 
+func (n *NotesTestSuite) TestNoteTags() {
+	user := CreateUserTest()
+	client := &http.Client{}
+
+	req, _ := http.NewRequest("POST", n.ts.URL+"/api/me/notes", AsJSONBody(Object{
+		"title": "tagged", "body": "text", "tags": []string{" Go ", "go", "web"}}))
+	AuthorizeRequest(req, user)
+	resp := Must(client.Do(req))
+	n.Require().Equal(200, resp.StatusCode)
+	note := &models.Note{}
+	n.Require().Nil(models.GetDB().Where("title = ?", "tagged").Take(note).Error)
+	n.Require().Nil(note.LoadTags())
+	n.Require().Len(note.Tags, 2, "tags should be normalized")
+
+	update := func(tags []string) int {
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("%s/api/me/notes/%d", n.ts.URL, note.ID), AsJSONBody(Object{"tags": tags}))
+		AuthorizeRequest(req, user)
+		return Must(client.Do(req)).StatusCode
+	}
+	n.Require().Equal(200, update([]string{"web", "notes"}))
+	n.Require().Equal(422, update([]string{"a,b"}))
+	n.Require().Equal(422, update(strings.Split("a b c d e f g h i j k", " ")))
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("%s/api/me/notes/%d", n.ts.URL, note.ID), nil)
+	AuthorizeRequest(req, user)
+	detail := &ResponseData{}
+	json.NewDecoder(Must(client.Do(req)).Body).Decode(detail)
+	names := []string{}
+	for _, t := range detail.Note.Tags {
+		names = append(names, t.Name)
+	}
+	n.Require().ElementsMatch([]string{"web", "notes"}, names)
+}
+
 func (n *NotesTestSuite) TestAnotherUserDetail() {
 	user := CreateUserTest()
 
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	. "notes/config"
+	"notes/imaging"
+	"notes/storage"
+
+	"gorm.io/gorm"
+)
+
+// ErrQuotaExceeded when user has no space for new attachment
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// ThumbnailSizes are max sides of thumbnails by names
+var ThumbnailSizes = map[string]int{"small": 160, "medium": 640}
+
+// thumbnail statuses
+const (
+	ThumbnailsPending = "pending"
+	ThumbnailsDone    = "done"
+	ThumbnailsFailed  = "failed"
+)
+
+//Attachment is file attached to note, content is kept in blob store
+type Attachment struct {
+	Model
+	NoteID      uint   `json:"note_id" gorm:"index"`
+	UserID      uint   `json:"user_id" gorm:"index"` // owner of note, storage is charged to him
+	Filename    string `json:"filename" gorm:"size:255"`
+	ContentType string `json:"content_type" gorm:"size:128"`
+	Size        int64  `json:"size"`
+	Key         string `json:"-" gorm:"size:128;uniqueIndex"`
+	URL         string `json:"url,omitempty" gorm:"-"`
+
+	Thumbnails      StringList `json:"thumbnails" gorm:"size:64"` // ready sizes
+	ThumbnailStatus string     `json:"-" gorm:"size:16;index"`
+}
+
+//Validate attachment
+func (a *Attachment) Validate() error {
+	a.Filename = strings.TrimSpace(path.Base(strings.ReplaceAll(a.Filename, "\\", "/")))
+	if a.Filename == "" || a.Filename == "." || a.Filename == "/" || utf8.RuneCountInString(a.Filename) > 255 {
+		return ErrValidation("Validation error. Filename is required(len <= 255)")
+	}
+	if a.Size <= 0 {
+		return ErrValidation("Validation error. File is empty")
+	}
+	if a.Size > Cfg.AttachmentMaxSize {
+		return ErrValidation(fmt.Sprintf("Validation error. File is too big(max %d bytes)", Cfg.AttachmentMaxSize))
+	}
+	return nil
+}
+
+//Create stores content in blob store charging storage of note owner, content type is sniffed from content.
+//Metadata(with location) of images is removed, their thumbnails are made by worker
+func (a *Attachment) Create(content io.Reader) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+	a.ContentType = http.DetectContentType(head)
+
+	a.Thumbnails = StringList{}
+	if imaging.Supported(a.ContentType) {
+		a.ThumbnailStatus = ThumbnailsPending
+	}
+	if imaging.HasMetadata(a.ContentType) {
+		data, err := ioutil.ReadAll(io.MultiReader(bytes.NewReader(head), io.LimitReader(content, a.Size)))
+		if err != nil {
+			return err
+		}
+		if data, err = imaging.StripMetadata(a.ContentType, data); err != nil {
+			return ErrValidation("Validation error. Image is broken")
+		}
+		head, content, a.Size = data, bytes.NewReader(nil), int64(len(data))
+	}
+
+	if err := changeStorageUsed(a.UserID, a.Size); err != nil {
+		return err
+	}
+	a.Key = fmt.Sprintf("%d/%s", a.UserID, RandomToken())
+	if err := storage.Get().Put(a.Key, io.MultiReader(bytes.NewReader(head), content), a.Size, a.ContentType); err != nil {
+		changeStorageUsed(a.UserID, -a.Size)
+		return fmt.Errorf("when storing blob: %v", err)
+	}
+
+	if err := GetDB().Create(a).Error; err != nil {
+		storage.Get().Delete(a.Key)
+		changeStorageUsed(a.UserID, -a.Size)
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+	return nil
+}
+
+// changeStorageUsed atomically so concurrent uploads can't exceed quota
+func changeStorageUsed(userID uint, delta int64) error {
+	q := GetDB().Model(&User{}).Where("id = ?", userID)
+	if delta > 0 {
+		q = q.Where("storage_used + ? <= ?", delta, Cfg.StorageQuota)
+	}
+	res := q.UpdateColumn("storage_used", gorm.Expr("storage_used + ?", delta))
+	if res.Error != nil {
+		panic(fmt.Errorf("when updating storage usage: %v", res.Error))
+	}
+	if res.RowsAffected == 0 {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+//Get attachment of note
+func (a *Attachment) Get() error {
+	return GetDB().Where("id = ? AND note_id = ?", a.ID, a.NoteID).Take(a).Error
+}
+
+//Remove attachment with its blob
+func (a *Attachment) Remove() error {
+	if err := a.Get(); err != nil {
+		return err
+	}
+	res := GetDB().Delete(a)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	changeStorageUsed(a.UserID, -a.Size)
+	if err := GetDB().Model(&User{}).Where("avatar_id = ?", a.ID).UpdateColumn("avatar_id", nil).Error; err != nil {
+		return err
+	}
+	for _, size := range a.Thumbnails {
+		if err := storage.Get().Delete(a.ThumbnailKey(size)); err != nil {
+			return fmt.Errorf("when removing blob: %v", err)
+		}
+	}
+	if err := storage.Get().Delete(a.Key); err != nil {
+		return fmt.Errorf("when removing blob: %v", err)
+	}
+	return nil
+}
+
+// Open content of attachment, should be closed
+func (a *Attachment) Open() (io.ReadCloser, error) {
+	return storage.Get().Get(a.Key)
+}
+
+// ThumbnailKey in blob store
+func (a *Attachment) ThumbnailKey(size string) string {
+	return a.Key + "." + size
+}
+
+// OpenThumbnail of size, should be closed
+func (a *Attachment) OpenThumbnail(size string) (io.ReadCloser, error) {
+	return storage.Get().Get(a.ThumbnailKey(size))
+}
+
+func (a *Attachment) signature(expires int64) string {
+	h := hmac.New(sha256.New, []byte(Cfg.TokenPassword))
+	fmt.Fprintf(h, "attachment:%d:%d", a.ID, expires)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// DownloadURL without signature works only for attachments of published notes
+func (a *Attachment) DownloadURL() string {
+	return fmt.Sprintf("/api/attachments/%d", a.ID)
+}
+
+// SignURL sets URL which gives access to attachment for ttl
+func (a *Attachment) SignURL(ttl time.Duration) {
+	expires := time.Now().Add(ttl).Unix()
+	a.URL = fmt.Sprintf("%s?expires=%d&sig=%s", a.DownloadURL(), expires, a.signature(expires))
+}
+
+// CheckSignature of download url
+func (a *Attachment) CheckSignature(expires int64, sig string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(a.signature(expires)))
+}
+
+// removeAttachments of note
+func removeAttachments(noteID uint) error {
+	attachments := []Attachment{}
+	if err := GetDB().Where("note_id = ?", noteID).Find(&attachments).Error; err != nil {
+		return err
+	}
+	for i := range attachments {
+		if err := attachments[i].Remove(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//NoteChange is journal entry, Seq grows monotonically and is used as sync token
+type NoteChange struct {
+	Seq       uint64    `gorm:"primaryKey;autoIncrement" json:"seq"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	NoteID    uint      `gorm:"index" json:"note_id"`
+	Deleted   bool      `json:"deleted"`
+	// note was live before or after change, only such changes are seen by public feeds
+	Published bool      `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//Counter is named sequence, its row is locked by increment until transaction ends
+type Counter struct {
+	Name  string `gorm:"primaryKey;size:32"`
+	Value uint64
+}
+
+const changesCounter = "note_changes"
+
+// recordChange should be last write of transaction, seq is taken under lock of counter
+// so changes are committed in seq order and pull after seq never misses one
+func (n *Note) recordChange(db *gorm.DB, deleted, published bool) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		change := &NoteChange{UserID: n.UserID, NoteID: n.ID, Deleted: deleted, Published: published, Seq: nextChangeSeq(tx)}
+		return tx.Create(change).Error
+	})
+	if err != nil {
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+}
+
+func nextChangeSeq(tx *gorm.DB) uint64 {
+	for {
+		res := tx.Model(&Counter{}).Where("name = ?", changesCounter).UpdateColumn("value", gorm.Expr("value + 1"))
+		if res.Error != nil {
+			panic(fmt.Errorf("when updating in db: %v", res.Error))
+		}
+		if res.RowsAffected == 1 {
+			break
+		}
+		// first change since counter exists, it continues journal
+		var last uint64
+		if err := tx.Model(&NoteChange{}).Select("COALESCE(MAX(seq), 0)").Scan(&last).Error; err != nil {
+			panic(fmt.Errorf("when fetching from db: %v", err))
+		}
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Counter{Name: changesCounter, Value: last}).Error
+		if err != nil {
+			panic(fmt.Errorf("when creating in db: %v", err))
+		}
+	}
+	var seq uint64
+	if err := tx.Model(&Counter{}).Select("value").Where("name = ?", changesCounter).Scan(&seq).Error; err != nil {
+		panic(fmt.Errorf("when fetching from db: %v", err))
+	}
+	return seq
+}
+
+// Seq of last change of note(0 if it was never changed since journal exists)
+func (n *Note) Seq() uint64 {
+	var seq uint64
+	err := GetDB().Model(&NoteChange{}).Select("COALESCE(MAX(seq), 0)").Where("note_id = ?", n.ID).Scan(&seq).Error
+	if err != nil {
+		panic(fmt.Errorf("when fetching from db: %v", err))
+	}
+	return seq
+}
+
+// LastChanges of user's notes after since, only last change of every note is returned.
+// token is seq of last examined change, more is true if limit is reached
+func LastChanges(userID uint, since uint64, limit int) (changes []NoteChange, token uint64, more bool) {
+	all := []NoteChange{}
+	err := GetDB().Where("user_id = ? AND seq > ?", userID, since).Order("seq").Limit(limit + 1).Find(&all).Error
+	if err != nil {
+		panic(fmt.Errorf("when fetching from db: %v", err))
+	}
+	if len(all) > limit {
+		all, more = all[:limit], true
+	}
+
+	token = since
+	last := map[uint]int{}
+	for _, c := range all {
+		if i, ok := last[c.NoteID]; ok {
+			changes[i] = c
+		} else {
+			last[c.NoteID] = len(changes)
+			changes = append(changes, c)
+		}
+		token = c.Seq
+	}
+	return changes, token, more
+}
+
+// sync statuses
+const (
+	SyncCreated  = "created"
+	SyncUpdated  = "updated"
+	SyncDeleted  = "deleted"
+	SyncConflict = "conflict"
+	SyncError    = "error"
+)
+
+//SyncChange is local change of client.
+//Note is created if ID is 0, otherwise it's applied only if note is not changed after BaseSeq
+type SyncChange struct {
+	ClientID string  `json:"client_id"`
+	ID       uint    `json:"id"`
+	BaseSeq  uint64  `json:"base_seq"`
+	Title    *string `json:"title"`
+	Body     *string `json:"body"`
+	Deleted  bool    `json:"deleted"`
+}
+
+//SyncResult for one change, on conflict Note is server version(nil if it's deleted)
+type SyncResult struct {
+	ClientID string `json:"client_id"`
+	ID       uint   `json:"id"`
+	Status   string `json:"status"`
+	Seq      uint64 `json:"seq,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Note     *Note  `json:"note,omitempty"`
+}
+
+// Apply change of user's note
+func (c *SyncChange) Apply(userID uint) *SyncResult {
+	res := &SyncResult{ClientID: c.ClientID, ID: c.ID}
+
+	note := &Note{Model: Model{ID: c.ID}, UserID: userID}
+	var err error
+	switch {
+	case c.ID == 0:
+		if c.Title != nil {
+			note.Title = *c.Title
+		}
+		if c.Body != nil {
+			note.Body = *c.Body
+		}
+		res.Status = SyncCreated
+		err = note.Create()
+	default:
+		err = note.Get()
+		if err == gorm.ErrRecordNotFound {
+			// client could edit note which is already removed on server
+			if deleted := GetDB().Where("note_id = ? AND user_id = ? AND deleted", c.ID, userID).
+				Take(&NoteChange{}).Error; deleted == nil {
+				res.Status, res.Message = SyncConflict, "note is deleted on server"
+				return res
+			}
+			res.Status, res.Message = SyncError, "no such note"
+			return res
+		} else if err != nil {
+			panic(err)
+		}
+		if seq := note.Seq(); seq > c.BaseSeq {
+			res.Status, res.Message, res.Seq, res.Note = SyncConflict, "note is changed on server", seq, note
+			return res
+		}
+
+		// write is conditional, so concurrent change after check is not overwritten
+		checked := note.UpdatedAt
+		note = &Note{Model: Model{ID: c.ID}, UserID: userID}
+		if c.Deleted {
+			res.Status = SyncDeleted
+			err = note.RemoveIfUpdatedAt(checked)
+		} else {
+			res.Status = SyncUpdated
+			err = note.Update(&NotePatch{Title: c.Title, Body: c.Body, IfUpdatedAt: &checked})
+		}
+	}
+
+	if err == ErrNoteChanged || (err == gorm.ErrRecordNotFound && c.ID != 0) {
+		res.Status, res.Message = SyncConflict, "note is changed on server"
+		server := &Note{Model: Model{ID: c.ID}, UserID: userID}
+		if server.Get() == nil {
+			res.Seq, res.Note = server.Seq(), server
+		} else {
+			res.Message = "note is deleted on server"
+		}
+		return res
+	} else if IsErrValidation(err) {
+		res.Status, res.Message = SyncError, err.Error()
+		return res
+	} else if err != nil {
+		panic(err)
+	}
+	res.ID = note.ID
+	res.Seq = note.Seq()
+	return res
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//ChecklistItem is to-do item of note
+type ChecklistItem struct {
+	Model
+	NoteID   uint       `json:"note_id" gorm:"index"`
+	Text     string     `json:"text" gorm:"size:255"`
+	Done     bool       `json:"done" gorm:"not null;default:false"`
+	Position int        `json:"position"`
+	DueDate  *time.Time `json:"due_date"`
+}
+
+//Validate item
+func (i *ChecklistItem) Validate() error {
+	i.Text = strings.TrimSpace(i.Text)
+	if i.Text == "" || utf8.RuneCountInString(i.Text) > 255 {
+		return ErrValidation("Validation error. Text is required(len <= 255)")
+	}
+	if i.Position < 0 {
+		return ErrValidation("Validation error. Position should be positive")
+	}
+	return nil
+}
+
+//Create item at its position(moving next ones down), nil position appends it to the end
+func (i *ChecklistItem) Create(position *int) error {
+	if position != nil {
+		i.Position = *position
+	}
+	if err := i.Validate(); err != nil {
+		return err
+	}
+
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := lockChecklist(tx, i.NoteID); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&ChecklistItem{}).Where("note_id = ?", i.NoteID).Count(&count).Error; err != nil {
+			return err
+		}
+		if position == nil || i.Position > int(count) {
+			i.Position = int(count)
+		}
+		err := tx.Model(&ChecklistItem{}).Where("note_id = ? AND position >= ?", i.NoteID, i.Position).
+			UpdateColumn("position", gorm.Expr("position + 1")).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(i).Error
+	})
+	if err != nil {
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+	return nil
+}
+
+// lockChecklist of note until end of tx, positions are counted and shifted by one writer at a time
+func lockChecklist(tx *gorm.DB, noteID uint) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Take(&Note{}, noteID).Error
+}
+
+//Get item of note
+func (i *ChecklistItem) Get() error {
+	return GetDB().Where("id = ? AND note_id = ?", i.ID, i.NoteID).Take(i).Error
+}
+
+// NullableTime in patches tells apart missing field(Set is false) and null
+type NullableTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+// MarshalJSON ...
+func (t NullableTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Time)
+}
+
+// UnmarshalJSON ...
+func (t *NullableTime) UnmarshalJSON(b []byte) error {
+	t.Set = true
+	if string(b) == "null" {
+		t.Time = nil
+		return nil
+	}
+	t.Time = &time.Time{}
+	return json.Unmarshal(b, t.Time)
+}
+
+// ChecklistItemPatch with nullable fields, null due_date removes due date
+type ChecklistItemPatch struct {
+	Text    *string      `json:"text"`
+	Done    *bool        `json:"done"`
+	DueDate NullableTime `json:"due_date"`
+}
+
+//Update item
+func (i *ChecklistItem) Update(patch *ChecklistItemPatch) error {
+	if err := i.Get(); err != nil {
+		return err
+	}
+	if patch.Text != nil {
+		i.Text = *patch.Text
+	}
+	if patch.Done != nil {
+		i.Done = *patch.Done
+	}
+	if patch.DueDate.Set {
+		i.DueDate = patch.DueDate.Time
+	}
+	if err := i.Validate(); err != nil {
+		return err
+	}
+	return GetDB().Save(i).Error
+}
+
+//Remove item, next items are moved up
+func (i *ChecklistItem) Remove() error {
+	if err := i.Get(); err != nil {
+		return err
+	}
+	return GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := lockChecklist(tx, i.NoteID); err != nil {
+			return err
+		}
+		if err := tx.Delete(i).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ChecklistItem{}).Where("note_id = ? AND position > ?", i.NoteID, i.Position).
+			UpdateColumn("position", gorm.Expr("position - 1")).Error
+	})
+}
+
+// ReorderChecklist of note, ids should list all items of note in new order
+func ReorderChecklist(noteID uint, ids []uint) error {
+	items := []ChecklistItem{}
+	if err := GetDB().Where("note_id = ?", noteID).Find(&items).Error; err != nil {
+		return err
+	}
+	known := map[uint]bool{}
+	for _, item := range items {
+		known[item.ID] = true
+	}
+	if len(ids) != len(items) {
+		return ErrValidation("Validation error. Order should contain all items of note")
+	}
+	for _, id := range ids {
+		if !known[id] {
+			return ErrValidation("Validation error. Order should contain all items of note once")
+		}
+		delete(known, id)
+	}
+
+	return GetDB().Transaction(func(tx *gorm.DB) error {
+		for position, id := range ids {
+			if err := tx.Model(&ChecklistItem{}).Where("id = ?", id).UpdateColumn("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ChecklistCompletion is percentage of done items by note ids, notes without items are missing
+func ChecklistCompletion(noteIDs []uint) map[uint]int {
+	rows := []struct {
+		NoteID uint
+		Total  int
+		Done   int
+	}{}
+	err := GetDB().Model(&ChecklistItem{}).Where("note_id IN ?", noteIDs).
+		Select("note_id, COUNT(*) AS total, SUM(CASE WHEN done THEN 1 ELSE 0 END) AS done").
+		Group("note_id").Scan(&rows).Error
+	if err != nil {
+		panic(err)
+	}
+	completion := map[uint]int{}
+	for _, row := range rows {
+		completion[row.NoteID] = row.Done * 100 / row.Total
+	}
+	return completion
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"notes/config"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// ErrCommentsDisabled by owner of note
+var ErrCommentsDisabled = errors.New("comments are disabled")
+
+// MaxThreadReplies shown in thread(the oldest ones), thread with more replies has more_replies set
+const MaxThreadReplies = 100
+
+// Comment on published note, replies have parent and all comments of thread share root
+type Comment struct {
+	Model
+	NoteID   uint      `json:"note_id" gorm:"index"`
+	UserID   uint      `json:"user_id" gorm:"index"`
+	ParentID *uint     `json:"parent_id" gorm:"index"`
+	RootID   uint      `json:"-" gorm:"index"`
+	Body     string    `json:"body"`
+	Hidden   bool      `json:"hidden" gorm:"not null;default:false"`  // by owner of note
+	Deleted  bool      `json:"deleted" gorm:"not null;default:false"` // deleted comment with replies stays in thread
+	Username string    `json:"username" gorm:"-"`
+	Replies  []Comment `json:"replies" gorm:"-"`
+	// MoreReplies of top level comment are not shown, see MaxThreadReplies
+	MoreReplies bool `json:"more_replies,omitempty" gorm:"-"`
+}
+
+// Validate comment
+func (c *Comment) Validate() error {
+	if strings.TrimSpace(c.Body) == "" || utf8.RuneCountInString(c.Body) > config.Cfg.BodyLength {
+		return ErrValidation(fmt.Sprintf("Validation error. Body len should be (1 <= len <= %d)", config.Cfg.BodyLength))
+	}
+	return nil
+}
+
+// Create comment on published note, ErrCommentsDisabled is returned if owner disabled comments
+func (c *Comment) Create() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	note := &Note{}
+	note.ID = c.NoteID
+	if err := note.GetPublished(); err != nil {
+		return err
+	}
+	if note.CommentsDisabled {
+		return ErrCommentsDisabled
+	}
+	if c.ParentID != nil {
+		parent := &Comment{}
+		err := GetDB().Where("id = ? AND note_id = ?", *c.ParentID, c.NoteID).Take(parent).Error
+		if err == gorm.ErrRecordNotFound || err == nil && parent.Deleted {
+			return ErrValidation("Validation error. No such parent comment")
+		} else if err != nil {
+			return err
+		}
+		c.RootID = parent.RootID
+	}
+
+	// top level comment is root of itself, it's set in the same transaction so thread is never orphaned
+	return GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(c).Error; err != nil {
+			panic(fmt.Errorf("when creating in db: %v", err))
+		}
+		if c.ParentID == nil {
+			c.RootID = c.ID
+			return tx.Model(c).UpdateColumn("root_id", c.ID).Error
+		}
+		return nil
+	})
+}
+
+// Get comment of note
+func (c *Comment) Get() error {
+	return GetDB().Where("id = ? AND note_id = ? AND NOT deleted", c.ID, c.NoteID).Take(c).Error
+}
+
+// Edit body of comment(loaded)
+func (c *Comment) Edit(body string) error {
+	c.Body = body
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return GetDB().Model(c).Update("body", body).Error
+}
+
+// SetHidden hides or shows comment(loaded)
+func (c *Comment) SetHidden(hidden bool) error {
+	c.Hidden = hidden
+	return GetDB().Model(c).Update("hidden", hidden).Error
+}
+
+// Remove comment(loaded), comment with replies is only marked deleted to keep thread
+func (c *Comment) Remove() error {
+	var replies int64
+	if err := GetDB().Model(&Comment{}).Where("parent_id = ?", c.ID).Count(&replies).Error; err != nil {
+		return err
+	}
+	if replies > 0 {
+		c.Deleted, c.Body = true, ""
+		return GetDB().Model(c).Updates(map[string]interface{}{"deleted": true, "body": ""}).Error
+	}
+	return GetDB().Delete(&Comment{}, c.ID).Error
+}
+
+// redact comment for user: hidden body is seen only by its author and owner of note
+func (c *Comment) redact(userID, ownerID uint) {
+	if c.Hidden && userID != c.UserID && userID != ownerID {
+		c.Body = ""
+	}
+	for i := range c.Replies {
+		c.Replies[i].redact(userID, ownerID)
+	}
+}
+
+// CommentThreads of note(loaded) starting with roots, as seen by user
+func (n *Note) CommentThreads(roots []Comment, userID uint) ([]Comment, error) {
+	rootIDs := make([]uint, len(roots))
+	for i := range roots {
+		rootIDs[i] = roots[i].ID
+	}
+	replies := []Comment{}
+	if len(rootIDs) > 0 {
+		// the oldest MaxThreadReplies+1 replies of each thread, the extra one only tells that there are more.
+		// Parent is older than reply, so cut thread is still a tree
+		err := GetDB().Where("root_id IN ? AND parent_id IS NOT NULL", rootIDs).
+			Where("(SELECT COUNT(*) FROM comments older WHERE older.root_id = comments.root_id AND "+
+				"older.parent_id IS NOT NULL AND older.id < comments.id) <= ?", MaxThreadReplies).
+			Order("id").Find(&replies).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	shown, more := map[uint]int{}, map[uint]bool{}
+	kept := replies[:0]
+	for _, r := range replies {
+		if shown[r.RootID] == MaxThreadReplies {
+			more[r.RootID] = true
+			continue
+		}
+		shown[r.RootID]++
+		kept = append(kept, r)
+	}
+	replies = kept
+
+	usernames := map[uint]string{}
+	all := append(append([]Comment{}, roots...), replies...)
+	for i := range all {
+		usernames[all[i].UserID] = ""
+	}
+	ids := []uint{}
+	for id := range usernames {
+		ids = append(ids, id)
+	}
+	users := []User{}
+	if err := GetDB().Select("id, username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	// replies go after their parents(ordered by id), so tree is built from the bottom
+	children := map[uint][]Comment{}
+	for i := len(replies) - 1; i >= 0; i-- {
+		r := replies[i]
+		r.Username = usernames[r.UserID]
+		r.Replies = reverse(children[r.ID])
+		if r.Replies == nil {
+			r.Replies = []Comment{}
+		}
+		children[*r.ParentID] = append(children[*r.ParentID], r)
+	}
+	for i := range roots {
+		roots[i].Username = usernames[roots[i].UserID]
+		roots[i].Replies = reverse(children[roots[i].ID])
+		if roots[i].Replies == nil {
+			roots[i].Replies = []Comment{}
+		}
+		roots[i].MoreReplies = more[roots[i].ID]
+		roots[i].redact(userID, n.UserID)
+	}
+	return roots, nil
+}
+
+func reverse(comments []Comment) []Comment {
+	for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+		comments[i], comments[j] = comments[j], comments[i]
+	}
+	return comments
+}
+
+// CommentCounts of visible comments of notes
+func CommentCounts(noteIDs []uint) map[uint]int {
+	rows := []struct {
+		NoteID uint
+		Count  int
+	}{}
+	err := GetDB().Model(&Comment{}).Select("note_id, COUNT(*) AS count").
+		Where("note_id IN ? AND NOT hidden AND NOT deleted", noteIDs).Group("note_id").Scan(&rows).Error
+	if err != nil {
+		panic(fmt.Errorf("when fetching from db: %v", err))
+	}
+	counts := map[uint]int{}
+	for _, r := range rows {
+		counts[r.NoteID] = r.Count
+	}
+	return counts
+}
@@ -16,13 +16,25 @@ func Init(conn *gorm.DB) {
 	db = conn
 }
 
-var activeModels = []interface{}{&User{}, &Note{}}
+var activeModels = []interface{}{&User{}, &Note{}, &ShareLink{}, &NoteShare{}, &Webhook{}, &WebhookDelivery{}, &NoteChange{}, &Tag{}, &ImportJob{}, &Attachment{}, &ChecklistItem{}, &Reminder{}, &NoteLink{}, &Template{}, &Comment{}, &Like{}, &Follow{}, &Counter{}}
 
 // Migrate ...
 func Migrate() {
 	if err := GetDB().Debug().AutoMigrate(activeModels...); err != nil {
 		panic("when tryin to migrate: " + err.Error())
 	}
+	// notes published before published_at was added
+	err := GetDB().Model(&Note{}).Where("published AND published_at IS NULL").
+		UpdateColumn("published_at", gorm.Expr("COALESCE(publish_at, created_at)")).Error
+	if err != nil {
+		panic("when tryin to migrate: " + err.Error())
+	}
+	// notes published before visibility was added
+	err = GetDB().Model(&Note{}).Where("published AND visibility <> ?", VisibilityPublic).
+		UpdateColumn("visibility", VisibilityPublic).Error
+	if err != nil {
+		panic("when tryin to migrate: " + err.Error())
+	}
 }
 
 //Truncate ...
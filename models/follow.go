@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//Follow of author by user
+type Follow struct {
+	FollowerID uint      `json:"follower_id" gorm:"primarykey;autoIncrement:false"`
+	FolloweeID uint      `json:"followee_id" gorm:"primarykey;autoIncrement:false;index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+//Create follow(following twice changes nothing)
+func (f *Follow) Create() error {
+	if f.FollowerID == f.FolloweeID {
+		return ErrValidation("Validation error. User can't follow themselves")
+	}
+	if err := GetDB().Take(&User{}, f.FolloweeID).Error; err != nil {
+		return err
+	}
+	if err := GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(f).Error; err != nil {
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+	return nil
+}
+
+//Remove follow
+func (f *Follow) Remove() error {
+	res := GetDB().Where("follower_id = ? AND followee_id = ?", f.FollowerID, f.FolloweeID).Delete(&Follow{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// FollowCounts of user: followers and followed authors
+func FollowCounts(userID uint) (followers, following int64) {
+	if err := GetDB().Model(&Follow{}).Where("followee_id = ?", userID).Count(&followers).Error; err != nil {
+		panic(fmt.Errorf("when fetching from db: %v", err))
+	}
+	if err := GetDB().Model(&Follow{}).Where("follower_id = ?", userID).Count(&following).Error; err != nil {
+		panic(fmt.Errorf("when fetching from db: %v", err))
+	}
+	return followers, following
+}
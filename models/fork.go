@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Fork of note as seen by author of original, title is shown only if fork is published
+type Fork struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Title     string    `json:"title,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Fork published note(by ID) into private copy of user
+func (n *Note) Fork(userID uint) (*Note, error) {
+	if err := n.GetPublished(); err != nil {
+		return nil, err
+	}
+	if n.UserID == userID {
+		return nil, ErrValidation("Validation error. Own note can't be forked")
+	}
+	if err := n.LoadTags(); err != nil {
+		return nil, err
+	}
+
+	fork := &Note{Title: n.Title, Body: n.Body, UserID: userID, Tags: n.Tags,
+		Visibility: VisibilityPrivate, ForkedFromID: &n.ID}
+	// counter is changed in transaction of fork creation, so it can't drift
+	err := fork.create(func(tx *gorm.DB) error {
+		return tx.Model(&Note{}).Where("id = ?", n.ID).UpdateColumn("forks_count", gorm.Expr("forks_count + 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	n.ForksCount++
+	return fork, nil
+}
+
+// unlinkForks of removed note(loaded) and decrease counter of its original, tx is the one of removal
+func (n *Note) unlinkForks(tx *gorm.DB) error {
+	if err := tx.Model(&Note{}).Where("forked_from_id = ?", n.ID).UpdateColumn("forked_from_id", nil).Error; err != nil {
+		return err
+	}
+	if n.ForkedFromID == nil {
+		return nil
+	}
+	return tx.Model(&Note{}).Where("id = ? AND forks_count > 0", *n.ForkedFromID).
+		UpdateColumn("forks_count", gorm.Expr("forks_count - 1")).Error
+}
+
+// ForksOf scope selects forks of note
+func ForksOf(noteID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("forked_from_id = ?", noteID)
+	}
+}
+
+// Forks as seen by author of original, notes are selected by ForksOf
+func Forks(notes []Note) ([]Fork, error) {
+	ids := []uint{}
+	for _, note := range notes {
+		ids = append(ids, note.UserID)
+	}
+	users := []User{}
+	if len(ids) > 0 {
+		if err := GetDB().Select("id, username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return nil, err
+		}
+	}
+	usernames := map[uint]string{}
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+
+	forks := make([]Fork, len(notes))
+	now := time.Now()
+	for i, note := range notes {
+		forks[i] = Fork{ID: note.ID, UserID: note.UserID, Username: usernames[note.UserID], CreatedAt: note.CreatedAt}
+		if note.IsLive(now) {
+			forks[i].Title = note.Title
+		}
+	}
+	return forks, nil
+}
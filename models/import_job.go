@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// import job statuses
+const (
+	ImportPending = "pending"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// ImportError of one file(or item) of archive
+type ImportError struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// ImportErrors is stored as json
+type ImportErrors []ImportError
+
+// MaxImportErrors kept in job, further failures are only counted
+const MaxImportErrors = 100
+
+// Value for db
+func (e ImportErrors) Value() (driver.Value, error) {
+	b, err := json.Marshal(e)
+	return string(b), err
+}
+
+// Scan from db
+func (e *ImportErrors) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	case []byte:
+		return json.Unmarshal(v, e)
+	case nil:
+		*e = nil
+		return nil
+	default:
+		return fmt.Errorf("can't scan %T into ImportErrors", value)
+	}
+}
+
+//ImportJob is asynchronous import of notes
+type ImportJob struct {
+	Model
+	UserID   uint         `json:"user_id"`
+	Format   string       `json:"format" gorm:"size:16"`
+	Status   string       `json:"status" gorm:"size:16"`
+	Total    int          `json:"total"`
+	Imported int          `json:"imported"`
+	Failed   int          `json:"failed"`
+	Errors   ImportErrors `json:"errors" gorm:"type:text"`
+}
+
+//Create pending job
+func (j *ImportJob) Create() error {
+	j.Status = ImportPending
+	j.Errors = ImportErrors{}
+	if err := GetDB().Create(j).Error; err != nil {
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+	return nil
+}
+
+//Get job of user
+func (j *ImportJob) Get() error {
+	return GetDB().Where("id = ? AND user_id = ?", j.ID, j.UserID).Take(j).Error
+}
+
+//Save job
+func (j *ImportJob) Save() error {
+	return GetDB().Save(j).Error
+}
+
+//Fail item of job, error is reported while there are less than MaxImportErrors
+func (j *ImportJob) Fail(e ImportError) {
+	j.Failed++
+	if len(j.Errors) < MaxImportErrors {
+		j.Errors = append(j.Errors, e)
+	}
+}
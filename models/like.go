@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TrendingHalfLife is time after which like weighs twice less in trending score
+const TrendingHalfLife = 24 * time.Hour
+
+// trendingEpoch is start of time for trending scores, it must never change
+var trendingEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//Like of published note by user
+type Like struct {
+	NoteID    uint      `json:"note_id" gorm:"primarykey;autoIncrement:false"`
+	UserID    uint      `json:"user_id" gorm:"primarykey;autoIncrement:false"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// trendingPoint is log weight of like made at t. Decayed sum of likes
+// sum(2^(-(now-t)/halfLife)) ordered the same way as sum(2^((t-epoch)/halfLife)),
+// so score is kept as log of the latter and doesn't need to be recomputed as time goes
+func trendingPoint(t time.Time) float64 {
+	return t.Sub(trendingEpoch).Hours() / TrendingHalfLife.Hours() * math.Ln2
+}
+
+// addTrending adds(or removes) like made at t to trending score of note.
+// Score is 0 for note without likes, points of likes made after epoch are positive.
+// likes_count of note must be already changed in tx, that update locks row of note until commit
+func addTrending(tx *gorm.DB, noteID uint, t time.Time, remove bool) error {
+	p := trendingPoint(t)
+	note := &Note{}
+	if err := tx.Select("id, trending_score, likes_count").Take(note, noteID).Error; err != nil {
+		return err
+	}
+	score := note.TrendingScore
+	switch {
+	case note.LikesCount == 0:
+		score = 0
+	case remove:
+		// log(e^score - e^p), rounding loses precision when like weighs almost as much as whole score
+		if d := 1 - math.Exp(p-score); d > 1e-9 {
+			score += math.Log(d)
+		} else {
+			likes := []Like{}
+			if err := tx.Select("created_at").Where("note_id = ?", noteID).Find(&likes).Error; err != nil {
+				return err
+			}
+			score = 0
+			for _, like := range likes {
+				score = addPoint(score, trendingPoint(like.CreatedAt))
+			}
+		}
+	default:
+		score = addPoint(score, p)
+	}
+	return tx.Model(&Note{}).Where("id = ?", noteID).UpdateColumn("trending_score", score).Error
+}
+
+// addPoint of like to score, log(e^score + e^p)
+func addPoint(score, p float64) float64 {
+	if score == 0 {
+		return p
+	}
+	hi, lo := math.Max(score, p), math.Min(score, p)
+	return hi + math.Log1p(math.Exp(lo-hi))
+}
+
+// Like published note(by ID), it is liked once by user. Note is loaded
+func (n *Note) Like(userID uint) error {
+	if err := n.GetPublished(); err != nil {
+		return err
+	}
+	like := &Like{NoteID: n.ID, UserID: userID}
+	// like, counter and score are changed together, so they can't drift apart
+	return GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(like)
+		if res.Error != nil {
+			panic(fmt.Errorf("when creating in db: %v", res.Error))
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		if err := n.changeLikes(tx, 1); err != nil {
+			return err
+		}
+		return addTrending(tx, n.ID, like.CreatedAt, false)
+	})
+}
+
+// Unlike note(by ID), like can be withdrawn even if note isn't published anymore. Note is loaded
+func (n *Note) Unlike(userID uint) error {
+	like := &Like{}
+	err := GetDB().Where("note_id = ? AND user_id = ?", n.ID, userID).Take(like).Error
+	if err == gorm.ErrRecordNotFound {
+		// without like note is seen only if it's published
+		return n.GetPublished()
+	} else if err != nil {
+		return err
+	}
+	if err := GetDB().Take(n, n.ID).Error; err != nil {
+		return err
+	}
+	return GetDB().Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("note_id = ? AND user_id = ?", n.ID, userID).Delete(&Like{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if err := n.changeLikes(tx, -1); err != nil {
+			return err
+		}
+		return addTrending(tx, n.ID, like.CreatedAt, true)
+	})
+}
+
+func (n *Note) changeLikes(tx *gorm.DB, delta int) error {
+	err := tx.Model(&Note{}).Where("id = ?", n.ID).UpdateColumn("likes_count", gorm.Expr("likes_count + ?", delta)).Error
+	if err != nil {
+		return err
+	}
+	n.LikesCount += delta
+	return nil
+}
+
+// LikedBy tells that user likes note
+func (n *Note) LikedBy(userID uint) bool {
+	err := GetDB().Where("note_id = ? AND user_id = ?", n.ID, userID).Take(&Like{}).Error
+	return err == nil
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxLinks per note, the rest are ignored
+const maxLinks = 100
+
+var linkPattern = regexp.MustCompile(`\[\[([^\[\]\n]{1,255})\]\]`)
+
+//NoteLink from note to another one: [[#123]] links by id, [[Title]] links by title among notes of the same owner.
+//Title links are resolved at query time, so they follow renames and creation of notes
+type NoteLink struct {
+	ID     uint   `json:"-" gorm:"primarykey"`
+	FromID uint   `json:"-" gorm:"index"`
+	Target string `json:"target" gorm:"size:255"`  // text inside brackets
+	ToID   uint   `json:"-" gorm:"index"`          // for links by id
+	Title  string `json:"-" gorm:"size:255;index"` // for links by title
+}
+
+// LinkInfo is resolved link as seen by user
+type LinkInfo struct {
+	Target string `json:"target"`
+	NoteID uint   `json:"note_id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Broken bool   `json:"broken"`
+}
+
+// ParseLinks from body, duplicates are skipped
+func ParseLinks(body string) []NoteLink {
+	links := []NoteLink{}
+	seen := map[string]bool{}
+	for _, m := range linkPattern.FindAllStringSubmatch(body, -1) {
+		target := strings.TrimSpace(m[1])
+		if target == "" || seen[target] || len(links) == maxLinks {
+			continue
+		}
+		seen[target] = true
+
+		link := NoteLink{Target: target}
+		if id, err := strconv.ParseUint(strings.TrimPrefix(target, "#"), 10, 32); err == nil && strings.HasPrefix(target, "#") {
+			link.ToID = uint(id)
+		} else {
+			link.Title = target
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// saveLinks of note replacing old ones
+func (n *Note) saveLinks(db *gorm.DB) error {
+	if err := db.Where("from_id = ?", n.ID).Delete(&NoteLink{}).Error; err != nil {
+		return err
+	}
+	links := ParseLinks(n.Body)
+	if len(links) == 0 {
+		return nil
+	}
+	for i := range links {
+		links[i].FromID = n.ID
+	}
+	return db.Create(&links).Error
+}
+
+// visibleNotes are ids of notes which user can read by ownership, share or publishing
+func visibleNotes(notes []*Note, userID uint) (map[uint]bool, error) {
+	visible := map[uint]bool{}
+	rest := []uint{}
+	now := time.Now()
+	for _, note := range notes {
+		if note.UserID == userID || note.IsLive(now) {
+			visible[note.ID] = true
+		} else {
+			rest = append(rest, note.ID)
+		}
+	}
+	if len(rest) == 0 {
+		return visible, nil
+	}
+	shared := []uint{}
+	if err := GetDB().Model(&NoteShare{}).Where("user_id = ? AND note_id IN ?", userID, rest).Pluck("note_id", &shared).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range shared {
+		visible[id] = true
+	}
+	return visible, nil
+}
+
+// linkTargetColumns are enough to show target and check its visibility
+const linkTargetColumns = "id, user_id, title, published, publish_at, unpublish_at"
+
+// resolveLinks of note owned by ownerID, target is nil if it doesn't exist.
+// Links by id and by title are looked up by one query each
+func resolveLinks(ownerID uint, links []NoteLink) ([]*Note, error) {
+	ids, titles := []uint{}, []string{}
+	for _, link := range links {
+		if link.ToID != 0 {
+			ids = append(ids, link.ToID)
+		} else {
+			titles = append(titles, link.Title)
+		}
+	}
+	byID, byTitle := map[uint]*Note{}, map[string]*Note{}
+	if len(ids) > 0 {
+		notes := []Note{}
+		if err := GetDB().Select(linkTargetColumns).Where("id IN ?", ids).Find(&notes).Error; err != nil {
+			return nil, err
+		}
+		for i := range notes {
+			byID[notes[i].ID] = &notes[i]
+		}
+	}
+	if len(titles) > 0 {
+		notes := []Note{}
+		err := GetDB().Select(linkTargetColumns).Where("user_id = ? AND title IN ?", ownerID, titles).Order("id").Find(&notes).Error
+		if err != nil {
+			return nil, err
+		}
+		for i := range notes {
+			if byTitle[notes[i].Title] == nil { // title link leads to the first note with such title
+				byTitle[notes[i].Title] = &notes[i]
+			}
+		}
+	}
+	targets := make([]*Note, len(links))
+	for i, link := range links {
+		if link.ToID != 0 {
+			targets[i] = byID[link.ToID]
+		} else {
+			targets[i] = byTitle[link.Title]
+		}
+	}
+	return targets, nil
+}
+
+// Outlinks of note(loaded) as seen by user. Links to notes which user can't read are reported
+// as broken, so titles and existence of private notes don't leak
+func (n *Note) Outlinks(userID uint) ([]LinkInfo, error) {
+	links := []NoteLink{}
+	if err := GetDB().Where("from_id = ?", n.ID).Order("id").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	targets, err := resolveLinks(n.UserID, links)
+	if err != nil {
+		return nil, err
+	}
+	found := []*Note{}
+	for _, target := range targets {
+		if target != nil {
+			found = append(found, target)
+		}
+	}
+	visible, err := visibleNotes(found, userID)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]LinkInfo, len(links))
+	for i, target := range targets {
+		infos[i] = LinkInfo{Target: links[i].Target, Broken: true}
+		if target != nil && visible[target.ID] {
+			infos[i].NoteID, infos[i].Title, infos[i].Broken = target.ID, target.Title, false
+		}
+	}
+	return infos, nil
+}
+
+// Backlinks are notes(readable by user) which link to note(loaded)
+func (n *Note) Backlinks(userID uint) ([]Note, error) {
+	// title links lead to note only if it's the first one with such title
+	first := &Note{}
+	err := GetDB().Select("id").Where("user_id = ? AND title = ?", n.UserID, n.Title).Order("id").Take(first).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	cond := GetDB().Where("note_links.to_id = ?", n.ID)
+	if first.ID == n.ID {
+		cond = cond.Or("note_links.to_id = 0 AND note_links.title = ? AND notes.user_id = ?", n.Title, n.UserID)
+	}
+
+	sources := []Note{}
+	err = GetDB().Model(&Note{}).Distinct("notes.*").Joins("JOIN note_links ON note_links.from_id = notes.id").
+		Where(cond).Where("notes.id <> ?", n.ID).Order("notes.id").Find(&sources).Error
+	if err != nil {
+		return nil, err
+	}
+	ptrs := make([]*Note, len(sources))
+	for i := range sources {
+		ptrs[i] = &sources[i]
+	}
+	visible, err := visibleNotes(ptrs, userID)
+	if err != nil {
+		return nil, err
+	}
+	readable := []Note{}
+	for _, source := range sources {
+		if visible[source.ID] {
+			readable = append(readable, source)
+		}
+	}
+	return readable, nil
+}
+
+// BrokenLinks of note
+type BrokenLinks struct {
+	NoteID  uint     `json:"note_id"`
+	Title   string   `json:"title"`
+	Targets []string `json:"targets"`
+}
+
+// brokenLink is condition on note_links of owner's notes(named args owner and now):
+// link leads to missing note or to note which owner can't read
+const brokenLink = "((note_links.to_id <> 0 AND NOT EXISTS (SELECT 1 FROM notes t WHERE t.id = note_links.to_id AND " +
+	"(t.user_id = @owner OR (t.published AND (t.publish_at IS NULL OR t.publish_at <= @now) AND " +
+	"(t.unpublish_at IS NULL OR t.unpublish_at > @now)) OR " +
+	"EXISTS (SELECT 1 FROM note_shares s WHERE s.note_id = t.id AND s.user_id = @owner)))) OR " +
+	"(note_links.to_id = 0 AND NOT EXISTS (SELECT 1 FROM notes t WHERE t.user_id = @owner AND t.title = note_links.title)))"
+
+// WithBrokenLinks scope selects notes of user which have broken links
+func WithBrokenLinks(userID uint) func(db *gorm.DB) *gorm.DB {
+	args := map[string]interface{}{"owner": userID, "now": time.Now().UTC()}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("notes.user_id = @owner AND EXISTS (SELECT 1 FROM note_links WHERE "+
+			"note_links.from_id = notes.id AND "+brokenLink+")", args)
+	}
+}
+
+// FindBrokenLinks of user's notes(selected by WithBrokenLinks)
+func FindBrokenLinks(userID uint, notes []Note) ([]BrokenLinks, error) {
+	if len(notes) == 0 {
+		return []BrokenLinks{}, nil
+	}
+	ids := make([]uint, len(notes))
+	for i := range notes {
+		ids[i] = notes[i].ID
+	}
+	links := []NoteLink{}
+	err := GetDB().Where("note_links.from_id IN @ids AND "+brokenLink,
+		map[string]interface{}{"ids": ids, "owner": userID, "now": time.Now().UTC()}).
+		Order("note_links.id").Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	targets := map[uint][]string{}
+	for _, link := range links {
+		targets[link.FromID] = append(targets[link.FromID], link.Target)
+	}
+	broken := make([]BrokenLinks, len(notes))
+	for i := range notes {
+		broken[i] = BrokenLinks{NoteID: notes[i].ID, Title: notes[i].Title, Targets: targets[notes[i].ID]}
+	}
+	return broken, nil
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
 
 //Model is base for my models
 type Model struct {
@@ -21,3 +26,21 @@ func IsErrValidation(err error) bool {
 	_, ok := err.(ErrValidation)
 	return ok
 }
+
+// RandomToken returns unguessable url-safe token
+func RandomToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("when generating token: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// db precision of time differs, times compared for equality(like leases) are exact to seconds
+func truncateTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	truncated := t.UTC().Truncate(time.Second)
+	return &truncated
+}
@@ -1,18 +1,96 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"notes/config"
+	"notes/events"
+	"time"
 	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Visibility of note for other users
+type Visibility string
+
+// possible visibilities
+const (
+	// VisibilityPrivate note is seen only by owner
+	VisibilityPrivate Visibility = "private"
+	// VisibilityUnlisted note is seen by anyone with share link, but not listed
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPublic note is listed in published notes
+	VisibilityPublic Visibility = "public"
 )
 
+// Valid checks that visibility is one of known
+func (v Visibility) Valid() bool {
+	return v == VisibilityPrivate || v == VisibilityUnlisted || v == VisibilityPublic
+}
+
 //Note with title, body and ownwer
 type Note struct {
 	Model
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	UserID    uint   `json:"user_id"`
-	Published bool   `json:"published"`
+	Title      string     `json:"title"`
+	Body       string     `json:"body"`
+	UserID     uint       `json:"user_id"`
+	Published  bool       `json:"published"`
+	Visibility Visibility `json:"visibility" gorm:"size:16;default:private"`
+	Tags       []Tag      `json:"tags,omitempty" gorm:"many2many:note_tags"`
+	Pinned     bool       `json:"pinned" gorm:"not null;default:false"`
+	Archived   bool       `json:"archived" gorm:"not null;default:false"`
+	Starred    bool       `json:"starred" gorm:"not null;default:false"`
+	// published note goes live at PublishAt and stops being published at UnpublishAt
+	PublishAt    *time.Time `json:"publish_at" gorm:"index"`
+	UnpublishAt  *time.Time `json:"unpublish_at" gorm:"index"`
+	PublishedAt  *time.Time `json:"published_at" gorm:"index"` // when note went(or is scheduled to go) live last time
+	ForkedFromID *uint      `json:"forked_from" gorm:"index"`  // published note which this one is copy of
+	ForksCount   int        `json:"forks_count" gorm:"not null;default:0"`
+	// CommentsDisabled by owner, existing comments are still shown
+	CommentsDisabled bool `json:"comments_disabled" gorm:"not null;default:false"`
+
+	LikesCount    int     `json:"likes_count" gorm:"not null;default:0"`
+	TrendingScore float64 `json:"-" gorm:"not null;default:0;index"` // see addTrending
+
+	Author *User `json:"-" gorm:"foreignKey:UserID"` // only preloaded for responses
+}
+
+// LiveAt scope selects notes which are published at moment(schedule of publishing is honored)
+func LiveAt(now time.Time) func(db *gorm.DB) *gorm.DB {
+	now = now.UTC()
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("notes.published AND (notes.publish_at IS NULL OR notes.publish_at <= ?) AND "+
+			"(notes.unpublish_at IS NULL OR notes.unpublish_at > ?)", now, now)
+	}
+}
+
+// IsLive tells that note is published at moment
+func (n *Note) IsLive(now time.Time) bool {
+	return n.Published && (n.PublishAt == nil || !n.PublishAt.After(now)) &&
+		(n.UnpublishAt == nil || n.UnpublishAt.After(now))
+}
+
+// GetPublished note by id, only if it is live now
+func (n *Note) GetPublished() error {
+	return GetDB().Scopes(LiveAt(time.Now())).Where("notes.id = ?", n.ID).Take(n).Error
+}
+
+// BeforeSave keeps Published and Visibility consistent (Published is the source of truth for public)
+func (n *Note) BeforeSave(*gorm.DB) error {
+	switch {
+	case n.Published:
+		n.Visibility = VisibilityPublic
+	case n.Visibility == VisibilityPublic || n.Visibility == "":
+		n.Visibility = VisibilityPrivate
+	}
+	return nil
+}
+
+// SetVisibility also updates Published
+func (n *Note) SetVisibility(v Visibility) {
+	n.Visibility = v
+	n.Published = v == VisibilityPublic
 }
 
 //Validate note
@@ -28,22 +106,75 @@ func (n *Note) Validate() error {
 		return ErrValidation("Validation error. UserID is invalid")
 	}
 
-	return nil
+	if n.Visibility != "" && !n.Visibility.Valid() {
+		return ErrValidation("Validation error. Visibility should be one of private, unlisted, public")
+	}
+
+	if n.PublishAt != nil && n.UnpublishAt != nil && !n.UnpublishAt.After(*n.PublishAt) {
+		return ErrValidation("Validation error. unpublish_at should be after publish_at")
+	}
+
+	return validateTags(n.Tags)
 }
 
 //Create note
 func (n *Note) Create() error {
+	n.ForkedFromID = nil // only Fork makes forks
+	return n.create(nil)
+}
+
+// create note in transaction, with it runs also after(if not nil). Events are sent after commit
+func (n *Note) create(after func(tx *gorm.DB) error) error {
 	if err := n.Validate(); err != nil {
 		return err
 	}
-
-	if err := GetDB().Create(n).Error; err != nil {
-		panic(fmt.Errorf("when creating in db: %v", err))
+	// counters are changed only by forks and likes themselves
+	n.ForksCount, n.LikesCount, n.TrendingScore = 0, 0, 0
+	if n.Visibility != "" {
+		n.SetVisibility(n.Visibility)
+	}
+	if n.PublishAt != nil { // scheduled note is published when time comes
+		n.Published = true
 	}
+	if n.Archived {
+		n.Pinned = false
+	}
+	n.PublishAt, n.UnpublishAt = truncateTime(n.PublishAt), truncateTime(n.UnpublishAt)
+	n.markPublished(time.Now(), false)
 
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		if len(n.Tags) > 0 {
+			n.Tags = resolveTags(tx, n.Tags)
+		}
+		if err := tx.Create(n).Error; err != nil {
+			panic(fmt.Errorf("when creating in db: %v", err))
+		}
+		if err := n.saveLinks(tx); err != nil {
+			return err
+		}
+		if after != nil {
+			if err := after(tx); err != nil {
+				return err
+			}
+		}
+		n.recordChange(tx, false, n.IsLive(time.Now()))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	n.notify(events.NoteCreated)
+	if n.IsLive(time.Now()) {
+		n.notify(events.NotePublished)
+	}
 	return nil
 }
 
+// notify subscribers about change of note
+func (n *Note) notify(eventType string) {
+	events.Publish(events.Event{Type: eventType, UserID: n.UserID, NoteID: n.ID})
+}
+
 //Get note
 func (n *Note) Get() error {
 	return GetDB().Where(n).Take(n).Error
@@ -54,9 +185,73 @@ func (n *Note) Save() error {
 	return GetDB().Save(n).Error
 }
 
-//Remove note
+// ErrNoteChanged is returned by conditional write when note is modified after it was read
+var ErrNoteChanged = errors.New("note is changed")
+
+//Remove note(with its shares)
 func (n *Note) Remove() error {
-	return GetDB().Where(n).Delete(n).Error
+	return n.remove(nil)
+}
+
+//RemoveIfUpdatedAt removes note only if it's not modified since updatedAt, otherwise ErrNoteChanged
+func (n *Note) RemoveIfUpdatedAt(updatedAt time.Time) error {
+	return n.remove(&updatedAt)
+}
+
+func (n *Note) remove(ifUpdatedAt *time.Time) error {
+	if err := GetDB().Where(n).Take(n).Error; err != nil {
+		return err
+	}
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		q := tx
+		if ifUpdatedAt != nil {
+			q = q.Where("updated_at = ?", *ifUpdatedAt)
+		}
+		res := q.Delete(&Note{}, n.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 && ifUpdatedAt != nil {
+			return ErrNoteChanged
+		} else if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := n.unlinkForks(tx); err != nil {
+			return err
+		}
+		n.recordChange(tx, true, n.IsLive(time.Now()))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	n.notify(events.NoteDeleted)
+
+	if err := GetDB().Exec("DELETE FROM note_tags WHERE note_id = ?", n.ID).Error; err != nil {
+		return err
+	}
+	if err := GetDB().Where("note_id = ?", n.ID).Delete(&NoteShare{}).Error; err != nil {
+		return err
+	}
+	if err := removeAttachments(n.ID); err != nil {
+		return err
+	}
+	if err := GetDB().Where("note_id = ?", n.ID).Delete(&ChecklistItem{}).Error; err != nil {
+		return err
+	}
+	if err := GetDB().Where("note_id = ?", n.ID).Delete(&Reminder{}).Error; err != nil {
+		return err
+	}
+	if err := GetDB().Where("from_id = ?", n.ID).Delete(&NoteLink{}).Error; err != nil {
+		return err
+	}
+	if err := GetDB().Where("note_id = ?", n.ID).Delete(&Comment{}).Error; err != nil {
+		return err
+	}
+	if err := GetDB().Where("note_id = ?", n.ID).Delete(&Like{}).Error; err != nil {
+		return err
+	}
+	return GetDB().Where("note_id = ?", n.ID).Delete(&ShareLink{}).Error
 }
 
 //Update note
@@ -64,25 +259,130 @@ func (n *Note) Update(patch *NotePatch) error {
 	if err := n.Get(); err != nil {
 		return err
 	}
+	if patch.IfBody != nil && n.Body != *patch.IfBody {
+		return ErrNoteChanged
+	}
+	wasLive := n.IsLive(time.Now())
 	if patch.Body != nil {
 		n.Body = *patch.Body
 	}
 	if patch.Title != nil {
 		n.Title = *patch.Title
 	}
+	if patch.Visibility != nil {
+		n.SetVisibility(*patch.Visibility)
+	}
 	if patch.Published != nil {
 		n.Published = *patch.Published
 	}
+	if patch.PublishAt.Set {
+		n.PublishAt = truncateTime(patch.PublishAt.Time)
+		if n.PublishAt != nil && patch.Published == nil && patch.Visibility == nil {
+			n.Published = true
+		}
+	}
+	if patch.UnpublishAt.Set {
+		n.UnpublishAt = truncateTime(patch.UnpublishAt.Time)
+	}
+	if patch.Tags != nil {
+		n.Tags = TagsFromNames(*patch.Tags)
+	}
+	if patch.Pinned != nil {
+		n.Pinned = *patch.Pinned
+	}
+	if patch.Starred != nil {
+		n.Starred = *patch.Starred
+	}
+	if patch.CommentsDisabled != nil {
+		n.CommentsDisabled = *patch.CommentsDisabled
+	}
+	if patch.Archived != nil {
+		n.Archived = *patch.Archived
+	}
+	if n.Archived { // archived note can't be on top
+		n.Pinned = false
+	}
 
 	if err := n.Validate(); err != nil {
 		return err
 	}
-	return GetDB().Save(n).Error
+	n.markPublished(time.Now(), wasLive)
+	err := GetDB().Transaction(func(tx *gorm.DB) error {
+		q := tx.Omit("Tags")
+		conditional := patch.IfUpdatedAt != nil || patch.IfBody != nil
+		if conditional {
+			// explicit Select, otherwise Save inserts note when nothing is updated
+			q = q.Select("*")
+		}
+		if patch.IfUpdatedAt != nil {
+			q = q.Where("updated_at = ?", *patch.IfUpdatedAt)
+		}
+		if patch.IfBody != nil {
+			q = q.Where("body = ?", *patch.IfBody)
+		}
+		res := q.Save(n)
+		if res.Error != nil {
+			return res.Error
+		}
+		if conditional && res.RowsAffected == 0 {
+			return ErrNoteChanged
+		}
+		if patch.Tags != nil {
+			n.Tags = resolveTags(tx, n.Tags)
+			if err := tx.Model(n).Association("Tags").Replace(n.Tags); err != nil {
+				return err
+			}
+		}
+		if patch.Body != nil {
+			if err := n.saveLinks(tx); err != nil {
+				return err
+			}
+		}
+		n.recordChange(tx, false, wasLive || n.IsLive(time.Now()))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	n.notify(events.NoteUpdated)
+	if isLive := n.IsLive(time.Now()); isLive != wasLive {
+		if isLive {
+			n.notify(events.NotePublished)
+		} else {
+			n.notify(events.NoteUnpublished)
+		}
+	}
+	return nil
 }
 
 // NotePatch with nullable fields
 type NotePatch struct {
-	Body      *string
-	Title     *string
-	Published *bool
+	Body       *string
+	Title      *string
+	Published  *bool
+	Visibility *Visibility
+	Tags       *[]string
+	Pinned     *bool
+	Archived   *bool
+	Starred    *bool
+	// null removes schedule
+	PublishAt   NullableTime `json:"publish_at"`
+	UnpublishAt NullableTime `json:"unpublish_at"`
+
+	CommentsDisabled *bool `json:"comments_disabled"`
+
+	// update is done only if note is not modified since, otherwise ErrNoteChanged
+	IfUpdatedAt *time.Time `json:"-"`
+	// update is done only if body is still this one, otherwise ErrNoteChanged
+	IfBody *string `json:"-"`
+}
+
+// HasSchedule tells that patch changes schedule of publishing
+func (p *NotePatch) HasSchedule() bool {
+	return p.PublishAt.Set || p.UnpublishAt.Set
+}
+
+// HasStates tells that patch changes pinned, archived or starred state
+func (p *NotePatch) HasStates() bool {
+	return p.Pinned != nil || p.Archived != nil || p.Starred != nil
 }
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrForbidden means that user can see object but can't do requested action
+var ErrForbidden = errors.New("forbidden")
+
+// Permission on shared note
+type Permission string
+
+// possible permissions
+const (
+	PermissionRead  Permission = "read"
+	PermissionWrite Permission = "write"
+)
+
+// Allows checks that permission is enough for required one
+func (p Permission) Allows(required Permission) bool {
+	return p == PermissionWrite || p == required
+}
+
+//NoteShare grants access to note for another user
+type NoteShare struct {
+	Model
+	NoteID     uint       `json:"note_id" gorm:"uniqueIndex:idx_note_user"`
+	UserID     uint       `json:"user_id" gorm:"uniqueIndex:idx_note_user"`
+	Permission Permission `json:"permission" gorm:"size:8"`
+}
+
+//Validate note share
+func (s *NoteShare) Validate(ownerID uint) error {
+	if s.Permission != PermissionRead && s.Permission != PermissionWrite {
+		return ErrValidation("Validation error. Permission should be read or write")
+	}
+	if s.UserID == ownerID {
+		return ErrValidation("Validation error. Note can't be shared with its owner")
+	}
+	err := GetDB().Take(&User{}, s.UserID).Error
+	if err == gorm.ErrRecordNotFound {
+		return ErrValidation("Validation error. No such user")
+	} else if err != nil {
+		panic(fmt.Errorf("when fetching from db: %v", err))
+	}
+	return nil
+}
+
+//Save share(creates or changes permission of existing)
+func (s *NoteShare) Save(ownerID uint) error {
+	if err := s.Validate(ownerID); err != nil {
+		return err
+	}
+
+	permission := s.Permission
+	err := GetDB().Where(NoteShare{NoteID: s.NoteID, UserID: s.UserID}).
+		Assign(NoteShare{Permission: permission}).FirstOrCreate(s).Error
+	if err != nil {
+		panic(fmt.Errorf("when saving in db: %v", err))
+	}
+
+	return nil
+}
+
+//Remove share
+func (s *NoteShare) Remove() error {
+	res := GetDB().Where(s).Delete(s)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// GetAccessible loads note(by ID) if user owns it or has share with required permission.
+// Returns gorm.ErrRecordNotFound if user has no access at all(to not reveal existence)
+func (n *Note) GetAccessible(userID uint, required Permission) error {
+	if err := GetDB().Take(n, n.ID).Error; err != nil {
+		return err
+	}
+	if n.UserID == userID {
+		return nil
+	}
+
+	share := &NoteShare{}
+	if err := GetDB().Where("note_id = ? AND user_id = ?", n.ID, userID).Take(share).Error; err != nil {
+		return err
+	}
+	if !share.Permission.Allows(required) {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"net/url"
+	"notes/imaging"
+	"strings"
+	"unicode/utf8"
+)
+
+// ProfilePatch with nullable fields, zero avatar_id removes avatar
+type ProfilePatch struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	Website     *string `json:"website"`
+	AvatarID    *uint   `json:"avatar_id"`
+}
+
+//ValidateProfile fields of user
+func (a *User) ValidateProfile() error {
+	if utf8.RuneCountInString(a.DisplayName) > 64 {
+		return ErrValidation("Validation error. Display name is too long(max len 64)")
+	}
+	if utf8.RuneCountInString(a.Bio) > 500 {
+		return ErrValidation("Validation error. Bio is too long(max len 500)")
+	}
+	if a.Website != "" {
+		u, err := url.Parse(a.Website)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(a.Website) > 255 {
+			return ErrValidation("Validation error. Website should be valid http(s) url")
+		}
+	}
+	if a.AvatarID != nil {
+		avatar := &Attachment{}
+		err := GetDB().Where("id = ? AND user_id = ?", *a.AvatarID, a.ID).Take(avatar).Error
+		if err != nil || !imaging.Supported(avatar.ContentType) {
+			return ErrValidation("Validation error. Avatar should be jpeg, png or gif attachment of your note")
+		}
+	}
+	return nil
+}
+
+//UpdateProfile of user
+func (a *User) UpdateProfile(patch *ProfilePatch) error {
+	if err := a.Get(); err != nil {
+		return err
+	}
+	if patch.DisplayName != nil {
+		a.DisplayName = strings.TrimSpace(*patch.DisplayName)
+	}
+	if patch.Bio != nil {
+		a.Bio = *patch.Bio
+	}
+	if patch.Website != nil {
+		a.Website = strings.TrimSpace(*patch.Website)
+	}
+	if patch.AvatarID != nil {
+		a.AvatarID = patch.AvatarID
+		if *patch.AvatarID == 0 {
+			a.AvatarID = nil
+		}
+	}
+
+	if err := a.ValidateProfile(); err != nil {
+		return err
+	}
+	return GetDB().Model(a).Select("display_name", "bio", "website", "avatar_id").Updates(a).Error
+}
+
+// AvatarURL of user, empty if user has no avatar
+func (a *User) AvatarURL() string {
+	if a.AvatarID == nil {
+		return ""
+	}
+	return (&Attachment{Model: Model{ID: *a.AvatarID}}).DownloadURL()
+}
+
+// IsAvatar tells that attachment is avatar of its owner(so it is public)
+func IsAvatar(attachmentID uint) bool {
+	err := GetDB().Joins("JOIN attachments ON attachments.id = users.avatar_id AND attachments.user_id = users.id").
+		Where("users.avatar_id = ?", attachmentID).Take(&User{}).Error
+	return err == nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"notes/events"
+	"time"
+)
+
+// LastModified is when note was changed(or went live by schedule)
+func (n *Note) LastModified() time.Time {
+	if n.PublishAt != nil && n.PublishAt.After(n.UpdatedAt) {
+		return *n.PublishAt
+	}
+	return n.UpdatedAt
+}
+
+// ScheduledNotes are published notes whose publish_at or unpublish_at has come by now
+func ScheduledNotes(now time.Time, limit int) ([]Note, error) {
+	now = now.UTC()
+	notes := []Note{}
+	err := GetDB().Where("published AND (publish_at <= ? OR unpublish_at <= ?)", now, now).
+		Order("id").Limit(limit).Find(&notes).Error
+	return notes, err
+}
+
+// NextScheduledAt is time of the nearest transition of scheduled note
+func NextScheduledAt() (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, column := range []string{"publish_at", "unpublish_at"} {
+		n := &Note{}
+		err := GetDB().Where("published AND " + column + " IS NOT NULL").Order(column).Take(n).Error
+		if err != nil {
+			continue
+		}
+		at := n.PublishAt
+		if column == "unpublish_at" {
+			at = n.UnpublishAt
+		}
+		if !found || at.Before(next) {
+			next, found = *at, true
+		}
+	}
+	return next, found
+}
+
+// ApplySchedule makes transition of scheduled note which is due by now.
+// Transition is done by conditional update, so only one of concurrent workers reports it
+func (n *Note) ApplySchedule(now time.Time) error {
+	now = now.UTC()
+	if n.UnpublishAt != nil && !n.UnpublishAt.After(now) {
+		res := GetDB().Model(&Note{}).Where("id = ? AND published AND unpublish_at = ?", n.ID, n.UnpublishAt).
+			UpdateColumns(map[string]interface{}{"published": false, "visibility": VisibilityPrivate,
+				"publish_at": nil, "unpublish_at": nil, "updated_at": now})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		n.recordChange(GetDB(), false, n.PublishAt == nil)
+		if n.PublishAt == nil { // otherwise note was never announced as published
+			n.notify(events.NoteUnpublished)
+		}
+		return nil
+	}
+
+	if n.PublishAt != nil && !n.PublishAt.After(now) {
+		res := GetDB().Model(&Note{}).Where("id = ? AND published AND publish_at = ?", n.ID, n.PublishAt).
+			UpdateColumns(map[string]interface{}{"publish_at": nil, "published_at": n.PublishAt, "updated_at": now})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		n.recordChange(GetDB(), false, true)
+		n.notify(events.NotePublished)
+	}
+	return nil
+}
+
+// markPublished sets PublishedAt when note goes live(or is scheduled to), feeds are ordered by it
+func (n *Note) markPublished(now time.Time, wasLive bool) {
+	switch {
+	case !n.Published:
+	case n.PublishAt != nil && n.PublishAt.After(now):
+		n.PublishedAt = n.PublishAt
+	case !wasLive:
+		now = now.UTC()
+		n.PublishedAt = &now
+	}
+}
+
+// FeedModifiedAt is the latest change of user's published notes(all notes if userID is 0) by now.
+// Notes which were removed or unpublished since are counted too, so it doesn't go back when feed shrinks
+func FeedModifiedAt(userID uint, now time.Time) time.Time {
+	now = now.UTC()
+	var at time.Time
+	change := &NoteChange{}
+	db := GetDB().Where("published").Order("seq DESC")
+	if userID != 0 {
+		db = db.Where("user_id = ?", userID)
+	}
+	if err := db.Take(change).Error; err == nil {
+		at = change.CreatedAt
+	}
+	// note is out of feed since unpublish_at, even if worker hasn't recorded it yet
+	n := &Note{}
+	db = GetDB().Where("published AND unpublish_at <= ?", now).Order("unpublish_at DESC")
+	if userID != 0 {
+		db = db.Where("user_id = ?", userID)
+	}
+	if err := db.Take(n).Error; err == nil && n.UnpublishAt.After(at) {
+		at = *n.UnpublishAt
+	}
+	return at
+}
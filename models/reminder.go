@@ -0,0 +1,174 @@
+package models
+
+import (
+	"fmt"
+	"notes/rrule"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//Reminder about note for user, recurring reminders have rrule
+type Reminder struct {
+	Model
+	NoteID   uint       `json:"note_id" gorm:"index"`
+	UserID   uint       `json:"user_id" gorm:"index"`
+	RemindAt time.Time  `json:"remind_at"` // first occurrence
+	TimeZone string     `json:"time_zone" gorm:"size:64"`
+	RRule    string     `json:"rrule" gorm:"size:255"`
+	Email    bool       `json:"email" gorm:"not null;default:false"` // notify by email too
+	NextAt   *time.Time `json:"next_at" gorm:"index"`                // nil when reminder is over
+	FiredAt  *time.Time `json:"fired_at"`
+
+	ClaimedAt *time.Time `json:"-"`                           // lease of scheduler which fires next occurrence
+	Attempts  int        `json:"-" gorm:"not null;default:0"` // attempts to fire next occurrence
+}
+
+// Location of reminder time zone
+func (r *Reminder) Location() (*time.Location, error) {
+	if r.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.TimeZone)
+}
+
+// ParseRemindAt in time zone of reminder, time without offset is local time of that zone
+func (r *Reminder) ParseRemindAt(s string) error {
+	loc, err := r.Location()
+	if err != nil {
+		return ErrValidation("Validation error. Unknown time zone")
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		r.RemindAt = t.In(loc)
+		return nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			r.RemindAt = t
+			return nil
+		}
+	}
+	return ErrValidation("Validation error. remind_at should be like 2006-01-02T15:04:05(with optional offset)")
+}
+
+//Validate reminder
+func (r *Reminder) Validate() error {
+	if _, err := r.Location(); err != nil {
+		return ErrValidation("Validation error. Unknown time zone")
+	}
+	if r.RemindAt.IsZero() {
+		return ErrValidation("Validation error. remind_at is required")
+	}
+	if r.RRule != "" {
+		if _, err := rrule.Parse(r.RRule); err != nil {
+			return ErrValidation("Validation error. Invalid rrule: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// NextAfter returns occurrence of reminder after moment, nil when there are no more
+func (r *Reminder) NextAfter(after time.Time) *time.Time {
+	loc, err := r.Location()
+	if err != nil {
+		return nil
+	}
+	start := r.RemindAt.In(loc)
+	if r.RRule == "" {
+		if start.After(after) {
+			return &start
+		}
+		return nil
+	}
+	rule, err := rrule.Parse(r.RRule)
+	if err != nil {
+		return nil
+	}
+	next, ok := rule.Next(start, after)
+	if !ok {
+		return nil
+	}
+	return &next
+}
+
+//Create reminder, its first occurrence should be in future
+func (r *Reminder) Create() error {
+	r.RRule = strings.ToUpper(strings.TrimSpace(r.RRule))
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	r.NextAt = truncateTime(r.NextAfter(time.Now()))
+	if r.NextAt == nil {
+		return ErrValidation("Validation error. Reminder has no occurrences in future")
+	}
+	if err := GetDB().Create(r).Error; err != nil {
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+	return nil
+}
+
+//Remove reminder of user
+func (r *Reminder) Remove() error {
+	res := GetDB().Where("id = ? AND note_id = ? AND user_id = ?", r.ID, r.NoteID, r.UserID).Delete(&Reminder{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// Claim due reminder for lease, only one of concurrent schedulers succeeds.
+// Reminder stays due until Done, so it's claimed again when lease expires(scheduler failed or crashed)
+func (r *Reminder) Claim(now time.Time) (bool, error) {
+	q := GetDB().Model(&Reminder{}).Where("id = ? AND next_at = ?", r.ID, r.NextAt)
+	if r.ClaimedAt == nil {
+		q = q.Where("claimed_at IS NULL")
+	} else {
+		q = q.Where("claimed_at = ?", r.ClaimedAt)
+	}
+	claimedAt := truncateTime(&now)
+	res := q.Updates(map[string]interface{}{"claimed_at": claimedAt, "attempts": gorm.Expr("attempts + 1")})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	r.ClaimedAt = claimedAt
+	r.Attempts++
+	return res.RowsAffected == 1, nil
+}
+
+// Done moves claimed reminder to next occurrence and releases lease
+func (r *Reminder) Done(now time.Time) error {
+	next := truncateTime(r.NextAfter(now))
+	err := GetDB().Model(&Reminder{}).Where("id = ? AND claimed_at = ?", r.ID, r.ClaimedAt).
+		Updates(map[string]interface{}{"next_at": next, "fired_at": now, "claimed_at": nil, "attempts": 0}).Error
+	if err != nil {
+		return err
+	}
+	r.NextAt, r.FiredAt, r.ClaimedAt, r.Attempts = next, &now, nil, 0
+	return nil
+}
+
+// DueReminders are reminders which should be fired by now and aren't leased
+func DueReminders(now time.Time, lease time.Duration, limit int) ([]Reminder, error) {
+	due := []Reminder{}
+	err := GetDB().Where("next_at IS NOT NULL AND next_at <= ? AND (claimed_at IS NULL OR claimed_at <= ?)", now, now.Add(-lease)).
+		Order("next_at").Limit(limit).Find(&due).Error
+	return due, err
+}
+
+// NextReminderAt is time of the nearest reminder or lease expiration
+func NextReminderAt(lease time.Duration) (time.Time, bool) {
+	var next time.Time
+	found := false
+	due := &Reminder{}
+	if GetDB().Where("next_at IS NOT NULL AND claimed_at IS NULL").Order("next_at").Take(due).Error == nil {
+		next, found = *due.NextAt, true
+	}
+	leased := &Reminder{}
+	if GetDB().Where("next_at IS NOT NULL AND claimed_at IS NOT NULL").Order("claimed_at").Take(leased).Error == nil {
+		if expires := leased.ClaimedAt.Add(lease); !found || expires.Before(next) {
+			next, found = expires, true
+		}
+	}
+	return next, found
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// share link errors
+var (
+	ErrShareExpired  = errors.New("share link is expired")
+	ErrSharePassword = errors.New("share link requires valid password")
+)
+
+//ShareLink gives access to unlisted note by secret token
+type ShareLink struct {
+	Model
+	NoteID    uint       `json:"note_id"`
+	Token     string     `json:"token" gorm:"size:64;uniqueIndex"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"-"`
+	MaxViews  int        `json:"max_views"`
+	Views     int        `json:"views"`
+}
+
+//Validate share link
+func (s *ShareLink) Validate() error {
+	if s.ExpiresAt != nil && !s.ExpiresAt.After(time.Now()) {
+		return ErrValidation("Validation error. Expiration time should be in future")
+	}
+	if s.MaxViews < 0 {
+		return ErrValidation("Validation error. Max views should be positive(or 0 for unlimited)")
+	}
+	if s.Password != "" && (len(s.Password) < 4 || len(s.Password) > 30) {
+		return ErrValidation("Validation error. Password should be (4 <= len <= 30)")
+	}
+	return nil
+}
+
+//Create share link with fresh token (password is plain here)
+func (s *ShareLink) Create() error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	s.Token = RandomToken()
+	if s.Password != "" {
+		s.Password = HashPassword(s.Password)
+	}
+
+	if err := GetDB().Create(s).Error; err != nil {
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+
+	return nil
+}
+
+//Remove share link
+func (s *ShareLink) Remove() error {
+	res := GetDB().Where(s).Delete(s)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// Open share link with password, counts view and returns shared note
+func (s *ShareLink) Open(password string) (*Note, error) {
+	if err := GetDB().Where("token = ?", s.Token).Take(s).Error; err != nil {
+		return nil, err
+	}
+
+	if s.ExpiresAt != nil && !s.ExpiresAt.After(time.Now()) {
+		return nil, ErrShareExpired
+	}
+	if s.Password != "" && bcrypt.CompareHashAndPassword([]byte(s.Password), []byte(password)) != nil {
+		return nil, ErrSharePassword
+	}
+
+	note := &Note{}
+	err := GetDB().Where("visibility <> ?", VisibilityPrivate).Take(note, s.NoteID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// check and increment in one statement so concurrent views can't exceed limit
+	res := GetDB().Model(&ShareLink{}).Where("id = ? AND (max_views = 0 OR views < max_views)", s.ID).
+		UpdateColumn("views", gorm.Expr("views + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrShareExpired
+	}
+	s.Views++
+
+	return note, nil
+}
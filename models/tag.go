@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxTags of one note
+const MaxTags = 10
+
+//Tag of notes, in json it's just a name
+type Tag struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"size:64;uniqueIndex"`
+}
+
+// MarshalJSON ...
+func (t Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Name)
+}
+
+// UnmarshalJSON ...
+func (t *Tag) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &t.Name)
+}
+
+// TagsFromNames normalizes names(trimmed, lowercase, no duplicates)
+func TagsFromNames(names []string) []Tag {
+	tags := []Tag{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			tags = append(tags, Tag{Name: name})
+		}
+	}
+	return tags
+}
+
+func validateTags(tags []Tag) error {
+	if len(tags) > MaxTags {
+		return ErrValidation(fmt.Sprintf("Validation error. Too many tags(max %d)", MaxTags))
+	}
+	for _, t := range tags {
+		if utf8.RuneCountInString(t.Name) > 32 || strings.ContainsAny(t.Name, ",#") {
+			return ErrValidation("Validation error. Tag should be (len <= 32) without , and #")
+		}
+	}
+	return nil
+}
+
+// resolveTags finds or creates tags by names so they can be associated with note.
+// Tag can be created concurrently, so insert skips existing one and tag is read after it
+func resolveTags(db *gorm.DB, tags []Tag) []Tag {
+	tags = TagsFromNames(tagNames(tags))
+	for i := range tags {
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&Tag{Name: tags[i].Name}).Error; err != nil {
+			panic(fmt.Errorf("when saving in db: %v", err))
+		}
+		// locking read sees tag committed by other transaction
+		err := db.Clauses(clause.Locking{Strength: "SHARE"}).Where("name = ?", tags[i].Name).Take(&tags[i]).Error
+		if err != nil {
+			panic(fmt.Errorf("when fetching from db: %v", err))
+		}
+	}
+	return tags
+}
+
+func tagNames(tags []Tag) []string {
+	names := []string{}
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// LoadTags of note
+func (n *Note) LoadTags() error {
+	n.Tags = []Tag{}
+	return GetDB().Model(n).Association("Tags").Find(&n.Tags)
+}
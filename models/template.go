@@ -0,0 +1,137 @@
+package models
+
+import (
+	"fmt"
+	"notes/config"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+//Template of note, title and body have placeholders like {{date}}, {{user}} or custom {{topic}}
+type Template struct {
+	Model
+	UserID uint   `json:"user_id" gorm:"index"`
+	Name   string `json:"name" gorm:"size:64"`
+	Title  string `json:"title" gorm:"size:255"`
+	Body   string `json:"body"`
+	Public bool   `json:"public" gorm:"not null;default:false"` // anyone can use public template
+}
+
+//Validate template
+func (t *Template) Validate() error {
+	if l := utf8.RuneCountInString(strings.TrimSpace(t.Name)); l < 1 || l > 64 {
+		return ErrValidation("Validation error. Name len should be (1 <= len <= 64)")
+	}
+	if strings.TrimSpace(t.Title) == "" || utf8.RuneCountInString(t.Title) > 255 {
+		return ErrValidation("Validation error. Title len should be (1 <= len <= 255)")
+	}
+	if utf8.RuneCountInString(t.Body) > config.Cfg.BodyLength {
+		return ErrValidation(fmt.Sprintf("Validation error. Body is too big(max len %d)", config.Cfg.BodyLength))
+	}
+	return nil
+}
+
+//Create template
+func (t *Template) Create() error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if err := GetDB().Create(t).Error; err != nil {
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+	return nil
+}
+
+//Get template of user
+func (t *Template) Get() error {
+	return GetDB().Where("id = ? AND user_id = ?", t.ID, t.UserID).Take(t).Error
+}
+
+// GetUsable loads template(by ID) if user owns it or it is public
+func (t *Template) GetUsable(userID uint) error {
+	return GetDB().Where("id = ? AND (user_id = ? OR public)", t.ID, userID).Take(t).Error
+}
+
+//Update template
+func (t *Template) Update(patch *TemplatePatch) error {
+	if err := t.Get(); err != nil {
+		return err
+	}
+	if patch.Name != nil {
+		t.Name = *patch.Name
+	}
+	if patch.Title != nil {
+		t.Title = *patch.Title
+	}
+	if patch.Body != nil {
+		t.Body = *patch.Body
+	}
+	if patch.Public != nil {
+		t.Public = *patch.Public
+	}
+
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	return GetDB().Save(t).Error
+}
+
+//Remove template
+func (t *Template) Remove() error {
+	res := GetDB().Where("id = ? AND user_id = ?", t.ID, t.UserID).Delete(t)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// TemplatePatch with nullable fields
+type TemplatePatch struct {
+	Name   *string
+	Title  *string
+	Body   *string
+	Public *bool
+}
+
+// Variables used in template(builtin ones too), in order of appearance
+func (t *Template) Variables() []string {
+	vars := []string{}
+	seen := map[string]bool{}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(t.Title+"\n"+t.Body, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			vars = append(vars, m[1])
+		}
+	}
+	return vars
+}
+
+// TemplateVars are builtin variables: date, time and user(username)
+func TemplateVars(user *User, now time.Time) map[string]string {
+	return map[string]string{
+		"date": now.Format("2006-01-02"),
+		"time": now.Format("15:04"),
+		"user": user.Username,
+	}
+}
+
+// Expand placeholders of template, every used variable should be given
+func (t *Template) Expand(vars map[string]string) (title, body string, err error) {
+	for _, name := range t.Variables() {
+		if _, ok := vars[name]; !ok {
+			return "", "", ErrValidation(fmt.Sprintf("Validation error. Template variable %q is missing", name))
+		}
+	}
+	expand := func(s string) string {
+		return placeholderPattern.ReplaceAllStringFunc(s, func(p string) string {
+			return vars[placeholderPattern.FindStringSubmatch(p)[1]]
+		})
+	}
+	return expand(t.Title), expand(t.Body), nil
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"net/mail"
 	"notes/auth"
 	. "notes/config"
 
@@ -13,9 +14,17 @@ import (
 //User model
 type User struct {
 	Model
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Notes    []Note `json:"-"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Email       string `json:"email" gorm:"size:255"`       // for notifications, optional
+	StorageUsed int64  `json:"-" gorm:"not null;default:0"` // bytes of attachments
+	Notes       []Note `json:"-"`
+
+	// public profile
+	DisplayName string `json:"display_name" gorm:"size:64"`
+	Bio         string `json:"bio" gorm:"size:500"`
+	Website     string `json:"website" gorm:"size:255"`
+	AvatarID    *uint  `json:"avatar_id"` // image attachment
 }
 
 //Validate validates account data(can it be created?)
@@ -28,6 +37,16 @@ func (a *User) Validate() error {
 		return ErrValidation("Password is required(6 <= len <= 30)")
 	}
 
+	if a.Email != "" {
+		if _, err := mail.ParseAddress(a.Email); err != nil || len(a.Email) > 255 {
+			return ErrValidation("Email is invalid")
+		}
+	}
+
+	if err := a.ValidateProfile(); err != nil {
+		return err
+	}
+
 	err := GetDB().Where("username = ?", a.Username).First(&User{}).Error
 	switch err {
 	case gorm.ErrRecordNotFound:
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"notes/events"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StringList is stored as comma separated string
+type StringList []string
+
+// Value for db
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan from db
+func (l *StringList) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("can't scan %T into StringList", value)
+	}
+	*l = StringList{}
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// Has checks that list contains s
+func (l StringList) Has(s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookAllEvents subscribes webhook to every event type
+const WebhookAllEvents = "*"
+
+//Webhook receives signed events of user
+type Webhook struct {
+	Model
+	UserID uint       `json:"user_id"`
+	URL    string     `json:"url" gorm:"size:2048"`
+	Secret string     `json:"-"` // shown only when webhook is created
+	Events StringList `json:"events" gorm:"type:text"`
+	Active bool       `json:"active"`
+}
+
+// Subscribed checks that webhook wants event type
+func (h *Webhook) Subscribed(eventType string) bool {
+	return h.Active && (h.Events.Has(eventType) || h.Events.Has(WebhookAllEvents))
+}
+
+//Validate webhook
+func (h *Webhook) Validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(h.URL) > 2048 {
+		return ErrValidation("Validation error. URL should be valid http(s) url")
+	}
+	if len(h.Events) == 0 {
+		return ErrValidation("Validation error. At least one event should be specified")
+	}
+	for _, e := range h.Events {
+		if e != WebhookAllEvents && !events.Known(e) {
+			return ErrValidation(fmt.Sprintf("Validation error. Unknown event %q", e))
+		}
+	}
+	if len(h.Secret) > 128 {
+		return ErrValidation("Validation error. Secret is too long(max len 128)")
+	}
+	return nil
+}
+
+//Create webhook(generates secret if it's empty)
+func (h *Webhook) Create() error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	if h.Secret == "" {
+		h.Secret = RandomToken()
+	}
+	h.Active = true
+
+	if err := GetDB().Create(h).Error; err != nil {
+		panic(fmt.Errorf("when creating in db: %v", err))
+	}
+	return nil
+}
+
+//Get webhook
+func (h *Webhook) Get() error {
+	return GetDB().Where("id = ? AND user_id = ?", h.ID, h.UserID).Take(h).Error
+}
+
+//Update webhook
+func (h *Webhook) Update(patch *WebhookPatch) error {
+	if err := h.Get(); err != nil {
+		return err
+	}
+	if patch.URL != nil {
+		h.URL = *patch.URL
+	}
+	if patch.Events != nil {
+		h.Events = *patch.Events
+	}
+	if patch.Secret != nil {
+		if *patch.Secret == "" {
+			return ErrValidation("Validation error. Secret can't be empty")
+		}
+		h.Secret = *patch.Secret
+	}
+	if patch.Active != nil {
+		h.Active = *patch.Active
+	}
+
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	return GetDB().Save(h).Error
+}
+
+//Remove webhook with its deliveries
+func (h *Webhook) Remove() error {
+	res := GetDB().Where("id = ? AND user_id = ?", h.ID, h.UserID).Delete(h)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return GetDB().Where("webhook_id = ?", h.ID).Delete(&WebhookDelivery{}).Error
+}
+
+// WebhookPatch with nullable fields
+type WebhookPatch struct {
+	URL    *string
+	Events *StringList
+	Secret *string
+	Active *bool
+}
+
+// delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+//WebhookDelivery of one event with its attempts
+type WebhookDelivery struct {
+	Model
+	WebhookID     uint       `json:"webhook_id" gorm:"index"`
+	Event         string     `json:"event"`
+	Payload       string     `json:"payload" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"size:16;index"`
+	Attempts      int        `json:"attempts"`
+	StatusCode    int        `json:"status_code"`
+	Error         string     `json:"error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	LeasedUntil   *time.Time `json:"-"` // lease of dispatcher which attempts delivery
+}
+
+//Create pending delivery
+func (d *WebhookDelivery) Create() error {
+	now := time.Now()
+	d.Status = DeliveryPending
+	d.NextAttemptAt = &now
+	if err := GetDB().Create(d).Error; err != nil {
+		return fmt.Errorf("when creating in db: %v", err)
+	}
+	return nil
+}
+
+// DueDeliveries are pending deliveries which should be attempted by now and aren't leased
+func DueDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	due := []WebhookDelivery{}
+	err := GetDB().Where("status = ? AND next_attempt_at <= ? AND (leased_until IS NULL OR leased_until <= ?)",
+		DeliveryPending, now, now).Order("next_attempt_at").Limit(limit).Find(&due).Error
+	return due, err
+}
+
+// NextDeliveryAt is time of the nearest attempt or lease expiration
+func NextDeliveryAt() (time.Time, bool) {
+	var next time.Time
+	found := false
+	due := &WebhookDelivery{}
+	if GetDB().Where("status = ? AND leased_until IS NULL", DeliveryPending).Order("next_attempt_at").Take(due).Error == nil &&
+		due.NextAttemptAt != nil {
+		next, found = *due.NextAttemptAt, true
+	}
+	leased := &WebhookDelivery{}
+	if GetDB().Where("status = ? AND leased_until IS NOT NULL", DeliveryPending).Order("leased_until").Take(leased).Error == nil {
+		if !found || leased.LeasedUntil.Before(next) {
+			next, found = *leased.LeasedUntil, true
+		}
+	}
+	return next, found
+}
+
+// Claim due delivery for lease, only one of concurrent dispatchers succeeds.
+// Delivery is attempted again when lease expires(dispatcher failed or crashed)
+func (d *WebhookDelivery) Claim(now time.Time, lease time.Duration) (bool, error) {
+	q := GetDB().Model(&WebhookDelivery{}).Where("id = ? AND status = ?", d.ID, DeliveryPending)
+	if d.LeasedUntil == nil {
+		q = q.Where("leased_until IS NULL")
+	} else {
+		q = q.Where("leased_until = ?", d.LeasedUntil)
+	}
+	until := now.Add(lease)
+	leasedUntil := truncateTime(&until)
+	res := q.UpdateColumn("leased_until", leasedUntil)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	d.LeasedUntil = leasedUntil
+	return res.RowsAffected == 1, nil
+}
+
+// Release lease saving result of attempt, it's not saved if lease is taken by other dispatcher
+func (d *WebhookDelivery) Release() error {
+	leasedUntil := d.LeasedUntil
+	d.LeasedUntil = nil
+	res := GetDB().Select("*").Where("leased_until = ?", leasedUntil).Updates(d)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return errors.New("lease of delivery is expired")
+	}
+	return res.Error
+}
@@ -0,0 +1,42 @@
+package publishing
+
+import (
+	"log"
+	"notes/models"
+	"notes/worker"
+	"time"
+)
+
+var wake = worker.NewWaker()
+
+// WakeUp worker after schedule of note is changed
+func WakeUp() {
+	wake.WakeUp()
+}
+
+// Run worker which publishes and unpublishes scheduled notes until stop is closed.
+// Lists honor schedule at query time, worker only makes transitions persistent and emits events
+func Run(stop <-chan struct{}) {
+	worker.Run(stop, wake, func() (time.Time, bool) {
+		for applyDue() {
+		}
+		return models.NextScheduledAt()
+	})
+}
+
+// applyDue makes transitions of batch of notes, returns true if there can be more
+func applyDue() bool {
+	const batch = 50
+	due, err := models.ScheduledNotes(time.Now(), batch)
+	if err != nil {
+		log.Printf("when fetching scheduled notes: %v", err)
+		return false
+	}
+	for i := range due {
+		if err := due[i].ApplySchedule(time.Now()); err != nil {
+			log.Printf("when applying schedule of note %d: %v", due[i].ID, err)
+			return false
+		}
+	}
+	return len(due) == batch
+}
@@ -0,0 +1,146 @@
+package reminders
+
+import (
+	"fmt"
+	"log"
+	"notes/config"
+	"notes/events"
+	"notes/mail"
+	"notes/models"
+	"notes/worker"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notifier delivers fired reminder to user
+type Notifier interface {
+	Notify(r *models.Reminder, note *models.Note, user *models.User) error
+}
+
+// EventNotifier publishes reminder.due event, so it comes to event stream and webhooks
+type EventNotifier struct{}
+
+// Notify ...
+func (EventNotifier) Notify(r *models.Reminder, note *models.Note, user *models.User) error {
+	events.Publish(events.Event{Type: events.ReminderDue, UserID: user.ID, NoteID: note.ID})
+	return nil
+}
+
+// MailNotifier sends email if reminder asks for it and user has email
+type MailNotifier struct {
+	Mailer mail.Mailer
+}
+
+// Notify ...
+func (m *MailNotifier) Notify(r *models.Reminder, note *models.Note, user *models.User) error {
+	if !r.Email || user.Email == "" {
+		return nil
+	}
+	body := fmt.Sprintf("Hi, %s!\n\nYou asked to remind you about note \"%s\".\n\n%s\n", user.Username, note.Title, note.Body)
+	return m.Mailer.Send(user.Email, "Reminder: "+note.Title, body)
+}
+
+var wake = worker.NewWaker()
+
+// WakeUp scheduler after reminder is changed
+func WakeUp() {
+	wake.WakeUp()
+}
+
+// Scheduler fires due reminders. Db is the source of truth, so reminders which were due
+// while server was down are fired on start(once, recurring ones continue from now).
+// Occurrence is passed only after it's delivered, failed one is retried when Lease expires
+type Scheduler struct {
+	Notifiers   []Notifier
+	Lease       time.Duration
+	MaxAttempts int
+}
+
+// NewScheduler with event notifier and mail notifier if smtp is configured
+func NewScheduler() *Scheduler {
+	s := &Scheduler{
+		Notifiers:   []Notifier{EventNotifier{}},
+		Lease:       config.Cfg.ReminderLease,
+		MaxAttempts: config.Cfg.ReminderMaxAttempts,
+	}
+	if mailer := mail.NewSMTPMailer(); mailer != nil {
+		s.Notifiers = append(s.Notifiers, &MailNotifier{Mailer: mailer})
+	}
+	return s
+}
+
+// Run scheduler until stop is closed
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	worker.Run(stop, wake, func() (time.Time, bool) {
+		s.fireDue()
+		return models.NextReminderAt(s.Lease)
+	})
+}
+
+func (s *Scheduler) fireDue() {
+	for {
+		now := time.Now().UTC()
+		due, err := models.DueReminders(now, s.Lease, 50)
+		if err != nil {
+			log.Printf("when fetching reminders: %v", err)
+			return
+		}
+		for i := range due {
+			s.fire(&due[i], now)
+		}
+		if len(due) < 50 {
+			return
+		}
+	}
+}
+
+// fire reminder if this scheduler claimed it, reminder is delivered at least once
+func (s *Scheduler) fire(r *models.Reminder, now time.Time) {
+	claimed, err := r.Claim(now)
+	if err != nil {
+		log.Printf("when claiming reminder %d: %v", r.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	note := &models.Note{}
+	note.ID = r.NoteID
+	if err := note.GetAccessible(r.UserID, models.PermissionRead); err == gorm.ErrRecordNotFound {
+		r.Remove() // access to note is revoked
+		return
+	} else if err != nil {
+		s.failed(r, now, fmt.Errorf("when fetching note: %v", err))
+		return
+	}
+	user := &models.User{}
+	user.ID = r.UserID
+	if err := user.Get(); err != nil {
+		s.failed(r, now, fmt.Errorf("when fetching user: %v", err))
+		return
+	}
+
+	for _, n := range s.Notifiers {
+		if err := n.Notify(r, note, user); err != nil {
+			s.failed(r, now, fmt.Errorf("when notifying: %v", err))
+			return
+		}
+	}
+	s.done(r, now)
+}
+
+// failed attempt keeps reminder leased, so it's retried after lease(occurrence is skipped after MaxAttempts)
+func (s *Scheduler) failed(r *models.Reminder, now time.Time, err error) {
+	log.Printf("reminder %d(attempt %d): %v", r.ID, r.Attempts, err)
+	if r.Attempts >= s.MaxAttempts {
+		s.done(r, now)
+	}
+}
+
+func (s *Scheduler) done(r *models.Reminder, now time.Time) {
+	if err := r.Done(now); err != nil {
+		log.Printf("when passing reminder %d: %v", r.ID, err)
+	}
+}
@@ -0,0 +1,158 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// export formats
+const (
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+	FormatHTML     = "html"
+	FormatPrint    = "print"
+)
+
+var contentTypes = map[string]string{
+	FormatMarkdown: "text/markdown; charset=utf-8",
+	FormatText:     "text/plain; charset=utf-8",
+	FormatHTML:     "text/html; charset=utf-8",
+	FormatPrint:    "text/html; charset=utf-8",
+}
+
+var extensions = map[string]string{
+	FormatMarkdown: ".md",
+	FormatText:     ".txt",
+	FormatHTML:     ".html",
+	FormatPrint:    ".html",
+}
+
+// Known format
+func Known(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+// ContentType of exported file
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Filename made of title with extension of format, fallback is used for empty titles
+func Filename(title, fallback, format string) string {
+	slug := Slug(title)
+	if slug == "" {
+		slug = fallback
+	}
+	return slug + extensions[format]
+}
+
+var slugDashes = regexp.MustCompile(`-+`)
+
+// Slug is lowercase ascii representation of title(other symbols are dropped), safe for file names and urls
+func Slug(title string) string {
+	b := &strings.Builder{}
+	for _, r := range title {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(unicode.ToLower(r))
+		case r < unicode.MaxASCII:
+			b.WriteRune('-')
+		}
+	}
+	slug := strings.Trim(slugDashes.ReplaceAllString(b.String(), "-"), "-")
+	if len(slug) > 64 {
+		slug = strings.TrimRight(slug[:64], "-")
+	}
+	return slug
+}
+
+// Doc is one exported note
+type Doc struct {
+	Title     string
+	Body      string
+	Tags      []string
+	UpdatedAt time.Time
+}
+
+// Export renders docs in format, title is used for notebooks(more than one doc)
+func Export(format, title string, docs []Doc) []byte {
+	switch format {
+	case FormatMarkdown:
+		return []byte(exportMarkdown(docs))
+	case FormatText:
+		return []byte(exportText(docs))
+	case FormatHTML:
+		return []byte(exportHTML(title, docs, false))
+	case FormatPrint:
+		return []byte(exportHTML(title, docs, true))
+	}
+	return nil
+}
+
+func exportMarkdown(docs []Doc) string {
+	parts := []string{}
+	for _, d := range docs {
+		s := "# " + d.Title + "\n\n"
+		if len(d.Tags) > 0 {
+			s += "Tags: " + strings.Join(d.Tags, ", ") + "\n\n"
+		}
+		parts = append(parts, s+strings.TrimSpace(d.Body)+"\n")
+	}
+	return strings.Join(parts, "\n---\n\n")
+}
+
+func exportText(docs []Doc) string {
+	parts := []string{}
+	for _, d := range docs {
+		s := d.Title + "\n" + strings.Repeat("=", len([]rune(d.Title))) + "\n\n"
+		if len(d.Tags) > 0 {
+			s += "Tags: " + strings.Join(d.Tags, ", ") + "\n\n"
+		}
+		parts = append(parts, s+strings.TrimSpace(d.Body)+"\n")
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+const baseStyle = `body{font-family:Georgia,serif;max-width:42em;margin:2em auto;padding:0 1em;line-height:1.5;color:#222}
+pre{background:#f4f4f4;padding:.5em;overflow:auto}blockquote{border-left:3px solid #ccc;margin-left:0;padding-left:1em;color:#555}
+.meta{color:#777;font-size:.9em}`
+
+const printStyle = `@page{margin:2cm}
+@media print{body{max-width:none;margin:0;font-size:11pt}a{color:inherit;text-decoration:none}
+a[href^="http"]:after{content:" (" attr(href) ")";font-size:.8em}article{page-break-after:always}
+article:last-child{page-break-after:auto}pre,blockquote{page-break-inside:avoid}}`
+
+func exportHTML(title string, docs []Doc, print bool) string {
+	if len(docs) == 1 {
+		title = docs[0].Title
+	}
+	b := &strings.Builder{}
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	b.WriteString("<style>\n" + baseStyle + "\n")
+	if print {
+		b.WriteString(printStyle + "\n")
+	}
+	b.WriteString("</style>\n</head>\n<body>\n")
+	for _, d := range docs {
+		b.WriteString("<article>\n<h1>" + html.EscapeString(d.Title) + "</h1>\n")
+		meta := []string{}
+		if !d.UpdatedAt.IsZero() {
+			meta = append(meta, d.UpdatedAt.UTC().Format("2006-01-02 15:04 MST"))
+		}
+		if len(d.Tags) > 0 {
+			meta = append(meta, "#"+strings.Join(d.Tags, " #"))
+		}
+		if len(meta) > 0 {
+			b.WriteString("<p class=\"meta\">" + html.EscapeString(strings.Join(meta, " · ")) + "</p>\n")
+		}
+		b.WriteString(Markdown(d.Body))
+		b.WriteString("</article>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
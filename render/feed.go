@@ -0,0 +1,195 @@
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// feed formats
+const (
+	FeedAtom = "atom"
+	FeedRSS  = "rss"
+)
+
+var feedTypes = map[string]string{
+	FeedAtom: "application/atom+xml; charset=utf-8",
+	FeedRSS:  "application/rss+xml; charset=utf-8",
+}
+
+// FeedContentType of feed format, empty for unknown format
+func FeedContentType(format string) string {
+	return feedTypes[format]
+}
+
+// Feed of published notes, links are absolute
+type Feed struct {
+	Title   string
+	Link    string // page of feed
+	Self    string // url of feed itself
+	Updated time.Time
+	Entries []Entry
+}
+
+// Entry of feed, Content is markdown and it's rendered only if Full is set
+type Entry struct {
+	Title     string
+	Link      string
+	Author    string
+	Published time.Time
+	Updated   time.Time
+	Tags      []string
+	Content   string
+	Full      bool
+}
+
+// summaryLength of entry without full content(in runes)
+const summaryLength = 280
+
+// Summary is beginning of text, cut by words
+func Summary(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= summaryLength {
+		return text
+	}
+	cut := string([]rune(text)[:summaryLength])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Author     string         `xml:"author>name"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// Atom renders feed as Atom 1.0
+func Atom(f *Feed) []byte {
+	feed := &atomFeed{
+		ID:      f.Self,
+		Title:   f.Title,
+		Links:   []atomLink{{Rel: "self", Type: feedTypes[FeedAtom], Href: f.Self}, {Rel: "alternate", Href: f.Link}},
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+	}
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			ID:        e.Link,
+			Title:     e.Title,
+			Link:      atomLink{Rel: "alternate", Href: e.Link},
+			Author:    e.Author,
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Updated:   e.Updated.UTC().Format(time.RFC3339),
+		}
+		for _, tag := range e.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{tag})
+		}
+		if e.Full {
+			entry.Content = &atomText{Type: "html", Text: Markdown(e.Content)}
+		} else {
+			entry.Summary = &atomText{Type: "text", Text: Summary(e.Content)}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return marshalFeed(feed)
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Text        string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Author      string   `xml:"dc:creator"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssFeed struct {
+	XMLName       xml.Name  `xml:"rss"`
+	Version       string    `xml:"version,attr"`
+	AtomNS        string    `xml:"xmlns:atom,attr"`
+	DCNS          string    `xml:"xmlns:dc,attr"`
+	Title         string    `xml:"channel>title"`
+	Link          string    `xml:"channel>link"`
+	Self          atomLink  `xml:"channel>atom:link"`
+	Description   string    `xml:"channel>description"`
+	LastBuildDate string    `xml:"channel>lastBuildDate"`
+	Items         []rssItem `xml:"channel>item"`
+}
+
+// RSS renders feed as RSS 2.0(updated times are lost, RSS has only publication dates)
+func RSS(f *Feed) []byte {
+	feed := &rssFeed{
+		Version:       "2.0",
+		AtomNS:        "http://www.w3.org/2005/Atom",
+		DCNS:          "http://purl.org/dc/elements/1.1/",
+		Title:         f.Title,
+		Link:          f.Link,
+		Self:          atomLink{Rel: "self", Type: feedTypes[FeedRSS], Href: f.Self},
+		Description:   f.Title,
+		LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+	}
+	for _, e := range f.Entries {
+		item := rssItem{
+			Title:      e.Title,
+			Link:       e.Link,
+			GUID:       rssGUID{IsPermaLink: true, Text: e.Link},
+			Author:     e.Author,
+			PubDate:    e.Published.UTC().Format(time.RFC1123Z),
+			Categories: e.Tags,
+		}
+		if e.Full {
+			item.Description = Markdown(e.Content)
+		} else {
+			item.Description = Summary(e.Content)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return marshalFeed(feed)
+}
+
+func marshalFeed(feed interface{}) []byte {
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		panic(fmt.Errorf("when encoding feed: %v", err))
+	}
+	return append([]byte(xml.Header), append(b, '\n')...)
+}
@@ -0,0 +1,134 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Markdown converts common subset of markdown to safe html:
+// headings, paragraphs, lists, blockquotes, fenced code, rules, emphasis, inline code and links.
+// Raw html is escaped, links are allowed only with http(s), mailto or relative urls
+func Markdown(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	out := &strings.Builder{}
+	renderBlocks(out, lines)
+	return out.String()
+}
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	ulItemRe    = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	olItemRe    = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	ruleRe      = regexp.MustCompile(`^\s{0,3}(-(\s*-){2,}|\*(\s*\*){2,}|_(\s*_){2,})\s*$`)
+	fenceRe     = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	quoteRe     = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	codeSpanRe  = regexp.MustCompile("`([^`]+)`")
+	linkRe      = regexp.MustCompile(`\[([^\[\]]+)\]\(([^()\s]+)\)`)
+	strongRe    = regexp.MustCompile(`(\*\*|__)([^*_]+?)(\*\*|__)`)
+	emRe        = regexp.MustCompile(`(^|[^\w*])[*_]([^*_\s][^*_]*?)[*_]($|[^\w*])`)
+	safeURLRe   = regexp.MustCompile(`^(https?://|mailto:|/|#|\./|\.\./)`)
+	relativeURL = regexp.MustCompile(`^[\w\-./?=&%#]+$`)
+)
+
+func renderBlocks(out *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case fenceRe.MatchString(line):
+			fence := fenceRe.FindStringSubmatch(line)[1]
+			code := []string{}
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // closing fence
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case headingRe.MatchString(line):
+			m := headingRe.FindStringSubmatch(line)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + Inline(m[2]) + "</h" + level + ">\n")
+			i++
+		case ruleRe.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+		case quoteRe.MatchString(line):
+			quoted := []string{}
+			for i < len(lines) && quoteRe.MatchString(lines[i]) {
+				quoted = append(quoted, quoteRe.FindStringSubmatch(lines[i])[1])
+				i++
+			}
+			out.WriteString("<blockquote>\n")
+			renderBlocks(out, quoted)
+			out.WriteString("</blockquote>\n")
+		case ulItemRe.MatchString(line):
+			i = renderList(out, lines, i, ulItemRe, "ul")
+		case olItemRe.MatchString(line):
+			i = renderList(out, lines, i, olItemRe, "ol")
+		default:
+			para := []string{}
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "" && !startsBlock(lines[i]) {
+				para = append(para, strings.TrimSpace(lines[i]))
+				i++
+			}
+			if len(para) == 0 { // line looks like block but isn't handled above
+				para = append(para, strings.TrimSpace(lines[i]))
+				i++
+			}
+			out.WriteString("<p>" + Inline(strings.Join(para, "\n")) + "</p>\n")
+		}
+	}
+}
+
+func startsBlock(line string) bool {
+	return fenceRe.MatchString(line) || headingRe.MatchString(line) || ruleRe.MatchString(line) ||
+		quoteRe.MatchString(line) || ulItemRe.MatchString(line) || olItemRe.MatchString(line)
+}
+
+func renderList(out *strings.Builder, lines []string, i int, itemRe *regexp.Regexp, tag string) int {
+	out.WriteString("<" + tag + ">\n")
+	for i < len(lines) && itemRe.MatchString(lines[i]) {
+		item := itemRe.FindStringSubmatch(lines[i])[1]
+		i++
+		// continuation lines are indented
+		for i < len(lines) && strings.HasPrefix(lines[i], "  ") && !itemRe.MatchString(lines[i]) {
+			item += "\n" + strings.TrimSpace(lines[i])
+			i++
+		}
+		out.WriteString("<li>" + Inline(item) + "</li>\n")
+	}
+	out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// Inline renders emphasis, code spans and links of one text block(html is escaped)
+func Inline(text string) string {
+	// code spans are split out so their content is not formatted
+	res := &strings.Builder{}
+	last := 0
+	for _, m := range codeSpanRe.FindAllStringSubmatchIndex(text, -1) {
+		res.WriteString(formatText(text[last:m[0]]))
+		res.WriteString("<code>" + html.EscapeString(text[m[2]:m[3]]) + "</code>")
+		last = m[1]
+	}
+	res.WriteString(formatText(text[last:]))
+	return strings.ReplaceAll(res.String(), "\n", "<br>\n")
+}
+
+func formatText(text string) string {
+	text = html.EscapeString(text)
+	text = linkRe.ReplaceAllStringFunc(text, func(s string) string {
+		m := linkRe.FindStringSubmatch(s)
+		url := html.UnescapeString(m[2])
+		if !safeURLRe.MatchString(url) && !(relativeURL.MatchString(url) && !strings.Contains(url, ":")) {
+			return s
+		}
+		return `<a href="` + html.EscapeString(url) + `">` + m[1] + "</a>"
+	})
+	text = strongRe.ReplaceAllString(text, "<strong>$2</strong>")
+	text = emRe.ReplaceAllString(text, "$1<em>$2</em>$3")
+	return text
+}
@@ -0,0 +1,186 @@
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frequencies
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxIterations bounds search of next occurrence(about 27 years of daily occurrences)
+const maxIterations = 10000
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Rule is subset of RFC 5545 recurrence rule: FREQ, INTERVAL, BYDAY(weekly only), COUNT and UNTIL
+type Rule struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    *time.Time
+}
+
+// Parse rule like "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", "RRULE:" prefix is allowed
+func Parse(s string) (*Rule, error) {
+	r := &Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch key {
+		case "FREQ":
+			switch value {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %s", value)
+			}
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(value); err != nil || r.Interval < 1 {
+				return nil, errors.New("INTERVAL should be positive number")
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(value); err != nil || r.Count < 1 {
+				return nil, errors.New("COUNT should be positive number")
+			}
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("invalid BYDAY %s", day)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+	if r.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if len(r.ByDay) > 0 && r.Freq != Weekly {
+		return nil, errors.New("BYDAY is supported only with FREQ=WEEKLY")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return nil, errors.New("COUNT and UNTIL can't be used together")
+	}
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" { // whole day is included
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %s", value)
+}
+
+// Next occurrence after moment for series started at start, false when series is over.
+// Wall clock of start is kept in its location, so daylight saving time doesn't shift occurrences
+func (r *Rule) Next(start, after time.Time) (time.Time, bool) {
+	n := 0
+	var found time.Time
+	ok := false
+	r.each(start, func(t time.Time) bool {
+		n++
+		if r.Count > 0 && n > r.Count || r.Until != nil && t.After(*r.Until) {
+			return false
+		}
+		if t.After(after) {
+			found, ok = t, true
+			return false
+		}
+		return true
+	})
+	return found, ok
+}
+
+// each calls f for occurrences in order until it returns false
+func (r *Rule) each(start time.Time, f func(time.Time) bool) {
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	loc := start.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, loc)
+	}
+
+	for k := 0; k < maxIterations; k++ {
+		switch r.Freq {
+		case Daily:
+			if !f(at(y, m, d+k*r.Interval)) {
+				return
+			}
+		case Weekly:
+			if len(r.ByDay) == 0 {
+				if !f(at(y, m, d+7*k*r.Interval)) {
+					return
+				}
+				continue
+			}
+			// week of start begins on monday
+			monday := d - (int(start.Weekday())+6)%7 + 7*k*r.Interval
+			for offset := 0; offset < 7; offset++ {
+				t := at(y, m, monday+offset)
+				if t.Before(start) || !r.hasDay(t.Weekday()) {
+					continue
+				}
+				if !f(t) {
+					return
+				}
+			}
+		case Monthly:
+			first := at(y, m+time.Month(k*r.Interval), 1)
+			if d <= daysIn(first.Year(), first.Month()) { // months without such day are skipped
+				if !f(at(first.Year(), first.Month(), d)) {
+					return
+				}
+			}
+		case Yearly:
+			if d <= daysIn(y+k*r.Interval, m) {
+				if !f(at(y+k*r.Interval, m, d)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Rule) hasDay(wd time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,225 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"notes/config"
+	"notes/events"
+	"notes/models"
+	"sync"
+	"time"
+)
+
+// Sitemap lists published notes and their authors. It is split into parts by ranges of ids
+// (notes-N and authors-N), so note event makes only its parts to be regenerated.
+// Parts hold paths, base url is added when sitemap is rendered
+
+type entry struct {
+	path    string
+	lastMod time.Time
+}
+
+type part struct {
+	name    string
+	entries []entry
+	lastMod time.Time
+}
+
+var (
+	mu    sync.Mutex
+	size  int                  // parts are made for this size
+	parts = map[string]*part{} // missing part is regenerated from db
+)
+
+// Invalidate parts with note and its author
+func Invalidate(noteID, userID uint) {
+	mu.Lock()
+	defer mu.Unlock()
+	if size > 0 {
+		delete(parts, partName("notes", noteID))
+		delete(parts, partName("authors", userID))
+	}
+}
+
+// Reset cache, everything is regenerated from db
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	parts = map[string]*part{}
+}
+
+// Run invalidates cached parts on events of notes until stop is closed
+func Run(stop <-chan struct{}) {
+	for {
+		sub := events.Subscribe(0)
+		Reset() // events could be missed before subscription
+	receive:
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok { // too slow, cache is reset with new subscription
+					break receive
+				}
+				if e.NoteID != 0 {
+					Invalidate(e.NoteID, e.UserID)
+				}
+			case <-stop:
+				events.Unsubscribe(sub)
+				return
+			}
+		}
+	}
+}
+
+func partName(kind string, id uint) string {
+	return fmt.Sprintf("%s-%d", kind, id/uint(size))
+}
+
+// load part from cache or db, nil is returned for empty part
+func load(kind string, bucket uint) (*part, error) {
+	name := fmt.Sprintf("%s-%d", kind, bucket)
+	if p, ok := parts[name]; ok {
+		return p, nil
+	}
+
+	from, to := bucket*uint(size), (bucket+1)*uint(size)
+	notes := []models.Note{}
+	db := models.GetDB().Model(&models.Note{}).Scopes(models.LiveAt(time.Now())).
+		Select("notes.id, notes.user_id, notes.updated_at, notes.publish_at")
+	if kind == "notes" {
+		db = db.Where("notes.id >= ? AND notes.id < ?", from, to)
+	} else {
+		db = db.Where("notes.user_id >= ? AND notes.user_id < ?", from, to)
+	}
+	if err := db.Order("notes.id").Find(&notes).Error; err != nil {
+		return nil, err
+	}
+
+	p := &part{name: name}
+	authors := map[uint]int{} // index of author's entry
+	for i := range notes {
+		n := &notes[i]
+		lastMod := n.LastModified()
+		if lastMod.After(p.lastMod) {
+			p.lastMod = lastMod
+		}
+		if kind == "notes" {
+			p.entries = append(p.entries, entry{fmt.Sprintf("/api/notes/%d", n.ID), lastMod})
+		} else if j, ok := authors[n.UserID]; !ok {
+			authors[n.UserID] = len(p.entries)
+			p.entries = append(p.entries, entry{fmt.Sprintf("/api/users/%d", n.UserID), lastMod})
+		} else if lastMod.After(p.entries[j].lastMod) {
+			p.entries[j].lastMod = lastMod
+		}
+	}
+	if len(p.entries) == 0 {
+		p = nil
+	}
+	parts[name] = p
+	return p, nil
+}
+
+// all non-empty parts: notes first, then authors
+func all() ([]*part, error) {
+	if size != config.Cfg.SitemapSize {
+		size = config.Cfg.SitemapSize
+		parts = map[string]*part{}
+	}
+	list := []*part{}
+	for _, kind := range []string{"notes", "authors"} {
+		var maxID uint
+		table := map[string]string{"notes": "notes", "authors": "users"}[kind]
+		if err := models.GetDB().Table(table).Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error; err != nil {
+			return nil, err
+		}
+		for bucket := uint(0); bucket <= maxID/uint(size); bucket++ {
+			p, err := load(kind, bucket)
+			if err != nil {
+				return nil, err
+			}
+			if p != nil {
+				list = append(list, p)
+			}
+		}
+	}
+	return list, nil
+}
+
+type urlXML struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type urlsetXML struct {
+	XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []urlXML `xml:"url"`
+}
+
+type indexXML struct {
+	XMLName  xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []urlXML `xml:"sitemap"`
+}
+
+func lastModOf(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func urlset(base string, parts ...*part) []byte {
+	set := &urlsetXML{URLs: []urlXML{}}
+	for _, p := range parts {
+		for _, e := range p.entries {
+			set.URLs = append(set.URLs, urlXML{base + e.path, lastModOf(e.lastMod)})
+		}
+	}
+	return marshal(set)
+}
+
+func marshal(v interface{}) []byte {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		panic(fmt.Errorf("when encoding sitemap: %v", err))
+	}
+	return append([]byte(xml.Header), append(b, '\n')...)
+}
+
+// Index is /sitemap.xml: all urls if they fit into one file, otherwise index of parts(/sitemaps/{name}.xml)
+func Index(base string) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	list, err := all()
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, p := range list {
+		count += len(p.entries)
+	}
+	if count <= size {
+		return urlset(base, list...), nil
+	}
+	index := &indexXML{}
+	for _, p := range list {
+		index.Sitemaps = append(index.Sitemaps, urlXML{base + "/sitemaps/" + p.name + ".xml", lastModOf(p.lastMod)})
+	}
+	return marshal(index), nil
+}
+
+// Part of sitemap by name, false if it is empty or unknown
+func Part(base, name string) ([]byte, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	list, err := all()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, p := range list {
+		if p.name == name {
+			return urlset(base, p), true, nil
+		}
+	}
+	return nil, false, nil
+}
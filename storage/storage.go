@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	. "notes/config"
+)
+
+// ErrNotFound is returned when there is no blob with key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps binary content of attachments by keys
+type BlobStore interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var store BlobStore
+
+// Get returns configured store
+func Get() BlobStore {
+	return store
+}
+
+// Set store used by attachments
+func Set(s BlobStore) {
+	store = s
+}
+
+// Init store by config(STORAGE_BACKEND is local or s3)
+func Init() error {
+	switch Cfg.StorageBackend {
+	case "local":
+		s, err := NewLocalStore(Cfg.StoragePath)
+		if err != nil {
+			return err
+		}
+		Set(s)
+	case "s3":
+		Set(&S3Store{
+			Endpoint:  Cfg.S3Endpoint,
+			Region:    Cfg.S3Region,
+			Bucket:    Cfg.S3Bucket,
+			AccessKey: Cfg.S3AccessKey,
+			SecretKey: Cfg.S3SecretKey,
+			Client:    &http.Client{Timeout: Cfg.S3Timeout},
+		})
+	default:
+		return fmt.Errorf("unknown storage backend %q", Cfg.StorageBackend)
+	}
+	return nil
+}
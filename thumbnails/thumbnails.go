@@ -0,0 +1,100 @@
+package thumbnails
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"notes/imaging"
+	"notes/models"
+	"notes/storage"
+	"notes/worker"
+	"sort"
+	"time"
+)
+
+var wake = worker.NewWaker()
+
+// WakeUp worker after upload of image
+func WakeUp() {
+	wake.WakeUp()
+}
+
+// Run worker which makes thumbnails of pending attachments until stop is closed.
+// Queue is stored in db(thumbnail status of attachments), so nothing is lost on restart
+func Run(stop <-chan struct{}) {
+	worker.Run(stop, wake, func() (time.Time, bool) {
+		for processPending() {
+		}
+		return time.Time{}, false
+	})
+}
+
+// processPending makes thumbnails of batch of attachments, returns true if there can be more
+func processPending() bool {
+	const batch = 10
+	pending := []models.Attachment{}
+	err := models.GetDB().Where("thumbnail_status = ?", models.ThumbnailsPending).Order("id").Limit(batch).Find(&pending).Error
+	if err != nil {
+		log.Printf("when fetching attachments: %v", err)
+		return false
+	}
+	for i := range pending {
+		process(&pending[i])
+	}
+	return len(pending) == batch
+}
+
+func process(a *models.Attachment) {
+	sizes, err := generate(a)
+	status := models.ThumbnailsDone
+	if err != nil {
+		log.Printf("when making thumbnails of attachment %d: %v", a.ID, err)
+		status = models.ThumbnailsFailed
+	}
+
+	res := models.GetDB().Model(a).Where("thumbnail_status = ?", models.ThumbnailsPending).
+		Updates(map[string]interface{}{"thumbnails": sizes, "thumbnail_status": status})
+	if res.Error != nil {
+		log.Printf("when saving thumbnails of attachment %d: %v", a.ID, res.Error)
+	}
+	if res.Error != nil || res.RowsAffected == 0 { // attachment is removed meanwhile
+		for _, size := range sizes {
+			storage.Get().Delete(a.ThumbnailKey(size))
+		}
+	}
+}
+
+// generate thumbnails of all sizes and store them
+func generate(a *models.Attachment) (models.StringList, error) {
+	content, err := a.Open()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(content, a.Size))
+	content.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range models.ThumbnailSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sizes := models.StringList{}
+	for _, name := range names {
+		thumb, err := imaging.Thumbnail(data, a.ContentType, models.ThumbnailSizes[name])
+		if err != nil {
+			return sizes, err
+		}
+		err = storage.Get().Put(a.ThumbnailKey(name), bytes.NewReader(thumb), int64(len(thumb)), imaging.ThumbnailType(a.ContentType))
+		if err != nil {
+			return sizes, fmt.Errorf("when storing thumbnail: %v", err)
+		}
+		sizes = append(sizes, name)
+	}
+	return sizes, nil
+}
@@ -0,0 +1,65 @@
+package webhooks
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"notes/config"
+	"syscall"
+	"time"
+)
+
+// internal networks, webhooks must not be used to reach services behind firewall
+var internalNets = parseNets(
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", // private
+	"127.0.0.0/8", "::1/128", // loopback
+	"169.254.0.0/16", "fe80::/10", // link-local
+	"fc00::/7", // unique local
+	"0.0.0.0/8", "::/128",
+)
+
+func parseNets(cidrs ...string) []*net.IPNet {
+	nets := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func internal(ip net.IP) bool {
+	for _, n := range internalNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// guardDial checks resolved address right before connecting, so dns can't point webhook to internal host
+func guardDial(network, address string, _ syscall.RawConn) error {
+	if config.Cfg.WebhookAllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || internal(ip) {
+		return fmt.Errorf("address %s is not allowed for webhooks", host)
+	}
+	return nil
+}
+
+// NewClient for deliveries, it refuses to connect to internal addresses unless Cfg.WebhookAllowPrivate
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: guardDial}
+	return &http.Client{
+		Timeout: timeout,
+		// no proxy, connection to it would bypass the check
+		Transport: &http.Transport{DialContext: dialer.DialContext, MaxIdleConns: 10, IdleConnTimeout: time.Minute},
+	}
+}
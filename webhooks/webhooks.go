@@ -0,0 +1,223 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"notes/config"
+	"notes/events"
+	"notes/models"
+	"notes/worker"
+	"strconv"
+	"time"
+)
+
+// TestEvent is sent by request of user to check webhook
+const TestEvent = "webhook.test"
+
+// Payload is json body of delivery
+type Payload struct {
+	Event   string       `json:"event"`
+	EventID uint64       `json:"event_id,omitempty"`
+	Time    time.Time    `json:"time"`
+	UserID  uint         `json:"user_id"`
+	Note    *models.Note `json:"note,omitempty"`
+}
+
+// Sign body with secret, receiver should compare it with X-Notes-Signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var wake = worker.NewWaker()
+
+// Enqueue delivery of payload to webhook
+func Enqueue(hook *models.Webhook, payload *Payload) (*models.WebhookDelivery, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	delivery := &models.WebhookDelivery{WebhookID: hook.ID, Event: payload.Event, Payload: string(body)}
+	if err := delivery.Create(); err != nil {
+		return nil, err
+	}
+	wake.WakeUp()
+	return delivery, nil
+}
+
+// Dispatcher delivers events to subscribed webhooks.
+// Queue is stored in db, failed deliveries are retried with exponential backoff
+type Dispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+	// delivery is leased for attempt, it's attempted again if lease expires before result is saved
+	Lease time.Duration
+}
+
+// NewDispatcher configured by Cfg
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		Client:      NewClient(config.Cfg.WebhookTimeout),
+		MaxAttempts: config.Cfg.WebhookMaxAttempts,
+		Backoff:     config.Cfg.WebhookBackoff,
+		Lease:       3 * config.Cfg.WebhookTimeout, // attempt is limited by timeout of client
+	}
+}
+
+// Run dispatcher until stop is closed
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	go d.listen(stop)
+	worker.Run(stop, wake, d.processDue)
+}
+
+// listen for events and enqueue them, resubscribes if it was too slow
+func (d *Dispatcher) listen(stop <-chan struct{}) {
+	var lastID uint64
+	for {
+		sub, missed, _ := events.SubscribeSince(0, lastID)
+		for _, e := range missed {
+			d.handle(e)
+			lastID = e.ID
+		}
+	receive:
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					break receive
+				}
+				d.handle(e)
+				lastID = e.ID
+			case <-stop:
+				events.Unsubscribe(sub)
+				return
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) handle(e events.Event) {
+	hooks := []models.Webhook{}
+	if err := models.GetDB().Where("user_id = ? AND active", e.UserID).Find(&hooks).Error; err != nil {
+		log.Printf("when fetching webhooks: %v", err)
+		return
+	}
+
+	var payload *Payload
+	for i := range hooks {
+		if !hooks[i].Subscribed(e.Type) {
+			continue
+		}
+		if payload == nil {
+			payload = eventPayload(e)
+		}
+		if _, err := Enqueue(&hooks[i], payload); err != nil {
+			log.Printf("when enqueueing delivery: %v", err)
+		}
+	}
+}
+
+func eventPayload(e events.Event) *Payload {
+	payload := &Payload{Event: e.Type, EventID: e.ID, Time: e.Time, UserID: e.UserID}
+	if e.NoteID != 0 {
+		payload.Note = &models.Note{}
+		if e.Type == events.NoteDeleted || models.GetDB().Take(payload.Note, e.NoteID).Error != nil {
+			payload.Note = &models.Note{Model: models.Model{ID: e.NoteID}, UserID: e.UserID}
+		}
+	}
+	return payload
+}
+
+// processDue attempts due deliveries and returns time of next pending one
+func (d *Dispatcher) processDue() (time.Time, bool) {
+	now := time.Now()
+	due, err := models.DueDeliveries(now, 50)
+	if err != nil {
+		log.Printf("when fetching deliveries: %v", err)
+		return time.Time{}, false
+	}
+	for i := range due {
+		claimed, err := due[i].Claim(now, d.Lease)
+		if err != nil {
+			log.Printf("when claiming delivery %d: %v", due[i].ID, err)
+			continue
+		}
+		if claimed { // otherwise it's attempted by other dispatcher
+			d.attempt(&due[i])
+		}
+	}
+	return models.NextDeliveryAt()
+}
+
+func (d *Dispatcher) attempt(delivery *models.WebhookDelivery) {
+	hook := &models.Webhook{}
+	if err := models.GetDB().Take(hook, delivery.WebhookID).Error; err != nil {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "webhook is removed"
+		delivery.NextAttemptAt = nil
+		d.save(delivery)
+		return
+	}
+
+	delivery.Attempts++
+	delivery.StatusCode = 0
+	delivery.Error = ""
+	if err := d.post(hook, delivery); err != nil {
+		delivery.Error = err.Error()
+	}
+
+	switch {
+	case delivery.StatusCode >= 200 && delivery.StatusCode < 300:
+		delivery.Status = models.DeliveryDelivered
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := time.Now().Add(d.Backoff << (delivery.Attempts - 1))
+		delivery.NextAttemptAt = &next
+	}
+	d.save(delivery)
+}
+
+func (d *Dispatcher) post(hook *models.Webhook, delivery *models.WebhookDelivery) error {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notes-webhooks")
+	req.Header.Set("X-Notes-Event", delivery.Event)
+	req.Header.Set("X-Notes-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Notes-Signature", Sign(hook.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (d *Dispatcher) save(delivery *models.WebhookDelivery) {
+	if err := delivery.Release(); err != nil {
+		log.Printf("when saving delivery %d: %v", delivery.ID, err)
+	}
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"time"
+)
+
+// PollInterval is how often work is done if nothing wakes loop up
+const PollInterval = time.Minute
+
+// Waker wakes up loop which waits for work
+type Waker chan struct{}
+
+// NewWaker for one loop
+func NewWaker() Waker {
+	return make(Waker, 1)
+}
+
+// WakeUp loop, doesn't block(wake ups before loop waits again are merged into one)
+func (w Waker) WakeUp() {
+	select {
+	case w <- struct{}{}:
+	default:
+	}
+}
+
+// Run loop until stop is closed. Work does what is due and returns time when it's needed
+// next time(if known), it's called again then, on wake up or after PollInterval, whatever is earlier
+func Run(stop <-chan struct{}, wake Waker, work func() (time.Time, bool)) {
+	for {
+		wait := PollInterval
+		if next, ok := work(); ok {
+			if until := time.Until(next); until < wait {
+				wait = until
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-wake:
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}